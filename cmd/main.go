@@ -1,6 +1,8 @@
 package main
 
 import (
+	"os"
+
 	_ "github.com/redeflesq/auth-example/docs"
 	"github.com/redeflesq/auth-example/internal/app"
 )
@@ -18,5 +20,21 @@ import (
 // @description Type "Bearer" followed by a space and JWT token. Example: "Bearer eyJhbGciOi..."
 
 func main() {
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		app.Migrate(os.Args[2:])
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "client" {
+		app.Clients(os.Args[2:])
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "user" {
+		app.Users(os.Args[2:])
+		return
+	}
+
 	app.Run()
 }
@@ -1,4 +1,4 @@
-// Package docs Code generated by swaggo/swag at 2025-07-06 01:57:08.6172356 +0700 +07 m=+3.032030901. DO NOT EDIT
+// Package docs Code generated by swaggo/swag at 2026-10-18 06:34:40.615108778 +0000 UTC m=+3.683230056. DO NOT EDIT
 package docs
 
 import "github.com/swaggo/swag"
@@ -15,26 +15,75 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/auth/logout": {
-            "post": {
+        "/.well-known/jwks.json": {
+            "get": {
+                "description": "Returns public keys for access token signature verification. Tokens reference the key by the kid header. Retired keys stay published until all tokens signed with them have expired. Empty for HS512.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Keys"
+                ],
+                "summary": "JSON Web Key Set",
+                "responses": {
+                    "200": {
+                        "description": "Public keys",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.JWKSResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/.well-known/openid-configuration": {
+            "get": {
+                "description": "Describes issuer, endpoints, scopes and access token claims. Generated from the registered routes and the current token configuration, endpoints that are not served are omitted. ID tokens are not issued, so id_token_signing_alg_values_supported is omitted. claims_supported lists the claims set by the service and the ones declared by the claims provider.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Keys"
+                ],
+                "summary": "OpenID Connect discovery document",
+                "responses": {
+                    "200": {
+                        "description": "Discovery document",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.OpenIDConfigurationResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/users": {
+            "get": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Revokes current access token and all associated refresh tokens. Requires valid JWT in Authorization header.",
+                "description": "Returns the account with the given username, its user_id is used by the other /admin routes. Requires valid JWT in Authorization header with the admin or support role and the admin scope.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Authentication"
+                    "Admin"
+                ],
+                "summary": "Find a user by username",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Username, case insensitive",
+                        "name": "username",
+                        "in": "query",
+                        "required": true
+                    }
                 ],
-                "summary": "Logout user",
                 "responses": {
                     "200": {
-                        "description": "Successfully logged out",
+                        "description": "User account",
                         "schema": {
-                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.SuccessResponse"
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.AdminUserResponse"
                         }
                     },
                     "401": {
@@ -43,6 +92,18 @@ const docTemplate = `{
                             "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
                         }
                     },
+                    "403": {
+                        "description": "Insufficient role or scope",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "User not found",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
+                        }
+                    },
                     "500": {
                         "description": "Internal server error",
                         "schema": {
@@ -52,26 +113,35 @@ const docTemplate = `{
                 }
             }
         },
-        "/auth/me": {
-            "get": {
+        "/admin/users/{user_id}/logout": {
+            "post": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Returns the user ID. Requires valid JWT in Authorization header.",
+                "description": "Revokes refresh and access tokens of all sessions of any user, takes effect immediately. Works for users without an account (AUTH_TRUSTED_ISSUER) as well. Requires valid JWT in Authorization header with the admin role and the admin scope.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Authentication"
+                    "Admin"
+                ],
+                "summary": "Force logout of a user",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User id",
+                        "name": "user_id",
+                        "in": "path",
+                        "required": true
+                    }
                 ],
-                "summary": "Get current user ID",
                 "responses": {
                     "200": {
-                        "description": "Successfully retrieved user ID",
+                        "description": "Sessions revoked",
                         "schema": {
-                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.UserIdResponse"
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.SuccessResponse"
                         }
                     },
                     "401": {
@@ -79,18 +149,30 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
                         }
+                    },
+                    "403": {
+                        "description": "Insufficient role or scope",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
+                        }
                     }
                 }
             }
         },
-        "/auth/refresh": {
-            "post": {
+        "/admin/users/{user_id}/roles": {
+            "put": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Generates new access and refresh tokens pair using valid refresh token and valid JWT from Authorization header.",
+                "description": "Replaces the roles of a user (user, admin, support). Tokens carry roles from the moment they were issued, so all sessions of the user are revoked and the new roles apply after the next sign-in. Requires valid JWT in Authorization header with the admin role and the admin scope.",
                 "consumes": [
                     "application/json"
                 ],
@@ -98,29 +180,36 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "Authentication"
+                    "Admin"
                 ],
-                "summary": "Refresh authentication tokens",
+                "summary": "Set roles of a user",
                 "parameters": [
                     {
-                        "description": "Refresh token",
+                        "type": "string",
+                        "description": "User id",
+                        "name": "user_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "New roles",
                         "name": "request",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.TokenRequest"
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.UserRolesRequest"
                         }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "New tokens pair",
+                        "description": "Roles updated",
                         "schema": {
-                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.TokenResponse"
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.SuccessResponse"
                         }
                     },
                     "400": {
-                        "description": "Invalid request format",
+                        "description": "Invalid request or unknown role",
                         "schema": {
                             "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
                         }
@@ -131,6 +220,18 @@ const docTemplate = `{
                             "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
                         }
                     },
+                    "403": {
+                        "description": "Insufficient role or scope",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "User not found",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
+                        }
+                    },
                     "500": {
                         "description": "Internal server error",
                         "schema": {
@@ -140,9 +241,168 @@ const docTemplate = `{
                 }
             }
         },
-        "/auth/token": {
+        "/admin/users/{user_id}/sessions": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Returns active sessions of any user in the same format as GET /auth/sessions. Requires valid JWT in Authorization header with the admin or support role and the admin scope.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "List sessions of a user",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User id",
+                        "name": "user_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Active sessions",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.SessionsResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized - invalid or revoked tokens",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Insufficient role or scope",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/users/{user_id}/sessions/{pair_id}": {
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Signs out one session of any user by its pair_id from GET /admin/users/{user_id}/sessions. Revokes all refresh and access tokens of the session. Requires valid JWT in Authorization header with the admin or support role and the admin scope.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Revoke a session of a user",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User id",
+                        "name": "user_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Session pair_id",
+                        "name": "pair_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Session revoked",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.SuccessResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized - invalid or revoked tokens",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Insufficient role or scope",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Session not found",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/logout": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Revokes current access token and all associated refresh tokens. Requires valid JWT in Authorization header.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Authentication"
+                ],
+                "summary": "Logout user",
+                "responses": {
+                    "200": {
+                        "description": "Successfully logged out",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.SuccessResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized - invalid or revoked tokens",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/logout-all": {
             "post": {
-                "description": "Creates new access and refresh tokens pair for specified user ID",
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Revokes refresh and access tokens of all sessions of the current user, takes effect immediately. With keep_current the calling session stays signed in. Requires valid JWT in Authorization header with the sessions:write scope.",
                 "consumes": [
                     "application/json"
                 ],
@@ -150,61 +410,1316 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "Authentication"
+                    "Sessions"
                 ],
-                "summary": "Generate new authentication tokens",
+                "summary": "Sign out everywhere",
                 "parameters": [
                     {
-                        "description": "User ID",
+                        "description": "Options",
                         "name": "request",
                         "in": "body",
-                        "required": true,
                         "schema": {
-                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.UserIdRequest"
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.LogoutAllRequest"
                         }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Successfully generated tokens",
+                        "description": "Sessions revoked",
                         "schema": {
-                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.TokenResponse"
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.SuccessResponse"
                         }
                     },
                     "400": {
-                        "description": "Invalid request or empty user ID",
+                        "description": "Invalid request format",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized - invalid or revoked tokens",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Insufficient scope",
                         "schema": {
                             "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
                         }
                     },
                     "500": {
-                        "description": "Failed to generate or save tokens",
+                        "description": "Internal server error",
                         "schema": {
                             "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
                         }
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "github_com_redeflesq_auth-example_internal_model.ErrorResponse": {
-            "type": "object",
-            "properties": {
-                "error": {
-                    "type": "string"
-                }
-            }
-        },
-        "github_com_redeflesq_auth-example_internal_model.SuccessResponse": {
-            "type": "object",
-            "properties": {
-                "success": {
-                    "type": "string"
-                }
-            }
         },
-        "github_com_redeflesq_auth-example_internal_model.TokenRequest": {
+        "/auth/me": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Returns the user ID. Requires valid JWT in Authorization header with the profile scope.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Authentication"
+                ],
+                "summary": "Get current user ID",
+                "responses": {
+                    "200": {
+                        "description": "Successfully retrieved user ID",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.UserIdResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized - invalid or revoked tokens",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Insufficient scope",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/refresh": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Generates new access and refresh tokens pair using valid refresh token and valid JWT from Authorization header.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Authentication"
+                ],
+                "summary": "Refresh authentication tokens",
+                "parameters": [
+                    {
+                        "description": "Refresh token",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.TokenRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "New tokens pair",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.TokenResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request format",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized - invalid or revoked tokens, or reuse of an already rotated refresh token",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/register": {
+            "post": {
+                "description": "Creates a user account for password login on /auth/token. Username is case-insensitive, password must be at least 8 characters",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Authentication"
+                ],
+                "summary": "Register a new user",
+                "parameters": [
+                    {
+                        "description": "Credentials",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.RegisterRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "User created",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.UserIdResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid username or password",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Username already taken",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/sessions": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Returns active sessions of the current user: one entry per sign-in with its current pair_id, device (User-Agent), IP address, sign-in time and last refresh time. Requires valid JWT in Authorization header with the sessions:read scope.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Sessions"
+                ],
+                "summary": "List active sessions",
+                "responses": {
+                    "200": {
+                        "description": "Active sessions",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.SessionsResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized - invalid or revoked tokens",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Insufficient scope",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/sessions/{pair_id}": {
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Signs out one session of the current user by its pair_id from GET /auth/sessions. Revokes all refresh and access tokens of the session. Requires valid JWT in Authorization header with the sessions:write scope.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Sessions"
+                ],
+                "summary": "Revoke a session",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Session pair_id",
+                        "name": "pair_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Session revoked",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.SuccessResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized - invalid or revoked tokens",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Insufficient scope",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Session not found",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/token": {
+            "post": {
+                "description": "Verifies username and password and creates new access and refresh tokens pair for the user. The optional scope requests a subset of the scopes allowed for users (AUTH_USER_SCOPES) and the client, all of them by default. Operators (admin and support roles) may explicitly request the admin scope required by /admin, through a client only if the client is allowed it. In trusted issuer mode (AUTH_TRUSTED_ISSUER=true) a registered API client authenticated with HTTP Basic (client_id:client_secret) or an mTLS certificate may request tokens for any user_id except operator accounts. The client_id is embedded in the access token as azp",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Authentication"
+                ],
+                "summary": "Generate new authentication tokens",
+                "parameters": [
+                    {
+                        "description": "Credentials",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.AuthTokenRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Successfully generated tokens",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.TokenResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request, missing credentials or invalid scope",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid username or password, invalid client or client authentication required",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Trusted issuer request for an operator account",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to generate or save tokens",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/oauth/authorize": {
+            "get": {
+                "description": "GET renders a sign-in form, POST checks username and password and redirects the browser to redirect_uri with a one-time code, state and iss. Only response_type=code with code_challenge_method=S256 is supported. An unknown client_id or a redirect_uri that is not registered for the client is answered with an error page instead of a redirect, other errors are returned to redirect_uri as error and state.",
+                "consumes": [
+                    "application/x-www-form-urlencoded"
+                ],
+                "produces": [
+                    "text/html"
+                ],
+                "tags": [
+                    "OAuth"
+                ],
+                "summary": "Authorization endpoint (RFC 6749, authorization code with PKCE)",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Must be code",
+                        "name": "response_type",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Registered client id",
+                        "name": "client_id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "One of the client's registered redirect URIs, may be omitted if exactly one is registered",
+                        "name": "redirect_uri",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Opaque value returned to the client",
+                        "name": "state",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "BASE64URL(SHA256(code_verifier))",
+                        "name": "code_challenge",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Must be S256",
+                        "name": "code_challenge_method",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Space-separated subset of the allowed scopes, all of them by default",
+                        "name": "scope",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Username, POST only",
+                        "name": "username",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Password, POST only",
+                        "name": "password",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Sign-in form",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "302": {
+                        "description": "Redirect to redirect_uri with code or error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Unknown client or invalid redirect_uri",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid username or password, the form is shown again",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "GET renders a sign-in form, POST checks username and password and redirects the browser to redirect_uri with a one-time code, state and iss. Only response_type=code with code_challenge_method=S256 is supported. An unknown client_id or a redirect_uri that is not registered for the client is answered with an error page instead of a redirect, other errors are returned to redirect_uri as error and state.",
+                "consumes": [
+                    "application/x-www-form-urlencoded"
+                ],
+                "produces": [
+                    "text/html"
+                ],
+                "tags": [
+                    "OAuth"
+                ],
+                "summary": "Authorization endpoint (RFC 6749, authorization code with PKCE)",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Must be code",
+                        "name": "response_type",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Registered client id",
+                        "name": "client_id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "One of the client's registered redirect URIs, may be omitted if exactly one is registered",
+                        "name": "redirect_uri",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Opaque value returned to the client",
+                        "name": "state",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "BASE64URL(SHA256(code_verifier))",
+                        "name": "code_challenge",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Must be S256",
+                        "name": "code_challenge_method",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Space-separated subset of the allowed scopes, all of them by default",
+                        "name": "scope",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Username, POST only",
+                        "name": "username",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Password, POST only",
+                        "name": "password",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Sign-in form",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "302": {
+                        "description": "Redirect to redirect_uri with code or error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Unknown client or invalid redirect_uri",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid username or password, the form is shown again",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/oauth/device": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Returns the client, the requested scope and the device (User-Agent, IP address) that requested the user_code, so the user can check it before approving. Requires valid JWT in Authorization header with the sessions:write scope.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "OAuth"
+                ],
+                "summary": "Show a pending device request",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User code shown on the device, case and dash insensitive",
+                        "name": "user_code",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Pending device request",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.DeviceVerificationResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized - invalid or revoked tokens",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Insufficient scope",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Device code not found",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Approves (approve=true) or denies the device request with the given user_code on behalf of the current user. After approval the device receives a tokens pair for the user on its next poll. Requires valid JWT in Authorization header with the sessions:write scope.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "OAuth"
+                ],
+                "summary": "Approve or deny a device",
+                "parameters": [
+                    {
+                        "description": "User code and decision",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.DeviceVerificationRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Device approved or denied",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.SuccessResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized - invalid or revoked tokens",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Insufficient scope",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Device code not found",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/oauth/device_authorization": {
+            "post": {
+                "description": "Starts sign-in on a device without a browser (TV, CLI). Returns a device_code for polling /oauth/token with grant_type=urn:ietf:params:oauth:grant-type:device_code and a user_code the user confirms at verification_uri from another device. Confidential clients authenticate with HTTP Basic or an mTLS certificate, public clients only send client_id.",
+                "consumes": [
+                    "application/x-www-form-urlencoded"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "OAuth"
+                ],
+                "summary": "Device authorization request (RFC 8628)",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Client id, required for public clients",
+                        "name": "client_id",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Space-separated subset of the allowed scopes, all of them by default. The admin scope is never granted to devices",
+                        "name": "scope",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Device and user codes",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.DeviceAuthorizationResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_request or invalid_scope",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "invalid_client",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "server_error",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/oauth/introspect": {
+            "post": {
+                "description": "Returns whether an access JWT or a base64 refresh token is currently active, and its metadata if it is. Inactive, unknown, expired and revoked tokens all produce {\"active\": false}. The caller must authenticate as a confidential client with HTTP Basic or an mTLS certificate. Access tokens issued for another audience (token exchange) are active only for the client in their aud.",
+                "consumes": [
+                    "application/x-www-form-urlencoded",
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "OAuth"
+                ],
+                "summary": "Token introspection (RFC 7662)",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Access or refresh token",
+                        "name": "token",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "access_token or refresh_token",
+                        "name": "token_type_hint",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Token state",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.IntrospectionResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Missing token",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "invalid_client",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/oauth/revoke": {
+            "post": {
+                "description": "Revokes an access JWT or a refresh token. Revoking a refresh token also revokes the access token issued with it. Does not require an Authorization header, so a client that only holds the refresh token can still sign out. Access tokens issued for other audiences (token exchange) are not revoked, since they share the pair_id of the original session. Unknown or invalid tokens are also answered with 200.",
+                "consumes": [
+                    "application/x-www-form-urlencoded",
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "OAuth"
+                ],
+                "summary": "Token revocation (RFC 7009)",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Access or refresh token",
+                        "name": "token",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "access_token or refresh_token",
+                        "name": "token_type_hint",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Token revoked or was not valid",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.SuccessResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Missing token",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/oauth/token": {
+            "post": {
+                "description": "Exchanges an authorization code for access and refresh tokens, or issues a machine access token to an authenticated client (grant_type=client_credentials, no refresh token, sub is the client_id, token_use is client). Devices poll it with grant_type=urn:ietf:params:oauth:grant-type:device_code and the device_code from /oauth/device_authorization, getting authorization_pending until the user approves and slow_down when polling faster than the interval. A service authenticated as a client exchanges a user's access token (grant_type=urn:ietf:params:oauth:grant-type:token-exchange, RFC 8693) for a token restricted to a registered downstream service in audience, with the caller recorded in act. The exchanged token keeps the subject's pair_id, so it is revoked with the original session, expires no later than the subject token and is not accepted by this service's own endpoints. The code_verifier must match the code_challenge sent to /oauth/authorize (PKCE, S256), client_id and redirect_uri must match the ones the code was issued for. Confidential clients authenticate with HTTP Basic or an mTLS certificate, public clients only send client_id. A code can be used once. Every grant accepts scope to request a subset of the allowed scopes: user scopes limited by the client for user tokens, the client's own scopes for client_credentials and the subject token's scopes for token exchange. client_credentials also accepts audience to issue the token for another registered service.",
+                "consumes": [
+                    "application/x-www-form-urlencoded"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "OAuth"
+                ],
+                "summary": "OAuth2 token endpoint (RFC 6749)",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "authorization_code, client_credentials, urn:ietf:params:oauth:grant-type:device_code or urn:ietf:params:oauth:grant-type:token-exchange",
+                        "name": "grant_type",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Authorization code",
+                        "name": "code",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "redirect_uri used in the authorization request",
+                        "name": "redirect_uri",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "PKCE code verifier",
+                        "name": "code_verifier",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Device code",
+                        "name": "device_code",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Access token to exchange",
+                        "name": "subject_token",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "urn:ietf:params:oauth:token-type:access_token or urn:ietf:params:oauth:token-type:jwt",
+                        "name": "subject_token_type",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "client_id of the downstream service",
+                        "name": "audience",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Space-separated subset of the allowed scopes, all of them by default",
+                        "name": "scope",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Client id, required for public clients",
+                        "name": "client_id",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Issued tokens",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.OAuthTokenResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_request, invalid_grant, unauthorized_client, unsupported_grant_type, authorization_pending, slow_down, access_denied, expired_token, invalid_target or invalid_scope",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "invalid_client",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "server_error",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "github_com_redeflesq_auth-example_internal_model.Actor": {
+            "type": "object",
+            "properties": {
+                "act": {
+                    "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.Actor"
+                },
+                "sub": {
+                    "type": "string"
+                }
+            }
+        },
+        "github_com_redeflesq_auth-example_internal_model.AdminUserResponse": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "roles": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "user_id": {
+                    "type": "string"
+                },
+                "username": {
+                    "type": "string"
+                }
+            }
+        },
+        "github_com_redeflesq_auth-example_internal_model.AuthTokenRequest": {
+            "type": "object",
+            "properties": {
+                "password": {
+                    "type": "string"
+                },
+                "scope": {
+                    "description": "подмножество разрешённых scope через пробел, пустой - все",
+                    "type": "string"
+                },
+                "user_id": {
+                    "type": "string"
+                },
+                "username": {
+                    "type": "string"
+                }
+            }
+        },
+        "github_com_redeflesq_auth-example_internal_model.DeviceAuthorizationResponse": {
+            "type": "object",
+            "properties": {
+                "device_code": {
+                    "type": "string"
+                },
+                "expires_in": {
+                    "type": "integer"
+                },
+                "interval": {
+                    "type": "integer"
+                },
+                "user_code": {
+                    "type": "string"
+                },
+                "verification_uri": {
+                    "type": "string"
+                },
+                "verification_uri_complete": {
+                    "type": "string"
+                }
+            }
+        },
+        "github_com_redeflesq_auth-example_internal_model.DeviceVerificationRequest": {
+            "type": "object",
+            "properties": {
+                "approve": {
+                    "type": "boolean"
+                },
+                "user_code": {
+                    "type": "string"
+                }
+            }
+        },
+        "github_com_redeflesq_auth-example_internal_model.DeviceVerificationResponse": {
+            "type": "object",
+            "properties": {
+                "client_id": {
+                    "type": "string"
+                },
+                "expires_at": {
+                    "type": "string"
+                },
+                "ip_address": {
+                    "type": "string"
+                },
+                "scope": {
+                    "type": "string"
+                },
+                "user_agent": {
+                    "type": "string"
+                },
+                "user_code": {
+                    "type": "string"
+                }
+            }
+        },
+        "github_com_redeflesq_auth-example_internal_model.ErrorResponse": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                }
+            }
+        },
+        "github_com_redeflesq_auth-example_internal_model.IntrospectionResponse": {
+            "type": "object",
+            "properties": {
+                "act": {
+                    "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.Actor"
+                },
+                "active": {
+                    "type": "boolean"
+                },
+                "aud": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "client_id": {
+                    "type": "string"
+                },
+                "exp": {
+                    "type": "integer"
+                },
+                "iat": {
+                    "type": "integer"
+                },
+                "iss": {
+                    "type": "string"
+                },
+                "pair_id": {
+                    "type": "string"
+                },
+                "roles": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "scope": {
+                    "type": "string"
+                },
+                "sub": {
+                    "type": "string"
+                },
+                "token_type": {
+                    "type": "string"
+                },
+                "token_use": {
+                    "type": "string"
+                }
+            }
+        },
+        "github_com_redeflesq_auth-example_internal_model.JWK": {
+            "type": "object",
+            "properties": {
+                "alg": {
+                    "type": "string"
+                },
+                "crv": {
+                    "type": "string"
+                },
+                "e": {
+                    "type": "string"
+                },
+                "kid": {
+                    "type": "string"
+                },
+                "kty": {
+                    "type": "string"
+                },
+                "n": {
+                    "type": "string"
+                },
+                "use": {
+                    "type": "string"
+                },
+                "x": {
+                    "type": "string"
+                },
+                "y": {
+                    "type": "string"
+                }
+            }
+        },
+        "github_com_redeflesq_auth-example_internal_model.JWKSResponse": {
+            "type": "object",
+            "properties": {
+                "keys": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.JWK"
+                    }
+                }
+            }
+        },
+        "github_com_redeflesq_auth-example_internal_model.LogoutAllRequest": {
+            "type": "object",
+            "properties": {
+                "keep_current": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "github_com_redeflesq_auth-example_internal_model.OAuthTokenResponse": {
+            "type": "object",
+            "properties": {
+                "access_token": {
+                    "type": "string"
+                },
+                "expires_in": {
+                    "type": "integer"
+                },
+                "issued_token_type": {
+                    "description": "Для token exchange (RFC 8693, раздел 2.2.1)",
+                    "type": "string"
+                },
+                "refresh_token": {
+                    "type": "string"
+                },
+                "scope": {
+                    "type": "string"
+                },
+                "token_type": {
+                    "type": "string"
+                }
+            }
+        },
+        "github_com_redeflesq_auth-example_internal_model.OpenIDConfigurationResponse": {
+            "type": "object",
+            "properties": {
+                "authorization_endpoint": {
+                    "type": "string"
+                },
+                "claims_supported": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "code_challenge_methods_supported": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "device_authorization_endpoint": {
+                    "type": "string"
+                },
+                "grant_types_supported": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "introspection_endpoint": {
+                    "type": "string"
+                },
+                "issuer": {
+                    "type": "string"
+                },
+                "jwks_uri": {
+                    "type": "string"
+                },
+                "response_types_supported": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "revocation_endpoint": {
+                    "type": "string"
+                },
+                "scopes_supported": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "subject_types_supported": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "token_endpoint": {
+                    "type": "string"
+                },
+                "token_endpoint_auth_methods_supported": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "github_com_redeflesq_auth-example_internal_model.RegisterRequest": {
+            "type": "object",
+            "properties": {
+                "password": {
+                    "type": "string"
+                },
+                "username": {
+                    "type": "string"
+                }
+            }
+        },
+        "github_com_redeflesq_auth-example_internal_model.SessionResponse": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "current": {
+                    "type": "boolean"
+                },
+                "device": {
+                    "type": "string"
+                },
+                "expires_at": {
+                    "type": "string"
+                },
+                "ip_address": {
+                    "type": "string"
+                },
+                "last_used_at": {
+                    "type": "string"
+                },
+                "pair_id": {
+                    "type": "string"
+                }
+            }
+        },
+        "github_com_redeflesq_auth-example_internal_model.SessionsResponse": {
+            "type": "object",
+            "properties": {
+                "sessions": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/github_com_redeflesq_auth-example_internal_model.SessionResponse"
+                    }
+                }
+            }
+        },
+        "github_com_redeflesq_auth-example_internal_model.SuccessResponse": {
+            "type": "object",
+            "properties": {
+                "success": {
+                    "type": "string"
+                }
+            }
+        },
+        "github_com_redeflesq_auth-example_internal_model.TokenRequest": {
             "type": "object",
             "properties": {
                 "refresh_token": {
@@ -221,10 +1736,13 @@ const docTemplate = `{
                 },
                 "refresh_token": {
                     "type": "string"
+                },
+                "scope": {
+                    "type": "string"
                 }
             }
         },
-        "github_com_redeflesq_auth-example_internal_model.UserIdRequest": {
+        "github_com_redeflesq_auth-example_internal_model.UserIdResponse": {
             "type": "object",
             "properties": {
                 "user_id": {
@@ -232,11 +1750,14 @@ const docTemplate = `{
                 }
             }
         },
-        "github_com_redeflesq_auth-example_internal_model.UserIdResponse": {
+        "github_com_redeflesq_auth-example_internal_model.UserRolesRequest": {
             "type": "object",
             "properties": {
-                "user_id": {
-                    "type": "string"
+                "roles": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
                 }
             }
         }
@@ -1,16 +1,23 @@
 package app
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
 
 	"github.com/redeflesq/auth-example/internal/endpoint"
+	"github.com/redeflesq/auth-example/internal/model"
 	"github.com/redeflesq/auth-example/internal/server"
 	"github.com/redeflesq/auth-example/internal/storage"
+	"github.com/redeflesq/auth-example/internal/token"
 
 	_ "github.com/redeflesq/auth-example/docs"
 	httpSwagger "github.com/swaggo/http-swagger"
@@ -20,11 +27,101 @@ func Run() {
 
 	_ = godotenv.Load(".env")
 
-	if err := storage.Init(); err != nil {
-		log.Fatal("Failed to connect to DB:", err)
+	if err := token.Init(); err != nil {
+		log.Fatal("Failed to load JWT keys:", err)
 	}
-	
-	go server.CleanRevokedTokens()
+
+	if url := os.Getenv("CLAIMS_PROVIDER_URL"); url != "" {
+		provider := token.NewHTTPClaimsProvider(url, token.ClaimsProviderTimeout())
+		provider.Names = strings.Fields(os.Getenv("CLAIMS_PROVIDER_CLAIMS"))
+		token.SetClaimsProvider(provider)
+	}
+
+	store, err := storage.New()
+	if err != nil {
+		log.Fatal("Failed to init storage:", err)
+	}
+	defer store.Close()
+
+	if migrator, ok := store.(storage.Migrator); ok {
+		if err = migrator.MigrateUp(); err != nil {
+			log.Fatal("Failed to apply migrations:", err)
+		}
+	}
+
+	if err = bootstrapClient(store); err != nil {
+		log.Fatal("Failed to register API client:", err)
+	}
+
+	if err = bootstrapAdmin(store); err != nil {
+		log.Fatal("Failed to register admin:", err)
+	}
+
+	notifier, notify := store.(storage.RevocationNotifier)
+
+	if storage.RevocationSync() == "notify" && !notify {
+		log.Printf("Storage driver %q does not support REVOCATION_SYNC=notify", os.Getenv("STORAGE_DRIVER"))
+	}
+
+	if storage.RevocationSync() == "notify" && notify {
+
+		// Отозванные пары целиком в памяти, REVOCATION_CACHE_SIZE ограничивает только кэш эпох.
+		// Без кэша эпох TokensValidAfter обращался бы к базе на каждый запрос
+		epochs_size := storage.RevocationCacheSize()
+		if epochs_size == 0 {
+			epochs_size = storage.DefaultEpochCacheSize
+		}
+
+		cached, err := storage.NewCachedStore(store, storage.NewRevokedSet(), epochs_size, token.JWTExpiration(), storage.RevocationCacheTTL())
+		if err != nil {
+			log.Fatal("Failed to init revocation cache:", err)
+		}
+
+		go server.ListenRevocations(notifier, cached)
+
+		// Периодическая перезагрузка удаляет из набора истекшие пары
+		go server.ReloadRevocationCache(cached, time.Hour)
+
+		store = cached
+
+	} else if size := storage.RevocationCacheSize(); size > 0 {
+
+		cached, err := storage.NewCachedStore(store, storage.NewRevocationCache(size), size, token.JWTExpiration(), storage.RevocationCacheTTL())
+		if err != nil {
+			log.Fatal("Failed to init revocation cache:", err)
+		}
+
+		// Фильтр Блума узнаёт об отзывах на других репликах только при перезагрузке
+		if storage.RevocationBloomFilter() {
+			go server.ReloadRevocationCache(cached, storage.RevocationCacheTTL())
+		}
+
+		store = cached
+	}
+
+	go server.CleanRevokedTokens(store)
+
+	if interval := token.KeyRotationInterval(); interval > 0 {
+
+		if _, err = token.KeyEncryptionKey(); err != nil {
+			log.Fatal("Failed to start key rotation:", err)
+		}
+
+		go server.RotateSigningKeys(store, interval)
+	}
+
+	handler := endpoint.New(store)
+	auth := server.AuthMiddleware(store)
+
+	// Маршруты сессий требуют соответствующих scope, logout доступен любому токену пользователя
+	profile := server.RequireScopes(store, token.ScopeProfile)
+	sessions_read := server.RequireScopes(store, token.ScopeSessionsRead)
+	sessions_write := server.RequireScopes(store, token.ScopeSessionsWrite)
+
+	// Операторы: support просматривает и завершает отдельные сессии, admin дополнительно выходит за пользователя и меняет роли.
+	// Кроме роли нужен scope admin, который выдаётся только по явному запросу
+	operator := server.RequireRoles(store, token.ScopeAdmin, model.RoleAdmin, model.RoleSupport)
+	admin := server.RequireRoles(store, token.ScopeAdmin, model.RoleAdmin)
 
 	router := mux.NewRouter()
 
@@ -36,14 +133,71 @@ func Run() {
 		}),
 	))
 
-	router.HandleFunc("/auth/token", endpoint.AuthToken).Methods("POST")
-	router.HandleFunc("/auth/refresh", endpoint.AuthRefresh).Methods("POST")
-	router.Handle("/auth/me", server.AuthMiddleware(http.HandlerFunc(endpoint.AuthMe))).Methods("GET")
-	router.Handle("/auth/logout", server.AuthMiddleware(http.HandlerFunc(endpoint.AuthLogout))).Methods("POST")
+	handler.Router = router
+
+	router.HandleFunc("/.well-known/jwks.json", handler.JWKS).Methods("GET").Name(endpoint.RouteJWKS)
+	router.HandleFunc("/.well-known/openid-configuration", handler.OpenIDConfiguration).Methods("GET")
+
+	router.HandleFunc("/auth/token", handler.AuthToken).Methods("POST")
+	router.HandleFunc("/auth/register", handler.AuthRegister).Methods("POST")
+	router.HandleFunc("/auth/refresh", handler.AuthRefresh).Methods("POST")
+	router.Handle("/auth/me", profile(http.HandlerFunc(handler.AuthMe))).Methods("GET")
+	router.Handle("/auth/logout", auth(http.HandlerFunc(handler.AuthLogout))).Methods("POST")
+	router.Handle("/auth/logout-all", sessions_write(http.HandlerFunc(handler.AuthLogoutAll))).Methods("POST")
+	router.Handle("/auth/sessions", sessions_read(http.HandlerFunc(handler.AuthSessions))).Methods("GET")
+	router.Handle("/auth/sessions/{pair_id}", sessions_write(http.HandlerFunc(handler.AuthSessionRevoke))).Methods("DELETE")
+
+	router.HandleFunc("/oauth/authorize", handler.OAuthAuthorize).Methods("GET", "POST").Name(endpoint.RouteAuthorization)
+	router.HandleFunc("/oauth/token", handler.OAuthToken).Methods("POST").Name(endpoint.RouteToken)
+	router.HandleFunc("/oauth/device_authorization", handler.OAuthDeviceAuthorization).Methods("POST").Name(endpoint.RouteDeviceAuthorization)
+	router.Handle("/oauth/device", sessions_write(http.HandlerFunc(handler.OAuthDevice))).Methods("GET").Name(endpoint.RouteDeviceVerification)
+	router.Handle("/oauth/device", sessions_write(http.HandlerFunc(handler.OAuthDeviceVerify))).Methods("POST")
+	router.HandleFunc("/oauth/introspect", handler.OAuthIntrospect).Methods("POST").Name(endpoint.RouteIntrospection)
+	router.HandleFunc("/oauth/revoke", handler.OAuthRevoke).Methods("POST").Name(endpoint.RouteRevocation)
+
+	router.Handle("/admin/users", operator(http.HandlerFunc(handler.AdminUser))).Methods("GET")
+	router.Handle("/admin/users/{user_id}/sessions", operator(http.HandlerFunc(handler.AdminUserSessions))).Methods("GET")
+	router.Handle("/admin/users/{user_id}/sessions/{pair_id}", operator(http.HandlerFunc(handler.AdminUserSessionRevoke))).Methods("DELETE")
+	router.Handle("/admin/users/{user_id}/logout", admin(http.HandlerFunc(handler.AdminUserLogout))).Methods("POST")
+	router.Handle("/admin/users/{user_id}/roles", admin(http.HandlerFunc(handler.AdminUserRoles))).Methods("PUT")
 
 	app_port := os.Getenv("APP_PORT")
 
 	log.Printf("Server running on port :%s", app_port)
 
+	// С TLS_CERT_FILE сервис принимает HTTPS и, если задан TLS_CLIENT_CA_FILE, проверяет клиентские сертификаты
+	if cert_file := os.Getenv("TLS_CERT_FILE"); cert_file != "" {
+
+		tls_config, err := clientTLSConfig(os.Getenv("TLS_CLIENT_CA_FILE"))
+		if err != nil {
+			log.Fatal("Failed to load TLS client CA:", err)
+		}
+
+		srv := &http.Server{Addr: ":" + app_port, Handler: router, TLSConfig: tls_config}
+
+		log.Fatal(srv.ListenAndServeTLS(cert_file, os.Getenv("TLS_KEY_FILE")))
+	}
+
 	log.Fatal(http.ListenAndServe(":"+app_port, router))
 }
+
+// clientTLSConfig запрашивает у клиентов сертификат, но не требует его:
+// без сертификата клиент может аутентифицироваться секретом
+func clientTLSConfig(ca_file string) (*tls.Config, error) {
+
+	if ca_file == "" {
+		return &tls.Config{}, nil
+	}
+
+	ca_pem, err := os.ReadFile(ca_file)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca_pem) {
+		return nil, fmt.Errorf("no certificates found in %s", ca_file)
+	}
+
+	return &tls.Config{ClientAuth: tls.VerifyClientCertIfGiven, ClientCAs: pool}, nil
+}
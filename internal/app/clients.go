@@ -0,0 +1,149 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+
+	"github.com/redeflesq/auth-example/internal/password"
+	"github.com/redeflesq/auth-example/internal/storage"
+)
+
+const clientsUsage = "usage: client add <client_id> [redirect_uri...] | add-cert <client_id> <subject DN> [redirect_uri...] | add-public <client_id> <redirect_uri...> | scopes <client_id> [scope...] | list | remove <client_id>"
+
+// Clients управляет API клиентами из командной строки. Секрет показывается
+// только при создании, в хранилище остаётся его хеш
+func Clients(args []string) {
+
+	_ = godotenv.Load(".env")
+
+	if len(args) < 1 {
+		log.Fatal(clientsUsage)
+	}
+
+	store, err := storage.New()
+	if err != nil {
+		log.Fatal("Failed to init storage:", err)
+	}
+	defer store.Close()
+
+	if migrator, ok := store.(storage.Migrator); ok {
+		if err = migrator.MigrateUp(); err != nil {
+			log.Fatal("Failed to apply migrations:", err)
+		}
+	}
+
+	switch {
+	case args[0] == "add" && len(args) >= 2:
+
+		var secret string
+		if secret, err = password.GenerateSecret(); err != nil {
+			break
+		}
+
+		err = addClient(store, storage.Client{ID: args[1], SecretHash: password.HashSecret(secret), RedirectURIs: args[2:], CreatedAt: time.Now()})
+		if err == nil {
+			fmt.Printf("client_id:     %s\nclient_secret: %s\n", args[1], secret)
+		}
+
+	case args[0] == "add-cert" && len(args) >= 3:
+		err = addClient(store, storage.Client{ID: args[1], CertSubject: args[2], RedirectURIs: args[3:], CreatedAt: time.Now()})
+
+	// Публичный клиент без секрета может только обменивать коды авторизации с PKCE
+	case args[0] == "add-public" && len(args) >= 3:
+		err = addClient(store, storage.Client{ID: args[1], RedirectURIs: args[2:], CreatedAt: time.Now()})
+
+	// Заменяет scope клиента. Без scope токены пользователей через клиента не ограничены,
+	// а машинные токены выдаются с пустым scope
+	case args[0] == "scopes" && len(args) >= 2:
+
+		var client storage.Client
+		if client, err = store.FindClient(args[1]); err != nil {
+			break
+		}
+
+		client.Scopes = args[2:]
+		err = store.SaveClient(client)
+
+	case args[0] == "list" && len(args) == 1:
+
+		var list []storage.Client
+		list, err = store.ListClients()
+
+		for _, client := range list {
+
+			auth := "client_secret"
+			if client.CertSubject != "" {
+				auth = "mTLS " + client.CertSubject
+			} else if client.IsPublic() {
+				auth = "public"
+			}
+
+			fmt.Printf("%-30s %s  %s  %s  [%s]\n", client.ID, client.CreatedAt.Format("2006-01-02 15:04:05"), auth,
+				strings.Join(client.RedirectURIs, " "), strings.Join(client.Scopes, " "))
+		}
+
+	case args[0] == "remove" && len(args) == 2:
+		err = store.DeleteClient(args[1])
+
+	default:
+		log.Fatal(clientsUsage)
+	}
+
+	if err != nil {
+		log.Fatal("Client command failed: ", err)
+	}
+}
+
+// addClient регистрирует нового клиента. SaveClient заменяет существующего целиком,
+// а сброс его scope снял бы ограничения с токенов, поэтому занятый client_id - ошибка
+func addClient(store storage.Store, client storage.Client) error {
+
+	_, err := store.FindClient(client.ID)
+
+	if err == nil {
+		return fmt.Errorf("client %q already exists, remove it first", client.ID)
+	}
+
+	if !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+
+	return store.SaveClient(client)
+}
+
+// bootstrapClient регистрирует клиента из AUTH_CLIENT_ID / AUTH_CLIENT_SECRET,
+// AUTH_CLIENT_REDIRECT_URIS и AUTH_CLIENT_SCOPES, если такого клиента ещё нет,
+// чтобы dev окружение и тесты работали без ручной регистрации
+func bootstrapClient(store storage.Store) error {
+
+	client_id, secret := os.Getenv("AUTH_CLIENT_ID"), os.Getenv("AUTH_CLIENT_SECRET")
+
+	if client_id == "" || secret == "" {
+		return nil
+	}
+
+	if len(secret) < password.MinSecretLength {
+		return fmt.Errorf("AUTH_CLIENT_SECRET must be at least %d characters", password.MinSecretLength)
+	}
+
+	// Существующий клиент не меняется, как и в addClient: секрет и scope могли быть изменены после первого запуска
+	_, err := store.FindClient(client_id)
+
+	if err == nil || !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+
+	return store.SaveClient(storage.Client{
+		ID:           client_id,
+		SecretHash:   password.HashSecret(secret),
+		RedirectURIs: strings.Fields(os.Getenv("AUTH_CLIENT_REDIRECT_URIS")),
+		Scopes:       strings.Fields(os.Getenv("AUTH_CLIENT_SCOPES")),
+		CreatedAt:    time.Now(),
+	})
+}
@@ -0,0 +1,88 @@
+package app
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redeflesq/auth-example/internal/password"
+	"github.com/redeflesq/auth-example/internal/storage"
+)
+
+func TestAddClientKeepsExisting(t *testing.T) {
+
+	store := storage.NewMemoryStore()
+
+	existing := storage.Client{ID: "billing", SecretHash: password.HashSecret("secret"), Scopes: []string{"orders:read"}, CreatedAt: time.Now()}
+
+	if err := addClient(store, existing); err != nil {
+		t.Fatal(err)
+	}
+
+	// Повторная регистрация с новым секретом и без scope не должна расширить права клиента
+	if err := addClient(store, storage.Client{ID: "billing", SecretHash: password.HashSecret("other"), CreatedAt: time.Now()}); err == nil {
+		t.Fatal("existing client replaced")
+	}
+
+	if err := addClient(store, storage.Client{ID: "billing", CertSubject: "CN=billing", CreatedAt: time.Now()}); err == nil {
+		t.Fatal("existing client replaced with a certificate client")
+	}
+
+	client, err := store.FindClient("billing")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if client.SecretHash != existing.SecretHash || client.CertSubject != "" || !slices.Equal(client.Scopes, existing.Scopes) {
+		t.Fatalf("client changed: %+v", client)
+	}
+}
+
+func TestBootstrapClientKeepsExisting(t *testing.T) {
+
+	store := storage.NewMemoryStore()
+
+	first_secret := strings.Repeat("a", password.MinSecretLength)
+
+	t.Setenv("AUTH_CLIENT_ID", "test-client")
+	t.Setenv("AUTH_CLIENT_SECRET", first_secret)
+	t.Setenv("AUTH_CLIENT_SCOPES", "profile")
+
+	if err := bootstrapClient(store); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("AUTH_CLIENT_SECRET", strings.Repeat("b", password.MinSecretLength))
+	t.Setenv("AUTH_CLIENT_SCOPES", "profile orders:read")
+
+	if err := bootstrapClient(store); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := store.FindClient("test-client")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !password.VerifySecret(first_secret, client.SecretHash) || !slices.Equal(client.Scopes, []string{"profile"}) {
+		t.Fatalf("bootstrap client overwritten: %+v", client)
+	}
+}
+
+func TestBootstrapClientRejectsShortSecret(t *testing.T) {
+
+	store := storage.NewMemoryStore()
+
+	t.Setenv("AUTH_CLIENT_ID", "test-client")
+	t.Setenv("AUTH_CLIENT_SECRET", "test-client-secret")
+
+	if err := bootstrapClient(store); err == nil {
+		t.Fatal("short client secret accepted")
+	}
+
+	if _, err := store.FindClient("test-client"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("client registered with a short secret: %v", err)
+	}
+}
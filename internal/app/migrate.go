@@ -0,0 +1,67 @@
+package app
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/joho/godotenv"
+
+	"github.com/redeflesq/auth-example/internal/storage"
+)
+
+const migrateUsage = "usage: migrate up | down [steps] | status"
+
+func Migrate(args []string) {
+
+	_ = godotenv.Load(".env")
+
+	if len(args) < 1 {
+		log.Fatal(migrateUsage)
+	}
+
+	store, err := storage.New()
+	if err != nil {
+		log.Fatal("Failed to init storage:", err)
+	}
+	defer store.Close()
+
+	migrator, ok := store.(storage.Migrator)
+	if !ok {
+		log.Fatalf("Storage driver %q does not support migrations", os.Getenv("STORAGE_DRIVER"))
+	}
+
+	switch args[0] {
+	case "up":
+		err = migrator.MigrateUp()
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				log.Fatal(migrateUsage)
+			}
+		}
+		err = migrator.MigrateDown(steps)
+
+	case "status":
+		var list []storage.MigrationStatus
+		list, err = migrator.MigrationStatus()
+		for _, migration := range list {
+			applied_at := "pending"
+			if migration.Applied {
+				applied_at = migration.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-30s %s\n", migration.Version, migration.Name, applied_at)
+		}
+
+	default:
+		log.Fatal(migrateUsage)
+	}
+
+	if err != nil {
+		log.Fatal("Migration failed: ", err)
+	}
+}
@@ -0,0 +1,110 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/joho/godotenv"
+
+	"github.com/redeflesq/auth-example/internal/endpoint"
+	"github.com/redeflesq/auth-example/internal/model"
+	"github.com/redeflesq/auth-example/internal/password"
+	"github.com/redeflesq/auth-example/internal/storage"
+	"github.com/redeflesq/auth-example/internal/token"
+)
+
+const usersUsage = "usage: user show <username> | roles <username> <role...>"
+
+// Users показывает и меняет роли пользователей из командной строки, в том числе
+// назначает первого администратора
+func Users(args []string) {
+
+	_ = godotenv.Load(".env")
+
+	if len(args) < 2 {
+		log.Fatal(usersUsage)
+	}
+
+	store, err := storage.New()
+	if err != nil {
+		log.Fatal("Failed to init storage:", err)
+	}
+	defer store.Close()
+
+	if migrator, ok := store.(storage.Migrator); ok {
+		if err = migrator.MigrateUp(); err != nil {
+			log.Fatal("Failed to apply migrations:", err)
+		}
+	}
+
+	user, err := store.FindUserByUsername(endpoint.NormalizeUsername(args[1]))
+	if err != nil {
+		log.Fatal("Failed to find user: ", err)
+	}
+
+	switch {
+	case args[0] == "show" && len(args) == 2:
+		fmt.Printf("user_id:    %s\nusername:   %s\nroles:      %s\ncreated_at: %s\n",
+			user.ID, user.Username, strings.Join(user.Roles, " "), user.CreatedAt.Format("2006-01-02 15:04:05"))
+
+	// Выданные токены несут прежние роли, поэтому сессии пользователя завершаются
+	case args[0] == "roles" && len(args) >= 3:
+
+		for _, role := range args[2:] {
+			if !model.IsRole(role) {
+				log.Fatalf("Unknown role %q, expected %s, %s or %s", role, model.RoleUser, model.RoleAdmin, model.RoleSupport)
+			}
+		}
+
+		if err = store.SetUserRoles(user.ID, args[2:]); err == nil {
+			err = store.InvalidateUserTokens(user.ID, token.JWTExpiration())
+		}
+
+	default:
+		log.Fatal(usersUsage)
+	}
+
+	if err != nil {
+		log.Fatal("User command failed: ", err)
+	}
+}
+
+// bootstrapAdmin создаёт администратора из AUTH_ADMIN_USERNAME / AUTH_ADMIN_PASSWORD, если такого
+// пользователя ещё нет, чтобы dev окружение и тесты работали без ручного назначения ролей
+func bootstrapAdmin(store storage.Store) error {
+
+	username, admin_password := endpoint.NormalizeUsername(os.Getenv("AUTH_ADMIN_USERNAME")), os.Getenv("AUTH_ADMIN_PASSWORD")
+
+	if username == "" || admin_password == "" {
+		return nil
+	}
+
+	if len([]rune(admin_password)) < password.MinLength {
+		return errors.New("AUTH_ADMIN_PASSWORD is too short")
+	}
+
+	password_hash, err := password.Hash(admin_password)
+	if err != nil {
+		return err
+	}
+
+	err = store.CreateUser(storage.User{
+		ID:           uuid.NewString(),
+		Username:     username,
+		PasswordHash: password_hash,
+		Roles:        []string{model.RoleUser, model.RoleAdmin},
+		CreatedAt:    time.Now(),
+	})
+
+	// Существующая учётная запись не меняется: пароль и роли могли быть изменены после первого запуска
+	if errors.Is(err, storage.ErrUserExists) {
+		return nil
+	}
+
+	return err
+}
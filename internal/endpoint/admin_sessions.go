@@ -0,0 +1,126 @@
+package endpoint
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/redeflesq/auth-example/internal/model"
+	"github.com/redeflesq/auth-example/internal/server"
+	"github.com/redeflesq/auth-example/internal/token"
+)
+
+// AdminUserSessions godoc
+// @Summary List sessions of a user
+// @Description Returns active sessions of any user in the same format as GET /auth/sessions. Requires valid JWT in Authorization header with the admin or support role and the admin scope.
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Param user_id path string true "User id"
+// @Success 200 {object} model.SessionsResponse "Active sessions"
+// @Failure 401 {object} model.ErrorResponse "Unauthorized - invalid or revoked tokens"
+// @Failure 403 {object} model.ErrorResponse "Insufficient role or scope"
+// @Failure 500 {object} model.ErrorResponse "Internal server error"
+// @Router /admin/users/{user_id}/sessions [get]
+// @Example response 200
+//
+//	{
+//	  "sessions": [
+//	    {
+//	      "pair_id": "5b0f9a3e-2c4d-4b7a-9f10-3c2e8d1a7b64",
+//	      "device": "Mozilla/5.0 (X11; Linux x86_64) Firefox/128.0",
+//	      "ip_address": "203.0.113.7",
+//	      "created_at": "2025-07-01T10:00:00Z",
+//	      "last_used_at": "2025-07-05T18:30:00Z",
+//	      "expires_at": "2025-08-04T18:30:00Z",
+//	      "current": false
+//	    }
+//	  ]
+//	}
+func (h *Handler) AdminUserSessions(writer http.ResponseWriter, req *http.Request) {
+
+	sessions, err := h.Store.ListSessions(mux.Vars(req)["user_id"])
+	if err != nil {
+		log.Println(err)
+		server.SetResponse(writer, http.StatusInternalServerError, model.ErrorResponse{Error: "Failed to list sessions"})
+		return
+	}
+
+	// Сессия оператора не может быть среди сессий другого пользователя, текущей нет
+	server.SetResponse(writer, http.StatusOK, sessionsResponse(sessions, ""))
+}
+
+// AdminUserSessionRevoke godoc
+// @Summary Revoke a session of a user
+// @Description Signs out one session of any user by its pair_id from GET /admin/users/{user_id}/sessions. Revokes all refresh and access tokens of the session. Requires valid JWT in Authorization header with the admin or support role and the admin scope.
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Param user_id path string true "User id"
+// @Param pair_id path string true "Session pair_id"
+// @Success 200 {object} model.SuccessResponse "Session revoked"
+// @Failure 401 {object} model.ErrorResponse "Unauthorized - invalid or revoked tokens"
+// @Failure 403 {object} model.ErrorResponse "Insufficient role or scope"
+// @Failure 404 {object} model.ErrorResponse "Session not found"
+// @Failure 500 {object} model.ErrorResponse "Internal server error"
+// @Router /admin/users/{user_id}/sessions/{pair_id} [delete]
+// @Example response 200
+//
+//	{
+//	  "success": "Session revoked"
+//	}
+func (h *Handler) AdminUserSessionRevoke(writer http.ResponseWriter, req *http.Request) {
+
+	claims, ok := req.Context().Value("claims").(*model.Claims)
+
+	if !ok {
+		server.SetResponse(writer, http.StatusUnauthorized, model.ErrorResponse{Error: "Authorization required"})
+		return
+	}
+
+	vars := mux.Vars(req)
+
+	log.Printf("User %s revokes session %s of user %s", claims.UserID, vars["pair_id"], vars["user_id"])
+
+	h.revokeSession(writer, vars["user_id"], vars["pair_id"])
+}
+
+// AdminUserLogout godoc
+// @Summary Force logout of a user
+// @Description Revokes refresh and access tokens of all sessions of any user, takes effect immediately. Works for users without an account (AUTH_TRUSTED_ISSUER) as well. Requires valid JWT in Authorization header with the admin role and the admin scope.
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Param user_id path string true "User id"
+// @Success 200 {object} model.SuccessResponse "Sessions revoked"
+// @Failure 401 {object} model.ErrorResponse "Unauthorized - invalid or revoked tokens"
+// @Failure 403 {object} model.ErrorResponse "Insufficient role or scope"
+// @Failure 500 {object} model.ErrorResponse "Internal server error"
+// @Router /admin/users/{user_id}/logout [post]
+// @Example response 200
+//
+//	{
+//	  "success": "User logged out from all sessions"
+//	}
+func (h *Handler) AdminUserLogout(writer http.ResponseWriter, req *http.Request) {
+
+	claims, ok := req.Context().Value("claims").(*model.Claims)
+
+	if !ok {
+		server.SetResponse(writer, http.StatusUnauthorized, model.ErrorResponse{Error: "Authorization required"})
+		return
+	}
+
+	user_id := mux.Vars(req)["user_id"]
+
+	log.Printf("User %s logs out user %s from all sessions", claims.UserID, user_id)
+
+	if err := h.Store.InvalidateUserTokens(user_id, token.JWTExpiration()); err != nil {
+		log.Println(err)
+		server.SetResponse(writer, http.StatusInternalServerError, model.ErrorResponse{Error: "Failed to revoke sessions"})
+		return
+	}
+
+	server.SetResponse(writer, http.StatusOK, model.SuccessResponse{Success: "User logged out from all sessions"})
+}
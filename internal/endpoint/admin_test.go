@@ -0,0 +1,163 @@
+package endpoint_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/redeflesq/auth-example/internal/model"
+	"github.com/redeflesq/auth-example/internal/password"
+	"github.com/redeflesq/auth-example/internal/storage"
+)
+
+// createOperator создаёт учётную запись с ролями и возвращает её user_id
+func createOperator(t *testing.T, store storage.Store, username string, roles ...string) string {
+
+	t.Helper()
+
+	password_hash, err := password.Hash(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user_id := uuid.NewString()
+
+	err = store.CreateUser(storage.User{ID: user_id, Username: username, PasswordHash: password_hash, Roles: roles, CreatedAt: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return user_id
+}
+
+func operatorToken(t *testing.T, srv *httptest.Server, username, scope string) (string, string) {
+
+	t.Helper()
+
+	status, tokens := call(t, srv, "POST", "/auth/token", "", map[string]string{"username": username, "password": testPassword, "scope": scope})
+	if status != http.StatusOK {
+		t.Fatalf("token: status %d, %v", status, tokens)
+	}
+
+	scope, _ = tokens["scope"].(string)
+
+	return tokens["access_token"].(string), scope
+}
+
+func TestAdminRoutesRequireAdminScope(t *testing.T) {
+
+	srv, store := newTestServer(t)
+
+	createOperator(t, store, "root", model.RoleUser, model.RoleAdmin)
+
+	// Без явного запроса scope admin не выдаётся, и одной роли недостаточно
+	access_token, scope := operatorToken(t, srv, "root", "")
+	if scope == "" || strings.Contains(scope, "admin") {
+		t.Fatalf("default scope %q", scope)
+	}
+
+	status, response := call(t, srv, "GET", "/admin/users?username=root", access_token, nil)
+	if status != http.StatusForbidden || response["error"] != "Insufficient scope" {
+		t.Fatalf("without the admin scope: status %d, %v", status, response)
+	}
+
+	access_token, scope = operatorToken(t, srv, "root", "profile admin")
+	if scope != "profile admin" {
+		t.Fatalf("requested scope %q", scope)
+	}
+
+	if status, response = call(t, srv, "GET", "/admin/users?username=root", access_token, nil); status != http.StatusOK {
+		t.Fatalf("with the admin scope: status %d, %v", status, response)
+	}
+}
+
+func TestAdminScopeRequiresOperatorRole(t *testing.T) {
+
+	srv, _ := newTestServer(t)
+
+	signIn(t, srv, "alice")
+
+	access_token, scope := operatorToken(t, srv, "alice", "profile admin")
+	if scope != "profile" {
+		t.Fatalf("user without an operator role got scope %q", scope)
+	}
+
+	status, response := call(t, srv, "GET", "/admin/users?username=alice", access_token, nil)
+	if status != http.StatusForbidden || response["error"] != "Insufficient role" {
+		t.Fatalf("status %d, %v", status, response)
+	}
+}
+
+func TestAdminUserSessionsHasNoCurrent(t *testing.T) {
+
+	srv, store := newTestServer(t)
+
+	createOperator(t, store, "support", model.RoleUser, model.RoleSupport)
+	user_id, _, _ := signIn(t, srv, "alice")
+
+	access_token, _ := operatorToken(t, srv, "support", "admin")
+
+	status, response := call(t, srv, "GET", "/admin/users/"+user_id+"/sessions", access_token, nil)
+	if status != http.StatusOK {
+		t.Fatalf("status %d, %v", status, response)
+	}
+
+	sessions := response["sessions"].([]any)
+	if len(sessions) != 1 || sessions[0].(map[string]any)["current"] == true {
+		t.Fatalf("sessions %v, want one session that is not current", sessions)
+	}
+}
+
+func TestTrustedIssuerRefusesOperators(t *testing.T) {
+
+	t.Setenv("AUTH_TRUSTED_ISSUER", "true")
+
+	srv, store := newTestServer(t)
+
+	err := store.SaveClient(storage.Client{ID: testClientID, SecretHash: password.HashSecret(testClientSecret), CreatedAt: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	admin_id := createOperator(t, store, "root", model.RoleUser, model.RoleAdmin)
+	user_id, _, _ := signIn(t, srv, "alice")
+
+	trusted := func(user_id string) (int, map[string]any) {
+
+		body, _ := json.Marshal(map[string]string{"user_id": user_id, "scope": "admin"})
+
+		req, err := http.NewRequest("POST", srv.URL+"/auth/token", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.SetBasicAuth(testClientID, testClientSecret)
+
+		response, err := srv.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+
+		var result map[string]any
+		if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+			t.Fatal(err)
+		}
+
+		return response.StatusCode, result
+	}
+
+	if status, response := trusted(admin_id); status != http.StatusForbidden {
+		t.Fatalf("admin token minted through the trusted client: status %d, %v", status, response)
+	}
+
+	// Обычному пользователю через клиента без scope admin он недоступен
+	if status, response := trusted(user_id); status != http.StatusBadRequest || response["error"] != "Invalid scope" {
+		t.Fatalf("admin scope through a client: status %d, %v", status, response)
+	}
+}
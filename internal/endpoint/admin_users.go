@@ -0,0 +1,129 @@
+package endpoint
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/redeflesq/auth-example/internal/model"
+	"github.com/redeflesq/auth-example/internal/server"
+	"github.com/redeflesq/auth-example/internal/storage"
+	"github.com/redeflesq/auth-example/internal/token"
+)
+
+// AdminUser godoc
+// @Summary Find a user by username
+// @Description Returns the account with the given username, its user_id is used by the other /admin routes. Requires valid JWT in Authorization header with the admin or support role and the admin scope.
+// @Tags Admin
+// @Security BearerAuth
+// @Produce json
+// @Param username query string true "Username, case insensitive"
+// @Success 200 {object} model.AdminUserResponse "User account"
+// @Failure 401 {object} model.ErrorResponse "Unauthorized - invalid or revoked tokens"
+// @Failure 403 {object} model.ErrorResponse "Insufficient role or scope"
+// @Failure 404 {object} model.ErrorResponse "User not found"
+// @Failure 500 {object} model.ErrorResponse "Internal server error"
+// @Router /admin/users [get]
+// @Example response 200
+//
+//	{
+//	  "user_id": "5f0c4b1e-6a3d-4f7e-9a5c-2b8d7e1f0a9c",
+//	  "username": "alice",
+//	  "roles": ["user", "support"],
+//	  "created_at": "2025-07-01T10:00:00Z"
+//	}
+func (h *Handler) AdminUser(writer http.ResponseWriter, req *http.Request) {
+
+	user, err := h.Store.FindUserByUsername(NormalizeUsername(req.URL.Query().Get("username")))
+	if errors.Is(err, storage.ErrNotFound) {
+		server.SetResponse(writer, http.StatusNotFound, model.ErrorResponse{Error: "User not found"})
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		server.SetResponse(writer, http.StatusInternalServerError, model.ErrorResponse{Error: "Failed to find user"})
+		return
+	}
+
+	server.SetResponse(writer, http.StatusOK, model.AdminUserResponse{
+		UserID:    user.ID,
+		Username:  user.Username,
+		Roles:     user.Roles,
+		CreatedAt: user.CreatedAt,
+	})
+}
+
+// AdminUserRoles godoc
+// @Summary Set roles of a user
+// @Description Replaces the roles of a user (user, admin, support). Tokens carry roles from the moment they were issued, so all sessions of the user are revoked and the new roles apply after the next sign-in. Requires valid JWT in Authorization header with the admin role and the admin scope.
+// @Tags Admin
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param user_id path string true "User id"
+// @Param request body model.UserRolesRequest true "New roles"
+// @Success 200 {object} model.SuccessResponse "Roles updated"
+// @Failure 400 {object} model.ErrorResponse "Invalid request or unknown role"
+// @Failure 401 {object} model.ErrorResponse "Unauthorized - invalid or revoked tokens"
+// @Failure 403 {object} model.ErrorResponse "Insufficient role or scope"
+// @Failure 404 {object} model.ErrorResponse "User not found"
+// @Failure 500 {object} model.ErrorResponse "Internal server error"
+// @Router /admin/users/{user_id}/roles [put]
+// @Example request
+//
+//	{
+//	  "roles": ["user", "support"]
+//	}
+//
+// @Example response 200
+//
+//	{
+//	  "success": "Roles updated"
+//	}
+func (h *Handler) AdminUserRoles(writer http.ResponseWriter, req *http.Request) {
+
+	claims, ok := req.Context().Value("claims").(*model.Claims)
+
+	if !ok {
+		server.SetResponse(writer, http.StatusUnauthorized, model.ErrorResponse{Error: "Authorization required"})
+		return
+	}
+
+	var freq model.UserRolesRequest
+	if err := json.NewDecoder(req.Body).Decode(&freq); err != nil || len(freq.Roles) == 0 {
+		server.SetResponse(writer, http.StatusBadRequest, model.ErrorResponse{Error: "Invalid request"})
+		return
+	}
+
+	for _, role := range freq.Roles {
+		if !model.IsRole(role) {
+			server.SetResponse(writer, http.StatusBadRequest, model.ErrorResponse{Error: "Unknown role"})
+			return
+		}
+	}
+
+	user_id := mux.Vars(req)["user_id"]
+
+	err := h.Store.SetUserRoles(user_id, freq.Roles)
+	if errors.Is(err, storage.ErrNotFound) {
+		server.SetResponse(writer, http.StatusNotFound, model.ErrorResponse{Error: "User not found"})
+		return
+	}
+	if err == nil {
+		// Выданные токены несут прежние роли
+		err = h.Store.InvalidateUserTokens(user_id, token.JWTExpiration())
+	}
+	if err != nil {
+		log.Println(err)
+		server.SetResponse(writer, http.StatusInternalServerError, model.ErrorResponse{Error: "Failed to update roles"})
+		return
+	}
+
+	log.Printf("User %s sets roles of user %s to %s", claims.UserID, user_id, strings.Join(freq.Roles, " "))
+
+	server.SetResponse(writer, http.StatusOK, model.SuccessResponse{Success: "Roles updated"})
+}
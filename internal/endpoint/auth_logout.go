@@ -5,7 +5,6 @@ import (
 
 	"github.com/redeflesq/auth-example/internal/model"
 	"github.com/redeflesq/auth-example/internal/server"
-	"github.com/redeflesq/auth-example/internal/storage"
 )
 
 // AuthLogout godoc
@@ -35,7 +34,7 @@ import (
 //	{
 //	  "error": "Failed to revoke access token"
 //	}
-func AuthLogout(writer http.ResponseWriter, req *http.Request) {
+func (h *Handler) AuthLogout(writer http.ResponseWriter, req *http.Request) {
 
 	claims, ok := req.Context().Value("claims").(*model.Claims)
 
@@ -46,13 +45,13 @@ func AuthLogout(writer http.ResponseWriter, req *http.Request) {
 
 	var err error
 
-	err = storage.RevokeAccessToken(claims.PairID, claims.ExpiresAt.Time)
+	err = h.Store.RevokeAccessToken(claims.PairID, claims.ExpiresAt.Time)
 	if err != nil {
 		server.SetResponse(writer, http.StatusInternalServerError, model.ErrorResponse{Error: "Failed to revoke access token"})
 		return
 	}
 
-	err = storage.RevokeRefreshTokens(claims.PairID)
+	err = h.Store.RevokeRefreshTokens(claims.PairID)
 	if err != nil {
 		server.SetResponse(writer, http.StatusInternalServerError, model.ErrorResponse{Error: "Failed to revoke refresh token"})
 		return
@@ -0,0 +1,90 @@
+package endpoint
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/redeflesq/auth-example/internal/model"
+	"github.com/redeflesq/auth-example/internal/server"
+	"github.com/redeflesq/auth-example/internal/storage"
+	"github.com/redeflesq/auth-example/internal/token"
+)
+
+// AuthLogoutAll godoc
+// @Summary Sign out everywhere
+// @Description Revokes refresh and access tokens of all sessions of the current user, takes effect immediately. With keep_current the calling session stays signed in. Requires valid JWT in Authorization header with the sessions:write scope.
+// @Tags Sessions
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param request body model.LogoutAllRequest false "Options"
+// @Success 200 {object} model.SuccessResponse "Sessions revoked"
+// @Failure 400 {object} model.ErrorResponse "Invalid request format"
+// @Failure 401 {object} model.ErrorResponse "Unauthorized - invalid or revoked tokens"
+// @Failure 403 {object} model.ErrorResponse "Insufficient scope"
+// @Failure 500 {object} model.ErrorResponse "Internal server error"
+// @Router /auth/logout-all [post]
+// @Example request
+//
+//	{
+//	  "keep_current": true
+//	}
+//
+// @Example response 200
+//
+//	{
+//	  "success": "Successfully logged out from all sessions"
+//	}
+func (h *Handler) AuthLogoutAll(writer http.ResponseWriter, req *http.Request) {
+
+	claims, ok := req.Context().Value("claims").(*model.Claims)
+
+	if !ok {
+		server.SetResponse(writer, http.StatusUnauthorized, model.ErrorResponse{Error: "Authorization required"})
+		return
+	}
+
+	// Тело необязательно
+	var freq model.LogoutAllRequest
+	if err := json.NewDecoder(req.Body).Decode(&freq); err != nil && !errors.Is(err, io.EOF) {
+		server.SetResponse(writer, http.StatusBadRequest, model.ErrorResponse{Error: "Invalid request"})
+		return
+	}
+
+	var err error
+
+	if freq.KeepCurrent {
+		err = h.revokeOtherSessions(claims)
+	} else {
+		// Без исключений достаточно сдвинуть эпоху токенов пользователя,
+		// revoked_tokens при этом не растёт с числом сессий
+		err = h.Store.InvalidateUserTokens(claims.UserID, token.JWTExpiration())
+	}
+
+	if err != nil {
+		log.Println(err)
+		server.SetResponse(writer, http.StatusInternalServerError, model.ErrorResponse{Error: "Failed to revoke sessions"})
+		return
+	}
+
+	server.SetResponse(writer, http.StatusOK, model.SuccessResponse{Success: "Successfully logged out from all sessions"})
+}
+
+func (h *Handler) revokeOtherSessions(claims *model.Claims) error {
+
+	except_family_id := ""
+
+	stored_token, err := h.Store.FindRefreshToken(claims.UserID, claims.PairID)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+
+	if err == nil {
+		except_family_id = stored_token.FamilyID
+	}
+
+	return h.Store.RevokeUserSessions(claims.UserID, except_family_id, token.JWTExpiration())
+}
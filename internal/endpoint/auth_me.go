@@ -9,12 +9,13 @@ import (
 
 // AuthMe godoc
 // @Summary Get current user ID
-// @Description Returns the user ID. Requires valid JWT in Authorization header.
+// @Description Returns the user ID. Requires valid JWT in Authorization header with the profile scope.
 // @Tags Authentication
 // @Security BearerAuth
 // @Produce json
 // @Success 200 {object} model.UserIdResponse "Successfully retrieved user ID"
 // @Failure 401 {object} model.ErrorResponse "Unauthorized - invalid or revoked tokens"
+// @Failure 403 {object} model.ErrorResponse "Insufficient scope"
 // @Router /auth/me [get]
 // @Example response 200
 //
@@ -27,7 +28,7 @@ import (
 //	{
 //	  "error": "Authorization required"
 //	}
-func AuthMe(writer http.ResponseWriter, req *http.Request) {
+func (h *Handler) AuthMe(writer http.ResponseWriter, req *http.Request) {
 
 	claims, ok := req.Context().Value("claims").(*model.Claims)
 
@@ -2,9 +2,12 @@ package endpoint
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/redeflesq/auth-example/internal/model"
 	"github.com/redeflesq/auth-example/internal/server"
@@ -22,7 +25,7 @@ import (
 // @Param request body model.TokenRequest true "Refresh token"
 // @Success 200 {object} model.TokenResponse "New tokens pair"
 // @Failure 400 {object} model.ErrorResponse "Invalid request format"
-// @Failure 401 {object} model.ErrorResponse "Unauthorized - invalid or revoked tokens"
+// @Failure 401 {object} model.ErrorResponse "Unauthorized - invalid or revoked tokens, or reuse of an already rotated refresh token"
 // @Failure 500 {object} model.ErrorResponse "Internal server error"
 // @Router /auth/refresh [post]
 // @Example request
@@ -43,7 +46,7 @@ import (
 //	{
 //	  "error": "Invalid token"
 //	}
-func AuthRefresh(writer http.ResponseWriter, req *http.Request) {
+func (h *Handler) AuthRefresh(writer http.ResponseWriter, req *http.Request) {
 
 	var freq model.TokenRequest
 	if err := json.NewDecoder(req.Body).Decode(&freq); err != nil {
@@ -79,33 +82,44 @@ func AuthRefresh(writer http.ResponseWriter, req *http.Request) {
 	user_id := access_claims.UserID
 	pair_id := access_claims.PairID
 
+	// Ищем токен обновления в базе по данным из токена доступа
+
+	stored_token, err := h.Store.FindRefreshToken(user_id, pair_id)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		log.Println(err)
+		server.SetResponse(writer, http.StatusInternalServerError, model.ErrorResponse{Error: "Failed to find refresh token"})
+		return
+	}
+
+	found := err == nil
+
+	// Верифицируем токен обновления который был получен из запроса
+
+	refresh_token_verification := found && token.VerifyRefreshToken(refresh_token_data, stored_token.TokenHash, user_id)
+
+	// Предъявлен уже обменянный токен: цепочка скомпрометирована, отзываем её целиком
+
+	current_ip, _, _ := net.SplitHostPort(req.RemoteAddr)
+
+	if refresh_token_verification && stored_token.IsRotated {
+		h.revokeCompromisedFamily(stored_token, current_ip)
+		server.SetResponse(writer, http.StatusUnauthorized, model.ErrorResponse{Error: "Refresh token reuse detected"})
+		return
+	}
+
 	// Проверяем отозван ли токен доступа
 
-	revoked, err := storage.AccessTokenIsRevoked(pair_id)
+	revoked, err := server.AccessTokenIsRevoked(h.Store, access_claims)
 	if err != nil || revoked {
 		server.SetResponse(writer, http.StatusUnauthorized, model.ErrorResponse{Error: "Token revoked"})
 		return
 	}
 
-	// Ищем токен обновления в базе по данным из токена доступа
-	// В данный момент токен доступа: парный и не отозван
-
-	var token_hash, ip_address, user_agent string
-	err = storage.DB.QueryRow(
-		`SELECT token_hash, ip_address, user_agent FROM refresh_tokens 
-         WHERE user_id = $1 AND pair_id = $2 AND is_revoked = false AND expires_at > NOW()`,
-		user_id, pair_id,
-	).Scan(&token_hash, &ip_address, &user_agent)
-
-	if err != nil {
-		log.Println(err)
+	if !found || !stored_token.IsActive() {
 		server.SetResponse(writer, http.StatusUnauthorized, model.ErrorResponse{Error: "Refresh token not found"})
 		return
 	}
 
-	// Верифицируем токен обновления который был получен из запроса
-
-	refresh_token_verification := token.VerifyRefreshToken(refresh_token_data, token_hash, user_id)
 	if !refresh_token_verification {
 		server.SetResponse(writer, http.StatusUnauthorized, model.ErrorResponse{Error: "Incorrect refresh token"})
 		return
@@ -113,22 +127,21 @@ func AuthRefresh(writer http.ResponseWriter, req *http.Request) {
 
 	// Отправляем вебхук об изменении IP (Если изменился)
 
-	current_ip, _, _ := net.SplitHostPort(req.RemoteAddr)
-	if current_ip != ip_address {
-		go server.SendWebhook(user_id, ip_address, current_ip)
+	if current_ip != stored_token.IPAddress {
+		go server.SendWebhook(user_id, stored_token.IPAddress, current_ip)
 	}
 
 	// Проверяем User-Agent
 
 	current_useragent := req.UserAgent()
-	if current_useragent != user_agent {
+	if current_useragent != stored_token.UserAgent {
 
-		err = storage.RevokeAccessToken(pair_id, access_claims.ExpiresAt.Time)
+		err = h.Store.RevokeAccessToken(pair_id, access_claims.ExpiresAt.Time)
 		if err != nil {
 			log.Printf("Failed to revoke token: %v", err)
 		}
 
-		err = storage.RevokeRefreshTokens(pair_id)
+		err = h.Store.RevokeRefreshTokens(pair_id)
 		if err != nil {
 			log.Printf("Failed to revoke token: %v", err)
 		}
@@ -139,35 +152,42 @@ func AuthRefresh(writer http.ResponseWriter, req *http.Request) {
 
 	// Генерируем новые токены
 
-	new_tokens_pair, err := token.GenerateTokensPair(user_id)
+	// Новая пара получает scope цепочки и текущие роли пользователя
+	roles, err := h.userRoles(user_id)
 	if err != nil {
+		log.Println(err)
 		server.SetResponse(writer, http.StatusInternalServerError, model.ErrorResponse{Error: "Failed to generate tokens"})
 		return
 	}
 
-	// Удаляем старые токены
-
-	err = storage.RevokeAccessToken(pair_id, access_claims.ExpiresAt.Time)
+	// Scope admin пропадает из токенов, если пользователь перестал быть оператором
+	new_tokens_pair, err := token.GenerateTokensPair(user_id, stored_token.ClientID, operatorScope(sessionScope(stored_token), roles), roles)
 	if err != nil {
 		log.Println(err)
-		server.SetResponse(writer, http.StatusInternalServerError, model.ErrorResponse{Error: "Failed to revoke old access token"})
+		server.SetResponse(writer, http.StatusInternalServerError, model.ErrorResponse{Error: "Failed to generate tokens"})
 		return
 	}
 
-	_, err = storage.DB.Exec("UPDATE refresh_tokens SET is_revoked = true WHERE token_hash = $1", token_hash)
-	if err != nil {
-		log.Println(err)
-		server.SetResponse(writer, http.StatusInternalServerError, model.ErrorResponse{Error: "Failed to revoke old refresh token"})
+	// Атомарно отзываем старую пару и сохраняем новый refresh токен.
+	// Из параллельных запросов с одним и тем же токеном успешен только один
+
+	err = h.Store.RotateRefreshToken(stored_token, access_claims.ExpiresAt.Time, storage.RefreshToken{
+		UserID:    user_id,
+		PairID:    new_tokens_pair.PairID,
+		TokenHash: new_tokens_pair.RefreshToken.Hash,
+		UserAgent: current_useragent,
+		IPAddress: current_ip,
+		ExpiresAt: storage.RefreshTokenExpiration(),
+	})
+	if errors.Is(err, storage.ErrAlreadyUsed) {
+		// Токен обменян параллельным запросом, это такое же повторное использование
+		h.revokeCompromisedFamily(stored_token, current_ip)
+		server.SetResponse(writer, http.StatusUnauthorized, model.ErrorResponse{Error: "Refresh token reuse detected"})
 		return
 	}
-
-	// Сохраняем новый refresh токен
-
-	ip, _, _ := net.SplitHostPort(req.RemoteAddr)
-	err = storage.SaveRefreshToken(user_id, new_tokens_pair.PairID, new_tokens_pair.RefreshToken.Hash, current_useragent, ip)
 	if err != nil {
 		log.Println(err)
-		server.SetResponse(writer, http.StatusInternalServerError, model.ErrorResponse{Error: "Failed to save refresh token"})
+		server.SetResponse(writer, http.StatusInternalServerError, model.ErrorResponse{Error: "Failed to rotate refresh token"})
 		return
 	}
 
@@ -176,5 +196,32 @@ func AuthRefresh(writer http.ResponseWriter, req *http.Request) {
 	server.SetResponse(writer, http.StatusOK, model.TokenResponse{
 		AccessToken:  new_tokens_pair.AccessToken,
 		RefreshToken: new_tokens_pair.RefreshToken.Token,
+		Scope:        new_tokens_pair.Scope,
+	})
+}
+
+func (h *Handler) revokeCompromisedFamily(stored_token storage.RefreshToken, ip_address string) {
+
+	// Сроки access токенов пар цепочки неизвестны, берём максимально возможный
+	err := h.Store.RevokeTokenFamily(stored_token.FamilyID, time.Now().Add(token.JWTExpiration()))
+	if err != nil {
+		log.Printf("Failed to revoke token family: %v", err)
+	}
+
+	go server.SendSecurityEvent("refresh_token_reuse", stored_token.UserID, "Reuse of rotated refresh token, token family revoked", map[string]string{
+		"family_id":  stored_token.FamilyID,
+		"pair_id":    stored_token.PairID,
+		"ip_address": ip_address,
 	})
 }
+
+// sessionScope возвращает scope цепочки refresh токенов. Пустой scope у сессий,
+// начатых до появления scope, - scope по умолчанию
+func sessionScope(stored_token storage.RefreshToken) string {
+
+	if stored_token.Scope == "" {
+		return strings.Join(token.UserScopes(), " ")
+	}
+
+	return stored_token.Scope
+}
@@ -0,0 +1,100 @@
+package endpoint
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/redeflesq/auth-example/internal/model"
+	"github.com/redeflesq/auth-example/internal/password"
+	"github.com/redeflesq/auth-example/internal/server"
+	"github.com/redeflesq/auth-example/internal/storage"
+)
+
+// AuthRegister godoc
+// @Summary Register a new user
+// @Description Creates a user account for password login on /auth/token. Username is case-insensitive, password must be at least 8 characters
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Param request body model.RegisterRequest true "Credentials"
+// @Success 201 {object} model.UserIdResponse "User created"
+// @Failure 400 {object} model.ErrorResponse "Invalid username or password"
+// @Failure 409 {object} model.ErrorResponse "Username already taken"
+// @Failure 500 {object} model.ErrorResponse "Internal server error"
+// @Router /auth/register [post]
+// @Example request
+//
+//	{
+//	  "username": "alice",
+//	  "password": "correct horse battery staple"
+//	}
+//
+// @Example response 201
+//
+//	{
+//	  "user_id": "5f0c4b1e-6a3d-4f7e-9a5c-2b8d7e1f0a9c"
+//	}
+//
+// @Example response 409
+//
+//	{
+//	  "error": "Username already taken"
+//	}
+func (h *Handler) AuthRegister(writer http.ResponseWriter, req *http.Request) {
+
+	var freq model.RegisterRequest
+	if err := json.NewDecoder(req.Body).Decode(&freq); err != nil {
+		server.SetResponse(writer, http.StatusBadRequest, model.ErrorResponse{Error: "Invalid request"})
+		return
+	}
+
+	username := NormalizeUsername(freq.Username)
+	if username == "" {
+		server.SetResponse(writer, http.StatusBadRequest, model.ErrorResponse{Error: "Empty username"})
+		return
+	}
+
+	if len([]rune(freq.Password)) < password.MinLength {
+		server.SetResponse(writer, http.StatusBadRequest, model.ErrorResponse{Error: "Password is too short"})
+		return
+	}
+
+	password_hash, err := password.Hash(freq.Password)
+	if err != nil {
+		log.Println(err)
+		server.SetResponse(writer, http.StatusInternalServerError, model.ErrorResponse{Error: "Failed to hash password"})
+		return
+	}
+
+	user := storage.User{
+		ID:           uuid.NewString(),
+		Username:     username,
+		PasswordHash: password_hash,
+		Roles:        []string{model.RoleUser},
+		CreatedAt:    time.Now(),
+	}
+
+	err = h.Store.CreateUser(user)
+	if errors.Is(err, storage.ErrUserExists) {
+		server.SetResponse(writer, http.StatusConflict, model.ErrorResponse{Error: "Username already taken"})
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		server.SetResponse(writer, http.StatusInternalServerError, model.ErrorResponse{Error: "Failed to create user"})
+		return
+	}
+
+	server.SetResponse(writer, http.StatusCreated, model.UserIdResponse{UserID: user.ID})
+}
+
+// NormalizeUsername приводит username к виду, в котором он хранится: без учёта регистра и пробелов по краям
+func NormalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
@@ -0,0 +1,76 @@
+package endpoint
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/redeflesq/auth-example/internal/model"
+	"github.com/redeflesq/auth-example/internal/server"
+	"github.com/redeflesq/auth-example/internal/storage"
+	"github.com/redeflesq/auth-example/internal/token"
+)
+
+// AuthSessionRevoke godoc
+// @Summary Revoke a session
+// @Description Signs out one session of the current user by its pair_id from GET /auth/sessions. Revokes all refresh and access tokens of the session. Requires valid JWT in Authorization header with the sessions:write scope.
+// @Tags Sessions
+// @Security BearerAuth
+// @Produce json
+// @Param pair_id path string true "Session pair_id"
+// @Success 200 {object} model.SuccessResponse "Session revoked"
+// @Failure 401 {object} model.ErrorResponse "Unauthorized - invalid or revoked tokens"
+// @Failure 403 {object} model.ErrorResponse "Insufficient scope"
+// @Failure 404 {object} model.ErrorResponse "Session not found"
+// @Failure 500 {object} model.ErrorResponse "Internal server error"
+// @Router /auth/sessions/{pair_id} [delete]
+// @Example response 200
+//
+//	{
+//	  "success": "Session revoked"
+//	}
+//
+// @Example response 404
+//
+//	{
+//	  "error": "Session not found"
+//	}
+func (h *Handler) AuthSessionRevoke(writer http.ResponseWriter, req *http.Request) {
+
+	claims, ok := req.Context().Value("claims").(*model.Claims)
+
+	if !ok {
+		server.SetResponse(writer, http.StatusUnauthorized, model.ErrorResponse{Error: "Authorization required"})
+		return
+	}
+
+	h.revokeSession(writer, claims.UserID, mux.Vars(req)["pair_id"])
+}
+
+// revokeSession завершает сессию pair_id пользователя user_id и отвечает клиенту
+func (h *Handler) revokeSession(writer http.ResponseWriter, user_id, pair_id string) {
+
+	// Чужая сессия неотличима от несуществующей
+	stored_token, err := h.Store.FindRefreshToken(user_id, pair_id)
+	if errors.Is(err, storage.ErrNotFound) || (err == nil && !stored_token.IsActive()) {
+		server.SetResponse(writer, http.StatusNotFound, model.ErrorResponse{Error: "Session not found"})
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		server.SetResponse(writer, http.StatusInternalServerError, model.ErrorResponse{Error: "Failed to find session"})
+		return
+	}
+
+	err = h.Store.RevokeTokenFamily(stored_token.FamilyID, time.Now().Add(token.JWTExpiration()))
+	if err != nil {
+		log.Println(err)
+		server.SetResponse(writer, http.StatusInternalServerError, model.ErrorResponse{Error: "Failed to revoke session"})
+		return
+	}
+
+	server.SetResponse(writer, http.StatusOK, model.SuccessResponse{Success: "Session revoked"})
+}
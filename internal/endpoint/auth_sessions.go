@@ -0,0 +1,81 @@
+package endpoint
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/redeflesq/auth-example/internal/model"
+	"github.com/redeflesq/auth-example/internal/server"
+	"github.com/redeflesq/auth-example/internal/storage"
+)
+
+// AuthSessions godoc
+// @Summary List active sessions
+// @Description Returns active sessions of the current user: one entry per sign-in with its current pair_id, device (User-Agent), IP address, sign-in time and last refresh time. Requires valid JWT in Authorization header with the sessions:read scope.
+// @Tags Sessions
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} model.SessionsResponse "Active sessions"
+// @Failure 401 {object} model.ErrorResponse "Unauthorized - invalid or revoked tokens"
+// @Failure 403 {object} model.ErrorResponse "Insufficient scope"
+// @Failure 500 {object} model.ErrorResponse "Internal server error"
+// @Router /auth/sessions [get]
+// @Example response 200
+//
+//	{
+//	  "sessions": [
+//	    {
+//	      "pair_id": "5b0f9a3e-2c4d-4b7a-9f10-3c2e8d1a7b64",
+//	      "device": "Mozilla/5.0 (X11; Linux x86_64) Firefox/128.0",
+//	      "ip_address": "203.0.113.7",
+//	      "created_at": "2025-07-01T10:00:00Z",
+//	      "last_used_at": "2025-07-05T18:30:00Z",
+//	      "expires_at": "2025-08-04T18:30:00Z",
+//	      "current": true
+//	    }
+//	  ]
+//	}
+//
+// @Example response 401
+//
+//	{
+//	  "error": "Authorization required"
+//	}
+func (h *Handler) AuthSessions(writer http.ResponseWriter, req *http.Request) {
+
+	claims, ok := req.Context().Value("claims").(*model.Claims)
+
+	if !ok {
+		server.SetResponse(writer, http.StatusUnauthorized, model.ErrorResponse{Error: "Authorization required"})
+		return
+	}
+
+	sessions, err := h.Store.ListSessions(claims.UserID)
+	if err != nil {
+		log.Println(err)
+		server.SetResponse(writer, http.StatusInternalServerError, model.ErrorResponse{Error: "Failed to list sessions"})
+		return
+	}
+
+	server.SetResponse(writer, http.StatusOK, sessionsResponse(sessions, claims.PairID))
+}
+
+// sessionsResponse отмечает current сессию с парой current_pair_id
+func sessionsResponse(sessions []storage.Session, current_pair_id string) model.SessionsResponse {
+
+	response := model.SessionsResponse{Sessions: []model.SessionResponse{}}
+
+	for _, session := range sessions {
+		response.Sessions = append(response.Sessions, model.SessionResponse{
+			PairID:     session.PairID,
+			Device:     session.UserAgent,
+			IPAddress:  session.IPAddress,
+			CreatedAt:  session.CreatedAt,
+			LastUsedAt: session.LastUsedAt,
+			ExpiresAt:  session.ExpiresAt,
+			Current:    session.PairID == current_pair_id,
+		})
+	}
+
+	return response
+}
@@ -0,0 +1,237 @@
+package endpoint_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/redeflesq/auth-example/internal/endpoint"
+	"github.com/redeflesq/auth-example/internal/model"
+	"github.com/redeflesq/auth-example/internal/server"
+	"github.com/redeflesq/auth-example/internal/storage"
+	"github.com/redeflesq/auth-example/internal/token"
+)
+
+const (
+	testPassword  = "correct horse battery staple"
+	testUserAgent = "endpoint-test/1.0"
+)
+
+func TestMain(m *testing.M) {
+
+	os.Setenv("JWT_ALGORITHM", "HS512")
+	os.Setenv("JWT_SECRET", "endpoint-test-secret")
+	os.Setenv("JWT_EXPIRATION_MINUTES", "15")
+
+	if err := token.Init(); err != nil {
+		log.Fatal(err)
+	}
+
+	os.Exit(m.Run())
+}
+
+// newTestServer поднимает маршруты /auth/*, /oauth/* и /admin/* поверх хранилища в памяти, без базы данных
+func newTestServer(t *testing.T) (*httptest.Server, storage.Store) {
+
+	store := storage.NewMemoryStore()
+	handler := endpoint.New(store)
+	auth := server.AuthMiddleware(store)
+
+	router := mux.NewRouter()
+	handler.Router = router
+
+	router.HandleFunc("/auth/register", handler.AuthRegister).Methods("POST")
+	router.HandleFunc("/auth/token", handler.AuthToken).Methods("POST")
+	router.HandleFunc("/auth/refresh", handler.AuthRefresh).Methods("POST")
+	router.Handle("/auth/me", auth(http.HandlerFunc(handler.AuthMe))).Methods("GET")
+	router.Handle("/auth/logout", auth(http.HandlerFunc(handler.AuthLogout))).Methods("POST")
+	router.HandleFunc("/oauth/token", handler.OAuthToken).Methods("POST")
+	router.HandleFunc("/oauth/device_authorization", handler.OAuthDeviceAuthorization).Methods("POST")
+	router.HandleFunc("/oauth/introspect", handler.OAuthIntrospect).Methods("POST")
+	router.HandleFunc("/oauth/revoke", handler.OAuthRevoke).Methods("POST")
+
+	operator := server.RequireRoles(store, token.ScopeAdmin, model.RoleAdmin, model.RoleSupport)
+	router.Handle("/admin/users", operator(http.HandlerFunc(handler.AdminUser))).Methods("GET")
+	router.Handle("/admin/users/{user_id}/sessions", operator(http.HandlerFunc(handler.AdminUserSessions))).Methods("GET")
+
+	srv := httptest.NewServer(router)
+	t.Cleanup(srv.Close)
+
+	return srv, store
+}
+
+// call отправляет JSON запрос и разбирает JSON ответ в map
+func call(t *testing.T, srv *httptest.Server, method, path, access_token string, body any) (int, map[string]any) {
+
+	t.Helper()
+
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req, err := http.NewRequest(method, srv.URL+path, &payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", testUserAgent)
+	if access_token != "" {
+		req.Header.Set("Authorization", "Bearer "+access_token)
+	}
+
+	response, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	var result map[string]any
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		t.Fatalf("%s %s: invalid JSON response: %v", method, path, err)
+	}
+
+	return response.StatusCode, result
+}
+
+// signIn регистрирует пользователя и возвращает его user_id и первую пару токенов
+func signIn(t *testing.T, srv *httptest.Server, username string) (string, string, string) {
+
+	t.Helper()
+
+	status, registered := call(t, srv, "POST", "/auth/register", "", map[string]string{"username": username, "password": testPassword})
+	if status != http.StatusCreated {
+		t.Fatalf("register: status %d, %v", status, registered)
+	}
+
+	status, tokens := call(t, srv, "POST", "/auth/token", "", map[string]string{"username": username, "password": testPassword})
+	if status != http.StatusOK {
+		t.Fatalf("token: status %d, %v", status, tokens)
+	}
+
+	return registered["user_id"].(string), tokens["access_token"].(string), tokens["refresh_token"].(string)
+}
+
+func TestAuthTokenRejectsWrongPassword(t *testing.T) {
+
+	srv, _ := newTestServer(t)
+
+	signIn(t, srv, "alice")
+
+	status, response := call(t, srv, "POST", "/auth/token", "", map[string]string{"username": "alice", "password": "wrong password"})
+	if status != http.StatusUnauthorized {
+		t.Fatalf("status %d, %v", status, response)
+	}
+
+	status, _ = call(t, srv, "POST", "/auth/token", "", map[string]string{"username": "bob", "password": testPassword})
+	if status != http.StatusUnauthorized {
+		t.Fatalf("unknown user: status %d", status)
+	}
+}
+
+func TestAuthMe(t *testing.T) {
+
+	srv, _ := newTestServer(t)
+
+	user_id, access_token, _ := signIn(t, srv, "alice")
+
+	status, response := call(t, srv, "GET", "/auth/me", access_token, nil)
+	if status != http.StatusOK || response["user_id"] != user_id {
+		t.Fatalf("status %d, %v, want user_id %s", status, response, user_id)
+	}
+
+	if status, _ = call(t, srv, "GET", "/auth/me", "", nil); status != http.StatusUnauthorized {
+		t.Fatalf("without token: status %d", status)
+	}
+
+	if status, _ = call(t, srv, "GET", "/auth/me", access_token+"x", nil); status != http.StatusUnauthorized {
+		t.Fatalf("with a forged signature: status %d", status)
+	}
+}
+
+func TestAuthRefreshRotatesPair(t *testing.T) {
+
+	srv, _ := newTestServer(t)
+
+	user_id, access_token, refresh_token := signIn(t, srv, "alice")
+
+	status, rotated := call(t, srv, "POST", "/auth/refresh", access_token, map[string]string{"refresh_token": refresh_token})
+	if status != http.StatusOK {
+		t.Fatalf("refresh: status %d, %v", status, rotated)
+	}
+
+	new_access_token := rotated["access_token"].(string)
+
+	status, response := call(t, srv, "GET", "/auth/me", new_access_token, nil)
+	if status != http.StatusOK || response["user_id"] != user_id {
+		t.Fatalf("me with the new pair: status %d, %v", status, response)
+	}
+
+	// Старая пара отозвана ротацией
+	if status, _ = call(t, srv, "GET", "/auth/me", access_token, nil); status != http.StatusUnauthorized {
+		t.Fatalf("me with the old pair: status %d", status)
+	}
+}
+
+func TestAuthRefreshReuseRevokesFamily(t *testing.T) {
+
+	srv, _ := newTestServer(t)
+
+	_, access_token, refresh_token := signIn(t, srv, "alice")
+
+	status, rotated := call(t, srv, "POST", "/auth/refresh", access_token, map[string]string{"refresh_token": refresh_token})
+	if status != http.StatusOK {
+		t.Fatalf("refresh: status %d, %v", status, rotated)
+	}
+
+	status, response := call(t, srv, "POST", "/auth/refresh", access_token, map[string]string{"refresh_token": refresh_token})
+	if status != http.StatusUnauthorized || response["error"] != "Refresh token reuse detected" {
+		t.Fatalf("reuse: status %d, %v", status, response)
+	}
+
+	// Повторное использование отзывает всю цепочку, включая пару, полученную честно
+	if status, _ = call(t, srv, "GET", "/auth/me", rotated["access_token"].(string), nil); status != http.StatusUnauthorized {
+		t.Fatalf("me after reuse: status %d", status)
+	}
+}
+
+func TestAuthRefreshRejectsForeignPair(t *testing.T) {
+
+	srv, _ := newTestServer(t)
+
+	_, access_token, _ := signIn(t, srv, "alice")
+	_, _, other_refresh_token := signIn(t, srv, "bob")
+
+	status, response := call(t, srv, "POST", "/auth/refresh", access_token, map[string]string{"refresh_token": other_refresh_token})
+	if status != http.StatusUnauthorized || response["error"] != "Incorrect tokens pair" {
+		t.Fatalf("status %d, %v", status, response)
+	}
+}
+
+func TestAuthLogout(t *testing.T) {
+
+	srv, _ := newTestServer(t)
+
+	_, access_token, refresh_token := signIn(t, srv, "alice")
+
+	if status, response := call(t, srv, "POST", "/auth/logout", access_token, nil); status != http.StatusOK {
+		t.Fatalf("logout: status %d, %v", status, response)
+	}
+
+	if status, _ := call(t, srv, "GET", "/auth/me", access_token, nil); status != http.StatusUnauthorized {
+		t.Fatalf("me after logout: status %d", status)
+	}
+
+	if status, _ := call(t, srv, "POST", "/auth/refresh", access_token, map[string]string{"refresh_token": refresh_token}); status != http.StatusUnauthorized {
+		t.Fatalf("refresh after logout: status %d", status)
+	}
+}
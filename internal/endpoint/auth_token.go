@@ -2,11 +2,17 @@ package endpoint
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net"
 	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/redeflesq/auth-example/internal/model"
+	"github.com/redeflesq/auth-example/internal/password"
 	"github.com/redeflesq/auth-example/internal/server"
 	"github.com/redeflesq/auth-example/internal/storage"
 	"github.com/redeflesq/auth-example/internal/token"
@@ -14,65 +20,246 @@ import (
 
 // AuthToken godoc
 // @Summary Generate new authentication tokens
-// @Description Creates new access and refresh tokens pair for specified user ID
+// @Description Verifies username and password and creates new access and refresh tokens pair for the user. The optional scope requests a subset of the scopes allowed for users (AUTH_USER_SCOPES) and the client, all of them by default. Operators (admin and support roles) may explicitly request the admin scope required by /admin, through a client only if the client is allowed it. In trusted issuer mode (AUTH_TRUSTED_ISSUER=true) a registered API client authenticated with HTTP Basic (client_id:client_secret) or an mTLS certificate may request tokens for any user_id except operator accounts. The client_id is embedded in the access token as azp
 // @Tags Authentication
 // @Accept json
 // @Produce json
-// @Param request body model.UserIdRequest true "User ID"
+// @Param request body model.AuthTokenRequest true "Credentials"
 // @Success 200 {object} model.TokenResponse "Successfully generated tokens"
-// @Failure 400 {object} model.ErrorResponse "Invalid request or empty user ID"
+// @Failure 400 {object} model.ErrorResponse "Invalid request, missing credentials or invalid scope"
+// @Failure 401 {object} model.ErrorResponse "Invalid username or password, invalid client or client authentication required"
+// @Failure 403 {object} model.ErrorResponse "Trusted issuer request for an operator account"
 // @Failure 500 {object} model.ErrorResponse "Failed to generate or save tokens"
 // @Router /auth/token [post]
 // @Example request
 //
 //	{
-//	  "user_id": "1337-abcd-0228"
+//	  "username": "alice",
+//	  "password": "correct horse battery staple"
 //	}
 //
 // @Example response 200
 //
 //	{
 //	  "access_token": "eyJhbGciOiJIUzUxMiIs...",
-//	  "refresh_token": "dGhpcyBpcyBhIHNhbXBsZSByZWZyZXNoIHRva2Vu"
+//	  "refresh_token": "dGhpcyBpcyBhIHNhbXBsZSByZWZyZXNoIHRva2Vu",
+//	  "scope": "profile sessions:read sessions:write"
 //	}
 //
-// @Example response 400
+// @Example response 401
 //
 //	{
-//	  "error": "Empty user id"
+//	  "error": "Invalid username or password"
 //	}
-func AuthToken(writer http.ResponseWriter, req *http.Request) {
+func (h *Handler) AuthToken(writer http.ResponseWriter, req *http.Request) {
 
-	var freq model.UserIdRequest
+	var freq model.AuthTokenRequest
 	if err := json.NewDecoder(req.Body).Decode(&freq); err != nil {
 		server.SetResponse(writer, http.StatusBadRequest, model.ErrorResponse{Error: "Invalid request"})
 		return
 	}
 
-	if freq.UserID == "" {
-		server.SetResponse(writer, http.StatusBadRequest, model.ErrorResponse{Error: "Empty user id"})
+	client, err := h.authenticateClient(req)
+	if errors.Is(err, errInvalidClient) {
+		writer.Header().Set("WWW-Authenticate", `Basic realm="auth"`)
+		server.SetResponse(writer, http.StatusUnauthorized, model.ErrorResponse{Error: "Invalid client"})
 		return
 	}
-
-	tokens_pair, err := token.GenerateTokensPair(freq.UserID)
 	if err != nil {
 		log.Println(err)
-		server.SetResponse(writer, http.StatusInternalServerError, model.ErrorResponse{Error: "Failed to generate tokens"})
+		server.SetResponse(writer, http.StatusInternalServerError, model.ErrorResponse{Error: "Failed to authenticate client"})
 		return
 	}
 
-	ua := req.UserAgent()
-	ip, _, _ := net.SplitHostPort(req.RemoteAddr)
-	err = storage.SaveRefreshToken(freq.UserID, tokens_pair.PairID, tokens_pair.RefreshToken.Hash, ua, ip)
+	var user_id string
+
+	switch {
+
+	case freq.Username != "" || freq.Password != "":
+
+		user, err := h.authenticate(freq.Username, freq.Password)
+		if errors.Is(err, errInvalidCredentials) {
+			server.SetResponse(writer, http.StatusUnauthorized, model.ErrorResponse{Error: "Invalid username or password"})
+			return
+		}
+		if err != nil {
+			log.Println(err)
+			server.SetResponse(writer, http.StatusInternalServerError, model.ErrorResponse{Error: "Failed to verify credentials"})
+			return
+		}
+
+		user_id = user.ID
+
+	case trustedIssuer():
+
+		// Вызывающий сам отвечает за аутентификацию пользователя, поэтому должен быть зарегистрированным клиентом
+		if client.ID == "" {
+			writer.Header().Set("WWW-Authenticate", `Basic realm="auth"`)
+			server.SetResponse(writer, http.StatusUnauthorized, model.ErrorResponse{Error: "Client authentication required"})
+			return
+		}
+
+		if freq.UserID == "" {
+			server.SetResponse(writer, http.StatusBadRequest, model.ErrorResponse{Error: "Empty user id"})
+			return
+		}
 
+		// Клиент не должен получать токены операторов, зная их user_id: операторы входят только по паролю
+		roles, err := h.userRoles(freq.UserID)
+		if err != nil {
+			log.Println(err)
+			server.SetResponse(writer, http.StatusInternalServerError, model.ErrorResponse{Error: "Failed to find user"})
+			return
+		}
+
+		if slices.ContainsFunc(roles, func(role string) bool { return role != model.RoleUser }) {
+			server.SetResponse(writer, http.StatusForbidden, model.ErrorResponse{Error: "Operators must sign in with a password"})
+			return
+		}
+
+		user_id = freq.UserID
+
+	default:
+		server.SetResponse(writer, http.StatusBadRequest, model.ErrorResponse{Error: "Username and password required"})
+		return
+	}
+
+	scope, ok := grantUserScope(freq.Scope, client)
+	if !ok {
+		server.SetResponse(writer, http.StatusBadRequest, model.ErrorResponse{Error: "Invalid scope"})
+		return
+	}
+
+	tokens_pair, err := h.createSession(req, user_id, client.ID, scope)
 	if err != nil {
 		log.Println(err)
-		server.SetResponse(writer, http.StatusInternalServerError, model.ErrorResponse{Error: "Failed to save refresh token"})
+		server.SetResponse(writer, http.StatusInternalServerError, model.ErrorResponse{Error: "Failed to generate tokens"})
 		return
 	}
 
 	server.SetResponse(writer, http.StatusOK, model.TokenResponse{
 		AccessToken:  tokens_pair.AccessToken,
 		RefreshToken: tokens_pair.RefreshToken.Token,
+		Scope:        tokens_pair.Scope,
 	})
 }
+
+var errInvalidCredentials = errors.New("invalid credentials")
+
+func (h *Handler) authenticate(username, user_password string) (storage.User, error) {
+
+	user, err := h.Store.FindUserByUsername(NormalizeUsername(username))
+
+	if errors.Is(err, storage.ErrNotFound) {
+		password.VerifyDummy(user_password)
+		return storage.User{}, errInvalidCredentials
+	}
+
+	if err != nil {
+		return storage.User{}, err
+	}
+
+	ok, err := password.Verify(user_password, user.PasswordHash)
+
+	if err != nil {
+		return storage.User{}, err
+	}
+
+	if !ok {
+		return storage.User{}, errInvalidCredentials
+	}
+
+	return user, nil
+}
+
+// createSession выпускает новую пару токенов и сохраняет refresh токен, начиная новую сессию пользователя
+func (h *Handler) createSession(req *http.Request, user_id, client_id, scope string) (model.TokenPair, error) {
+
+	roles, err := h.userRoles(user_id)
+	if err != nil {
+		return model.TokenPair{}, err
+	}
+
+	scope = operatorScope(scope, roles)
+
+	tokens_pair, err := token.GenerateTokensPair(user_id, client_id, scope, roles)
+	if err != nil {
+		return tokens_pair, err
+	}
+
+	ip, _, _ := net.SplitHostPort(req.RemoteAddr)
+	err = h.Store.SaveRefreshToken(storage.RefreshToken{
+		UserID:    user_id,
+		PairID:    tokens_pair.PairID,
+		ClientID:  client_id,
+		Scope:     scope,
+		TokenHash: tokens_pair.RefreshToken.Hash,
+		UserAgent: req.UserAgent(),
+		IPAddress: ip,
+		ExpiresAt: storage.RefreshTokenExpiration(),
+	})
+
+	return tokens_pair, err
+}
+
+// userRoles возвращает роли пользователя для токена. У пользователей без учётной записи
+// (AUTH_TRUSTED_ISSUER) и без назначенных ролей - только user
+func (h *Handler) userRoles(user_id string) ([]string, error) {
+
+	user, err := h.Store.FindUser(user_id)
+
+	if errors.Is(err, storage.ErrNotFound) || (err == nil && len(user.Roles) == 0) {
+		return []string{model.RoleUser}, nil
+	}
+
+	return user.Roles, err
+}
+
+// userScopes возвращает scope, которые пользователь может получить через клиента.
+// Если клиенту заданы scope, токены через него ограничены ими
+func userScopes(client storage.Client) []string {
+
+	allowed := token.UserScopes()
+
+	if len(client.Scopes) == 0 {
+		return allowed
+	}
+
+	return slices.DeleteFunc(allowed, func(scope string) bool {
+		return !slices.Contains(client.Scopes, scope)
+	})
+}
+
+// grantUserScope проверяет запрошенный scope токена пользователя. Scope admin не входит в scope
+// по умолчанию: его нужно запросить явно, а через клиента - только если он есть в scope клиента
+func grantUserScope(requested string, client storage.Client) (string, bool) {
+
+	allowed := userScopes(client)
+
+	if strings.TrimSpace(requested) != "" && (client.ID == "" || slices.Contains(client.Scopes, token.ScopeAdmin)) {
+		allowed = append(allowed, token.ScopeAdmin)
+	}
+
+	return token.GrantScope(requested, allowed)
+}
+
+// operatorScope убирает scope admin у пользователей без роли оператора
+func operatorScope(scope string, roles []string) string {
+
+	if slices.Contains(roles, model.RoleAdmin) || slices.Contains(roles, model.RoleSupport) {
+		return scope
+	}
+
+	return strings.Join(slices.DeleteFunc(strings.Fields(scope), func(granted string) bool {
+		return granted == token.ScopeAdmin
+	}), " ")
+}
+
+// trustedIssuer сообщает, выдаются ли токены по одному user_id (AUTH_TRUSTED_ISSUER).
+// Режим для развёртывания за сервисом, который сам аутентифицирует пользователей
+func trustedIssuer() bool {
+
+	trusted, _ := strconv.ParseBool(os.Getenv("AUTH_TRUSTED_ISSUER"))
+
+	return trusted
+}
@@ -0,0 +1,42 @@
+package endpoint_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/redeflesq/auth-example/internal/token"
+)
+
+func TestClaimsProviderFailureAbortsIssuing(t *testing.T) {
+
+	provider := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		http.Error(writer, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer provider.Close()
+
+	srv, _ := newTestServer(t)
+
+	_, access_token, refresh_token := signIn(t, srv, "alice")
+
+	token.SetClaimsProvider(token.NewHTTPClaimsProvider(provider.URL, time.Second))
+	t.Cleanup(func() { token.SetClaimsProvider(nil) })
+
+	status, response := call(t, srv, "POST", "/auth/token", "", map[string]string{"username": "alice", "password": testPassword})
+	if status != http.StatusInternalServerError {
+		t.Fatalf("token: status %d, %v", status, response)
+	}
+
+	status, response = call(t, srv, "POST", "/auth/refresh", access_token, map[string]string{"refresh_token": refresh_token})
+	if status != http.StatusInternalServerError {
+		t.Fatalf("refresh: status %d, %v", status, response)
+	}
+
+	// Неудачный refresh не обменивает пару: после восстановления провайдера она работает
+	token.SetClaimsProvider(nil)
+
+	if status, response = call(t, srv, "POST", "/auth/refresh", access_token, map[string]string{"refresh_token": refresh_token}); status != http.StatusOK {
+		t.Fatalf("refresh after the provider recovered: status %d, %v", status, response)
+	}
+}
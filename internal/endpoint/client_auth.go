@@ -0,0 +1,62 @@
+package endpoint
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/redeflesq/auth-example/internal/password"
+	"github.com/redeflesq/auth-example/internal/storage"
+)
+
+var errInvalidClient = errors.New("invalid client")
+
+// Методы аутентификации клиентов для discovery (RFC 8414, RFC 8705)
+var clientAuthMethods = []string{"client_secret_basic", "tls_client_auth"}
+
+// authenticateClient определяет API клиента по HTTP Basic (client_secret_basic) или по
+// проверенному сертификату mTLS (tls_client_auth). Если вызывающий не представился,
+// возвращает пустого клиента без ошибки, неверные учётные данные - errInvalidClient
+func (h *Handler) authenticateClient(req *http.Request) (storage.Client, error) {
+
+	if client_id, secret, ok := req.BasicAuth(); ok {
+
+		// RFC 6749, раздел 2.3.1: client_id и client_secret закодированы как form-urlencoded
+		client_id, err_id := url.QueryUnescape(client_id)
+		secret, err_secret := url.QueryUnescape(secret)
+
+		if err_id != nil || err_secret != nil {
+			return storage.Client{}, errInvalidClient
+		}
+
+		client, err := h.Store.FindClient(client_id)
+
+		if errors.Is(err, storage.ErrNotFound) {
+			return storage.Client{}, errInvalidClient
+		}
+
+		if err != nil {
+			return storage.Client{}, err
+		}
+
+		if client.SecretHash == "" || !password.VerifySecret(secret, client.SecretHash) {
+			return storage.Client{}, errInvalidClient
+		}
+
+		return client, nil
+	}
+
+	// VerifiedChains заполнен, только если сертификат проверен по TLS_CLIENT_CA_FILE
+	if req.TLS != nil && len(req.TLS.VerifiedChains) > 0 {
+
+		client, err := h.Store.FindClientByCertSubject(req.TLS.VerifiedChains[0][0].Subject.String())
+
+		if errors.Is(err, storage.ErrNotFound) {
+			return storage.Client{}, errInvalidClient
+		}
+
+		return client, err
+	}
+
+	return storage.Client{}, nil
+}
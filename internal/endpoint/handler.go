@@ -0,0 +1,16 @@
+package endpoint
+
+import (
+	"github.com/gorilla/mux"
+
+	"github.com/redeflesq/auth-example/internal/storage"
+)
+
+type Handler struct {
+	Store  storage.Store
+	Router *mux.Router // нужен для построения discovery документа по именованным маршрутам
+}
+
+func New(store storage.Store) *Handler {
+	return &Handler{Store: store}
+}
@@ -0,0 +1,39 @@
+package endpoint
+
+import (
+	"net/http"
+
+	"github.com/redeflesq/auth-example/internal/model"
+	"github.com/redeflesq/auth-example/internal/server"
+	"github.com/redeflesq/auth-example/internal/token"
+)
+
+// JWKS godoc
+// @Summary JSON Web Key Set
+// @Description Returns public keys for access token signature verification. Tokens reference the key by the kid header. Retired keys stay published until all tokens signed with them have expired. Empty for HS512.
+// @Tags Keys
+// @Produce json
+// @Success 200 {object} model.JWKSResponse "Public keys"
+// @Router /.well-known/jwks.json [get]
+// @Example response 200
+//
+//	{
+//	  "keys": [
+//	    {
+//	      "kty": "OKP",
+//	      "kid": "b0e4c2d1-5f0a-4f57-9d43-0d7c3b1f9a11",
+//	      "use": "sig",
+//	      "alg": "EdDSA",
+//	      "crv": "Ed25519",
+//	      "x": "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"
+//	    }
+//	  ]
+//	}
+func (h *Handler) JWKS(writer http.ResponseWriter, req *http.Request) {
+
+	writer.Header().Set("Cache-Control", "public, max-age=60")
+
+	var response model.JWKSResponse = token.JWKS()
+
+	server.SetResponse(writer, http.StatusOK, response)
+}
@@ -0,0 +1,46 @@
+package endpoint
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/redeflesq/auth-example/internal/model"
+)
+
+const (
+	TokenTypeAccess  = "access_token"
+	TokenTypeRefresh = "refresh_token"
+)
+
+// parseOAuthTokenRequest читает token и token_type_hint. RFC 7662 и RFC 7009
+// требуют application/x-www-form-urlencoded, JSON принимается для единообразия с /auth/*
+func parseOAuthTokenRequest(req *http.Request) (model.OAuthTokenRequest, bool) {
+
+	var oreq model.OAuthTokenRequest
+
+	if strings.HasPrefix(req.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(req.Body).Decode(&oreq); err != nil {
+			return oreq, false
+		}
+	} else {
+		if err := req.ParseForm(); err != nil {
+			return oreq, false
+		}
+		oreq.Token = req.PostForm.Get("token")
+		oreq.TokenTypeHint = req.PostForm.Get("token_type_hint")
+	}
+
+	return oreq, oreq.Token != ""
+}
+
+// tokenTypesByHint возвращает порядок, в котором стоит пробовать типы токена:
+// сначала подсказанный клиентом, затем остальные (RFC 7009, раздел 2.1)
+func tokenTypesByHint(hint string) []string {
+
+	if hint == TokenTypeRefresh {
+		return []string{TokenTypeRefresh, TokenTypeAccess}
+	}
+
+	return []string{TokenTypeAccess, TokenTypeRefresh}
+}
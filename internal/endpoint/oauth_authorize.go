@@ -0,0 +1,221 @@
+package endpoint
+
+import (
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/redeflesq/auth-example/internal/password"
+	"github.com/redeflesq/auth-example/internal/storage"
+	"github.com/redeflesq/auth-example/internal/token"
+)
+
+// AuthorizationCodeLifetime - срок жизни кода авторизации (RFC 6749, раздел 4.1.2 рекомендует не больше 10 минут)
+const AuthorizationCodeLifetime = 60 * time.Second
+
+// code_challenge для S256 - base64url без выравнивания от SHA-256, ровно 43 символа
+var codeChallengePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{43}$`)
+
+var authorizeTemplate = template.Must(template.New("authorize").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Sign in</title></head>
+<body>
+{{if .Error}}<p>{{.Error}}</p>{{end}}
+{{if .Form}}<form method="post">
+<p>Sign in to continue to <b>{{.Form.ClientID}}</b></p>
+<input type="hidden" name="response_type" value="{{.Form.ResponseType}}">
+<input type="hidden" name="client_id" value="{{.Form.ClientID}}">
+<input type="hidden" name="redirect_uri" value="{{.Form.RedirectURI}}">
+<input type="hidden" name="state" value="{{.Form.State}}">
+<input type="hidden" name="code_challenge" value="{{.Form.CodeChallenge}}">
+<input type="hidden" name="code_challenge_method" value="{{.Form.CodeChallengeMethod}}">
+<input type="hidden" name="scope" value="{{.Form.Scope}}">
+<p><input name="username" placeholder="Username" value="{{.Username}}" autocomplete="username" required></p>
+<p><input name="password" type="password" placeholder="Password" autocomplete="current-password" required></p>
+<p><button type="submit">Sign in</button></p>
+</form>{{end}}
+</body>
+</html>
+`))
+
+type authorizeRequest struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Scope               string
+}
+
+type authorizePage struct {
+	Form     *authorizeRequest
+	Username string
+	Error    string
+}
+
+// OAuthAuthorize godoc
+// @Summary Authorization endpoint (RFC 6749, authorization code with PKCE)
+// @Description GET renders a sign-in form, POST checks username and password and redirects the browser to redirect_uri with a one-time code, state and iss. Only response_type=code with code_challenge_method=S256 is supported. An unknown client_id or a redirect_uri that is not registered for the client is answered with an error page instead of a redirect, other errors are returned to redirect_uri as error and state.
+// @Tags OAuth
+// @Accept x-www-form-urlencoded
+// @Produce html
+// @Param response_type query string true "Must be code"
+// @Param client_id query string true "Registered client id"
+// @Param redirect_uri query string false "One of the client's registered redirect URIs, may be omitted if exactly one is registered"
+// @Param state query string false "Opaque value returned to the client"
+// @Param code_challenge query string true "BASE64URL(SHA256(code_verifier))"
+// @Param code_challenge_method query string true "Must be S256"
+// @Param scope query string false "Space-separated subset of the allowed scopes, all of them by default"
+// @Param username formData string false "Username, POST only"
+// @Param password formData string false "Password, POST only"
+// @Success 200 {string} string "Sign-in form"
+// @Success 302 {string} string "Redirect to redirect_uri with code or error"
+// @Failure 400 {string} string "Unknown client or invalid redirect_uri"
+// @Failure 401 {string} string "Invalid username or password, the form is shown again"
+// @Router /oauth/authorize [get]
+// @Router /oauth/authorize [post]
+// @Example request
+//
+//	response_type=code&client_id=web-app&redirect_uri=https%3A%2F%2Fapp.example.com%2Fcallback&state=af0ifjsldkj&code_challenge=E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM&code_challenge_method=S256&scope=profile%20sessions%3Aread
+func (h *Handler) OAuthAuthorize(writer http.ResponseWriter, req *http.Request) {
+
+	// Форма ввода пароля не должна встраиваться в чужие страницы (clickjacking)
+	writer.Header().Set("X-Frame-Options", "DENY")
+	writer.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+	writer.Header().Set("Cache-Control", "no-store")
+
+	if err := req.ParseForm(); err != nil {
+		renderAuthorizePage(writer, http.StatusBadRequest, authorizePage{Error: "Invalid request"})
+		return
+	}
+
+	areq := authorizeRequest{
+		ResponseType:        req.Form.Get("response_type"),
+		ClientID:            req.Form.Get("client_id"),
+		RedirectURI:         req.Form.Get("redirect_uri"),
+		State:               req.Form.Get("state"),
+		CodeChallenge:       req.Form.Get("code_challenge"),
+		CodeChallengeMethod: req.Form.Get("code_challenge_method"),
+		Scope:               req.Form.Get("scope"),
+	}
+
+	client, err := h.Store.FindClient(areq.ClientID)
+	if errors.Is(err, storage.ErrNotFound) {
+		renderAuthorizePage(writer, http.StatusBadRequest, authorizePage{Error: "Unknown client"})
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		renderAuthorizePage(writer, http.StatusInternalServerError, authorizePage{Error: "Internal server error"})
+		return
+	}
+
+	// Без проверенного redirect_uri перенаправлять нельзя: это был бы открытый редирект
+	if areq.RedirectURI == "" && len(client.RedirectURIs) == 1 {
+		areq.RedirectURI = client.RedirectURIs[0]
+	}
+
+	if !slices.Contains(client.RedirectURIs, areq.RedirectURI) {
+		renderAuthorizePage(writer, http.StatusBadRequest, authorizePage{Error: "Invalid redirect_uri"})
+		return
+	}
+
+	if areq.ResponseType != "code" {
+		redirectAuthorize(writer, req, areq, url.Values{"error": {"unsupported_response_type"}})
+		return
+	}
+
+	if areq.CodeChallengeMethod != "S256" || !codeChallengePattern.MatchString(areq.CodeChallenge) {
+		redirectAuthorize(writer, req, areq, url.Values{
+			"error":             {"invalid_request"},
+			"error_description": {"code_challenge with code_challenge_method=S256 is required"},
+		})
+		return
+	}
+
+	scope, ok := grantUserScope(areq.Scope, client)
+	if !ok {
+		redirectAuthorize(writer, req, areq, url.Values{"error": {"invalid_scope"}})
+		return
+	}
+
+	if req.Method != http.MethodPost {
+		renderAuthorizePage(writer, http.StatusOK, authorizePage{Form: &areq})
+		return
+	}
+
+	username := req.PostForm.Get("username")
+
+	user, err := h.authenticate(username, req.PostForm.Get("password"))
+	if errors.Is(err, errInvalidCredentials) {
+		renderAuthorizePage(writer, http.StatusUnauthorized, authorizePage{Form: &areq, Username: username, Error: "Invalid username or password"})
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		redirectAuthorize(writer, req, areq, url.Values{"error": {"server_error"}})
+		return
+	}
+
+	code, err := password.GenerateSecret()
+	if err == nil {
+		err = h.Store.SaveAuthorizationCode(storage.AuthorizationCode{
+			CodeHash:      password.HashSecret(code),
+			ClientID:      client.ID,
+			UserID:        user.ID,
+			RedirectURI:   areq.RedirectURI,
+			CodeChallenge: areq.CodeChallenge,
+			Scope:         scope,
+			ExpiresAt:     time.Now().Add(AuthorizationCodeLifetime),
+		})
+	}
+	if err != nil {
+		log.Println(err)
+		redirectAuthorize(writer, req, areq, url.Values{"error": {"server_error"}})
+		return
+	}
+
+	redirectAuthorize(writer, req, areq, url.Values{"code": {code}})
+}
+
+// redirectAuthorize возвращает браузер на redirect_uri, добавляя state и iss (RFC 9207)
+func redirectAuthorize(writer http.ResponseWriter, req *http.Request, areq authorizeRequest, params url.Values) {
+
+	redirect_uri, err := url.Parse(areq.RedirectURI)
+	if err != nil {
+		renderAuthorizePage(writer, http.StatusBadRequest, authorizePage{Error: "Invalid redirect_uri"})
+		return
+	}
+
+	query := redirect_uri.Query()
+
+	for key, values := range params {
+		query[key] = values
+	}
+
+	if areq.State != "" {
+		query.Set("state", areq.State)
+	}
+
+	query.Set("iss", token.Issuer())
+
+	redirect_uri.RawQuery = query.Encode()
+
+	http.Redirect(writer, req, redirect_uri.String(), http.StatusFound)
+}
+
+func renderAuthorizePage(writer http.ResponseWriter, status int, page authorizePage) {
+
+	writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	writer.WriteHeader(status)
+
+	if err := authorizeTemplate.Execute(writer, page); err != nil {
+		log.Println(err)
+	}
+}
@@ -0,0 +1,350 @@
+package endpoint
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/redeflesq/auth-example/internal/model"
+	"github.com/redeflesq/auth-example/internal/password"
+	"github.com/redeflesq/auth-example/internal/server"
+	"github.com/redeflesq/auth-example/internal/storage"
+	"github.com/redeflesq/auth-example/internal/token"
+)
+
+const GrantTypeDeviceCode = "urn:ietf:params:oauth:grant-type:device_code"
+
+// Срок жизни запроса устройства и минимальный интервал опроса
+const (
+	DeviceCodeLifetime = 10 * time.Minute
+	DeviceCodeInterval = 5 * time.Second
+)
+
+// RFC 8628, раздел 6.1: user_code из согласных без гласных, чтобы не складывались слова,
+// 20^8 вариантов. Показывается как XXXX-XXXX
+const userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+
+// OAuthDeviceAuthorization godoc
+// @Summary Device authorization request (RFC 8628)
+// @Description Starts sign-in on a device without a browser (TV, CLI). Returns a device_code for polling /oauth/token with grant_type=urn:ietf:params:oauth:grant-type:device_code and a user_code the user confirms at verification_uri from another device. Confidential clients authenticate with HTTP Basic or an mTLS certificate, public clients only send client_id.
+// @Tags OAuth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param client_id formData string false "Client id, required for public clients"
+// @Param scope formData string false "Space-separated subset of the allowed scopes, all of them by default. The admin scope is never granted to devices"
+// @Success 200 {object} model.DeviceAuthorizationResponse "Device and user codes"
+// @Failure 400 {object} model.ErrorResponse "invalid_request or invalid_scope"
+// @Failure 401 {object} model.ErrorResponse "invalid_client"
+// @Failure 500 {object} model.ErrorResponse "server_error"
+// @Router /oauth/device_authorization [post]
+// @Example request
+//
+//	client_id=cli
+//
+// @Example response 200
+//
+//	{
+//	  "device_code": "GmRhmhcxhwAzkoEqiMEg_DnyEysNkuNhszIySk9eS",
+//	  "user_code": "WDJB-MJHT",
+//	  "verification_uri": "https://auth.example.com/oauth/device",
+//	  "verification_uri_complete": "https://auth.example.com/oauth/device?user_code=WDJB-MJHT",
+//	  "expires_in": 600,
+//	  "interval": 5
+//	}
+func (h *Handler) OAuthDeviceAuthorization(writer http.ResponseWriter, req *http.Request) {
+
+	writer.Header().Set("Cache-Control", "no-store")
+
+	if err := req.ParseForm(); err != nil {
+		server.SetResponse(writer, http.StatusBadRequest, model.ErrorResponse{Error: "invalid_request"})
+		return
+	}
+
+	client, err := h.oauthClient(req)
+	if errors.Is(err, errInvalidClient) {
+		writer.Header().Set("WWW-Authenticate", `Basic realm="auth"`)
+		server.SetResponse(writer, http.StatusUnauthorized, model.ErrorResponse{Error: "invalid_client"})
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		server.SetResponse(writer, http.StatusInternalServerError, model.ErrorResponse{Error: "server_error"})
+		return
+	}
+
+	// Scope admin устройству не выдаётся: user_code подтверждается по ссылке, и оператора
+	// можно обманом заставить одобрить чужое устройство
+	scope, ok := token.GrantScope(req.PostForm.Get("scope"), userScopes(client))
+	if !ok {
+		server.SetResponse(writer, http.StatusBadRequest, model.ErrorResponse{Error: "invalid_scope"})
+		return
+	}
+
+	device_code, err := password.GenerateSecret()
+	if err != nil {
+		log.Println(err)
+		server.SetResponse(writer, http.StatusInternalServerError, model.ErrorResponse{Error: "server_error"})
+		return
+	}
+
+	user_code, err := generateUserCode()
+	if err != nil {
+		log.Println(err)
+		server.SetResponse(writer, http.StatusInternalServerError, model.ErrorResponse{Error: "server_error"})
+		return
+	}
+
+	ip, _, _ := net.SplitHostPort(req.RemoteAddr)
+	err = h.Store.SaveDeviceCode(storage.DeviceCode{
+		CodeHash:  password.HashSecret(device_code),
+		UserCode:  user_code,
+		ClientID:  client.ID,
+		Status:    storage.DeviceCodePending,
+		UserAgent: req.UserAgent(),
+		IPAddress: ip,
+		Scope:     scope,
+		ExpiresAt: time.Now().Add(DeviceCodeLifetime),
+	})
+	if err != nil {
+		log.Println(err)
+		server.SetResponse(writer, http.StatusInternalServerError, model.ErrorResponse{Error: "server_error"})
+		return
+	}
+
+	base, _ := baseURL(req)
+	verification_uri := h.routeURL(base, RouteDeviceVerification)
+
+	server.SetResponse(writer, http.StatusOK, model.DeviceAuthorizationResponse{
+		DeviceCode:              device_code,
+		UserCode:                formatUserCode(user_code),
+		VerificationURI:         verification_uri,
+		VerificationURIComplete: verification_uri + "?user_code=" + url.QueryEscape(formatUserCode(user_code)),
+		ExpiresIn:               int64(DeviceCodeLifetime.Seconds()),
+		Interval:                int64(DeviceCodeInterval.Seconds()),
+	})
+}
+
+// OAuthDevice godoc
+// @Summary Show a pending device request
+// @Description Returns the client, the requested scope and the device (User-Agent, IP address) that requested the user_code, so the user can check it before approving. Requires valid JWT in Authorization header with the sessions:write scope.
+// @Tags OAuth
+// @Security BearerAuth
+// @Produce json
+// @Param user_code query string true "User code shown on the device, case and dash insensitive"
+// @Success 200 {object} model.DeviceVerificationResponse "Pending device request"
+// @Failure 401 {object} model.ErrorResponse "Unauthorized - invalid or revoked tokens"
+// @Failure 403 {object} model.ErrorResponse "Insufficient scope"
+// @Failure 404 {object} model.ErrorResponse "Device code not found"
+// @Failure 500 {object} model.ErrorResponse "Internal server error"
+// @Router /oauth/device [get]
+// @Example response 200
+//
+//	{
+//	  "user_code": "WDJB-MJHT",
+//	  "client_id": "cli",
+//	  "user_agent": "deploy-cli/1.4",
+//	  "ip_address": "10.0.0.5",
+//	  "scope": "profile sessions:read",
+//	  "expires_at": "2025-07-05T20:10:00Z"
+//	}
+func (h *Handler) OAuthDevice(writer http.ResponseWriter, req *http.Request) {
+
+	code, err := h.Store.FindDeviceCode(normalizeUserCode(req.URL.Query().Get("user_code")))
+	if errors.Is(err, storage.ErrNotFound) || (err == nil && code.Status != storage.DeviceCodePending) {
+		server.SetResponse(writer, http.StatusNotFound, model.ErrorResponse{Error: "Device code not found"})
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		server.SetResponse(writer, http.StatusInternalServerError, model.ErrorResponse{Error: "Failed to find device code"})
+		return
+	}
+
+	server.SetResponse(writer, http.StatusOK, model.DeviceVerificationResponse{
+		UserCode:  formatUserCode(code.UserCode),
+		ClientID:  code.ClientID,
+		UserAgent: code.UserAgent,
+		IPAddress: code.IPAddress,
+		Scope:     code.Scope,
+		ExpiresAt: code.ExpiresAt,
+	})
+}
+
+// OAuthDeviceVerify godoc
+// @Summary Approve or deny a device
+// @Description Approves (approve=true) or denies the device request with the given user_code on behalf of the current user. After approval the device receives a tokens pair for the user on its next poll. Requires valid JWT in Authorization header with the sessions:write scope.
+// @Tags OAuth
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param request body model.DeviceVerificationRequest true "User code and decision"
+// @Success 200 {object} model.SuccessResponse "Device approved or denied"
+// @Failure 400 {object} model.ErrorResponse "Invalid request"
+// @Failure 401 {object} model.ErrorResponse "Unauthorized - invalid or revoked tokens"
+// @Failure 403 {object} model.ErrorResponse "Insufficient scope"
+// @Failure 404 {object} model.ErrorResponse "Device code not found"
+// @Failure 500 {object} model.ErrorResponse "Internal server error"
+// @Router /oauth/device [post]
+// @Example request
+//
+//	{
+//	  "user_code": "WDJB-MJHT",
+//	  "approve": true
+//	}
+//
+// @Example response 200
+//
+//	{
+//	  "success": "Device approved"
+//	}
+func (h *Handler) OAuthDeviceVerify(writer http.ResponseWriter, req *http.Request) {
+
+	claims, ok := req.Context().Value("claims").(*model.Claims)
+
+	if !ok {
+		server.SetResponse(writer, http.StatusUnauthorized, model.ErrorResponse{Error: "Authorization required"})
+		return
+	}
+
+	var vreq model.DeviceVerificationRequest
+	if err := json.NewDecoder(req.Body).Decode(&vreq); err != nil {
+		server.SetResponse(writer, http.StatusBadRequest, model.ErrorResponse{Error: "Invalid request"})
+		return
+	}
+
+	status, success := storage.DeviceCodeDenied, "Device denied"
+	if vreq.Approve {
+		status, success = storage.DeviceCodeApproved, "Device approved"
+	}
+
+	err := h.Store.ResolveDeviceCode(normalizeUserCode(vreq.UserCode), claims.UserID, status)
+	if errors.Is(err, storage.ErrNotFound) {
+		server.SetResponse(writer, http.StatusNotFound, model.ErrorResponse{Error: "Device code not found"})
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		server.SetResponse(writer, http.StatusInternalServerError, model.ErrorResponse{Error: "Failed to update device code"})
+		return
+	}
+
+	server.SetResponse(writer, http.StatusOK, model.SuccessResponse{Success: success})
+}
+
+// grantDeviceCode отвечает на опрос устройства. Пока пользователь не подтвердил запрос,
+// устройство получает authorization_pending, а при опросе чаще interval - slow_down
+func (h *Handler) grantDeviceCode(writer http.ResponseWriter, req *http.Request, client storage.Client) {
+
+	device_code := req.PostForm.Get("device_code")
+	if device_code == "" {
+		server.SetResponse(writer, http.StatusBadRequest, model.ErrorResponse{Error: "invalid_request"})
+		return
+	}
+
+	code_hash := password.HashSecret(device_code)
+
+	code, err := h.Store.PollDeviceCode(code_hash)
+	if errors.Is(err, storage.ErrNotFound) || (err == nil && code.ClientID != client.ID) {
+		server.SetResponse(writer, http.StatusBadRequest, model.ErrorResponse{Error: "invalid_grant"})
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		server.SetResponse(writer, http.StatusInternalServerError, model.ErrorResponse{Error: "server_error"})
+		return
+	}
+
+	if !code.ExpiresAt.After(time.Now()) {
+		server.SetResponse(writer, http.StatusBadRequest, model.ErrorResponse{Error: "expired_token"})
+		return
+	}
+
+	if code.Status == storage.DeviceCodePending {
+
+		if !code.LastPolledAt.IsZero() && time.Since(code.LastPolledAt) < DeviceCodeInterval {
+			server.SetResponse(writer, http.StatusBadRequest, model.ErrorResponse{Error: "slow_down"})
+			return
+		}
+
+		server.SetResponse(writer, http.StatusBadRequest, model.ErrorResponse{Error: "authorization_pending"})
+		return
+	}
+
+	// Решение пользователя забирается один раз, параллельный опрос получит invalid_grant
+	code, err = h.Store.ConsumeDeviceCode(code_hash)
+	if errors.Is(err, storage.ErrNotFound) {
+		server.SetResponse(writer, http.StatusBadRequest, model.ErrorResponse{Error: "invalid_grant"})
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		server.SetResponse(writer, http.StatusInternalServerError, model.ErrorResponse{Error: "server_error"})
+		return
+	}
+
+	if code.Status != storage.DeviceCodeApproved {
+		server.SetResponse(writer, http.StatusBadRequest, model.ErrorResponse{Error: "access_denied"})
+		return
+	}
+
+	// Опрос приходит с самого устройства, поэтому сессия запоминает его User-Agent и IP
+	tokens_pair, err := h.createSession(req, code.UserID, client.ID, code.Scope)
+	if err != nil {
+		log.Println(err)
+		server.SetResponse(writer, http.StatusInternalServerError, model.ErrorResponse{Error: "server_error"})
+		return
+	}
+
+	writeOAuthTokens(writer, tokens_pair)
+}
+
+func generateUserCode() (string, error) {
+
+	code := make([]byte, 0, 8)
+	random := make([]byte, 16)
+
+	for len(code) < cap(code) {
+
+		if _, err := rand.Read(random); err != nil {
+			return "", err
+		}
+
+		// Байты от 240 отбрасываются, иначе первые буквы алфавита выпадали бы чаще
+		for _, b := range random {
+			if int(b) < 256-256%len(userCodeAlphabet) && len(code) < cap(code) {
+				code = append(code, userCodeAlphabet[int(b)%len(userCodeAlphabet)])
+			}
+		}
+	}
+
+	return string(code), nil
+}
+
+// normalizeUserCode приводит введённый пользователем код к хранимому виду: без регистра и разделителей
+func normalizeUserCode(user_code string) string {
+
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' {
+			r -= 'a' - 'A'
+		}
+		if r < 'A' || r > 'Z' {
+			return -1
+		}
+		return r
+	}, user_code)
+}
+
+func formatUserCode(user_code string) string {
+
+	if len(user_code) != 8 {
+		return user_code
+	}
+
+	return user_code[:4] + "-" + user_code[4:]
+}
@@ -0,0 +1,32 @@
+package endpoint_test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/redeflesq/auth-example/internal/storage"
+	"github.com/redeflesq/auth-example/internal/token"
+)
+
+func TestOAuthDeviceAuthorizationRefusesAdminScope(t *testing.T) {
+
+	srv, store := newTestServer(t)
+
+	// Клиенту разрешён admin для входа по паролю, но не для устройства
+	err := store.SaveClient(storage.Client{ID: "tv", RedirectURIs: []string{"http://localhost/callback"}, Scopes: []string{"profile", token.ScopeAdmin}, CreatedAt: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, response := postForm(t, srv, "/oauth/device_authorization", "", "", url.Values{"client_id": {"tv"}, "scope": {"profile admin"}})
+	if status != http.StatusBadRequest || response["error"] != "invalid_scope" {
+		t.Fatalf("admin scope: status %d, %v", status, response)
+	}
+
+	status, response = postForm(t, srv, "/oauth/device_authorization", "", "", url.Values{"client_id": {"tv"}, "scope": {"profile"}})
+	if status != http.StatusOK || response["user_code"] == nil {
+		t.Fatalf("profile scope: status %d, %v", status, response)
+	}
+}
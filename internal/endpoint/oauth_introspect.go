@@ -0,0 +1,179 @@
+package endpoint
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+
+	"github.com/redeflesq/auth-example/internal/model"
+	"github.com/redeflesq/auth-example/internal/server"
+	"github.com/redeflesq/auth-example/internal/storage"
+	"github.com/redeflesq/auth-example/internal/token"
+)
+
+// OAuthIntrospect godoc
+// @Summary Token introspection (RFC 7662)
+// @Description Returns whether an access JWT or a base64 refresh token is currently active, and its metadata if it is. Inactive, unknown, expired and revoked tokens all produce {"active": false}. The caller must authenticate as a confidential client with HTTP Basic or an mTLS certificate. Access tokens issued for another audience (token exchange) are active only for the client in their aud.
+// @Tags OAuth
+// @Accept x-www-form-urlencoded
+// @Accept json
+// @Produce json
+// @Param token formData string true "Access or refresh token"
+// @Param token_type_hint formData string false "access_token or refresh_token"
+// @Success 200 {object} model.IntrospectionResponse "Token state"
+// @Failure 400 {object} model.ErrorResponse "Missing token"
+// @Failure 401 {object} model.ErrorResponse "invalid_client"
+// @Failure 500 {object} model.ErrorResponse "Internal server error"
+// @Router /oauth/introspect [post]
+// @Example request
+//
+//	token=eyJhbGciOiJIUzUxMiIs...&token_type_hint=access_token
+//
+// @Example response 200
+//
+//	{
+//	  "active": true,
+//	  "token_type": "access_token",
+//	  "sub": "123e4567-e89b-12d3-a456-426614174000",
+//	  "exp": 1751742000,
+//	  "iat": 1751741100,
+//	  "iss": "auth-example",
+//	  "pair_id": "5b0f9a3e-2c4d-4b7a-9f10-3c2e8d1a7b64",
+//	  "scope": "profile sessions:read sessions:write"
+//	}
+//
+// @Example response 400
+//
+//	{
+//	  "error": "invalid_request"
+//	}
+//
+// @Example response 401
+//
+//	{
+//	  "error": "invalid_client"
+//	}
+func (h *Handler) OAuthIntrospect(writer http.ResponseWriter, req *http.Request) {
+
+	// RFC 7662, раздел 2.1: без аутентификации вызывающего endpoint позволял бы
+	// кому угодно перебирать токены
+	client, err := h.authenticateClient(req)
+	if err != nil && !errors.Is(err, errInvalidClient) {
+		log.Println(err)
+		server.SetResponse(writer, http.StatusInternalServerError, model.ErrorResponse{Error: "server_error"})
+		return
+	}
+	if err != nil || client.ID == "" {
+		writer.Header().Set("WWW-Authenticate", `Basic realm="auth"`)
+		server.SetResponse(writer, http.StatusUnauthorized, model.ErrorResponse{Error: "invalid_client"})
+		return
+	}
+
+	oreq, ok := parseOAuthTokenRequest(req)
+	if !ok {
+		server.SetResponse(writer, http.StatusBadRequest, model.ErrorResponse{Error: "invalid_request"})
+		return
+	}
+
+	writer.Header().Set("Cache-Control", "no-store")
+
+	for _, token_type := range tokenTypesByHint(oreq.TokenTypeHint) {
+
+		var response model.IntrospectionResponse
+		var err error
+
+		if token_type == TokenTypeAccess {
+			response, err = h.introspectAccessToken(oreq.Token, client)
+		} else {
+			response, err = h.introspectRefreshToken(oreq.Token)
+		}
+
+		if err != nil {
+			log.Println(err)
+			server.SetResponse(writer, http.StatusInternalServerError, model.ErrorResponse{Error: "server_error"})
+			return
+		}
+
+		if response.Active {
+			server.SetResponse(writer, http.StatusOK, response)
+			return
+		}
+	}
+
+	server.SetResponse(writer, http.StatusOK, model.IntrospectionResponse{Active: false})
+}
+
+// introspectAccessToken раскрывает токен, выпущенный для самого сервиса или для вызывающего клиента.
+// Токен другого сервиса для вызывающего неактивен
+func (h *Handler) introspectAccessToken(token_str string, client storage.Client) (model.IntrospectionResponse, error) {
+
+	claims := &model.Claims{}
+
+	access_token, err := token.ParseJWT(token_str, claims)
+	if err != nil || !access_token.Valid {
+		return model.IntrospectionResponse{}, nil
+	}
+
+	if !server.AudienceAccepted(claims) && !slices.Contains(claims.Audience, client.ID) {
+		return model.IntrospectionResponse{}, nil
+	}
+
+	revoked, err := server.AccessTokenIsRevoked(h.Store, claims)
+	if err != nil || revoked {
+		return model.IntrospectionResponse{}, err
+	}
+
+	sub := claims.UserID
+	if claims.IsClient() {
+		sub = claims.Subject
+	}
+
+	return model.IntrospectionResponse{
+		Active:    true,
+		TokenType: TokenTypeAccess,
+		Sub:       sub,
+		Exp:       claims.ExpiresAt.Unix(),
+		Iat:       claims.IssuedAt.Unix(),
+		Iss:       claims.Issuer,
+		PairID:    claims.PairID,
+		ClientID:  claims.AuthorizedParty,
+		TokenUse:  claims.TokenUse,
+		Aud:       claims.Audience,
+		Act:       claims.Actor,
+		Scope:     claims.Scope,
+		Roles:     claims.Roles,
+	}, nil
+}
+
+func (h *Handler) introspectRefreshToken(token_str string) (model.IntrospectionResponse, error) {
+
+	pair_id, token_data, err := token.DecodeRefreshToken(token_str)
+	if err != nil {
+		return model.IntrospectionResponse{}, nil
+	}
+
+	stored_token, err := h.Store.FindRefreshTokenByPairID(pair_id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return model.IntrospectionResponse{}, nil
+	}
+	if err != nil {
+		return model.IntrospectionResponse{}, err
+	}
+
+	if !stored_token.IsActive() || !token.VerifyRefreshToken(token_data, stored_token.TokenHash, stored_token.UserID) {
+		return model.IntrospectionResponse{}, nil
+	}
+
+	return model.IntrospectionResponse{
+		Active:    true,
+		TokenType: TokenTypeRefresh,
+		Sub:       stored_token.UserID,
+		Exp:       stored_token.ExpiresAt.Unix(),
+		Iat:       stored_token.CreatedAt.Unix(),
+		Iss:       token.Issuer(),
+		PairID:    stored_token.PairID,
+		ClientID:  stored_token.ClientID,
+		Scope:     sessionScope(stored_token),
+	}, nil
+}
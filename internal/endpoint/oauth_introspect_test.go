@@ -0,0 +1,99 @@
+package endpoint_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redeflesq/auth-example/internal/password"
+	"github.com/redeflesq/auth-example/internal/storage"
+)
+
+const (
+	testClientID     = "introspect-client"
+	testClientSecret = "introspect-client-secret"
+)
+
+// introspect отправляет токен на /oauth/introspect от имени клиента, пустой client_id - анонимно
+func introspect(t *testing.T, srv *httptest.Server, client_id, secret, token_str string) (int, http.Header, map[string]any) {
+
+	t.Helper()
+
+	req, err := http.NewRequest("POST", srv.URL+"/oauth/introspect", strings.NewReader(url.Values{"token": {token_str}}.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if client_id != "" {
+		req.SetBasicAuth(client_id, secret)
+	}
+
+	response, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	var result map[string]any
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+
+	return response.StatusCode, response.Header, result
+}
+
+func TestOAuthIntrospectRequiresClient(t *testing.T) {
+
+	srv, store := newTestServer(t)
+
+	err := store.SaveClient(storage.Client{ID: testClientID, SecretHash: password.HashSecret(testClientSecret), CreatedAt: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, access_token, refresh_token := signIn(t, srv, "alice")
+
+	for _, token_str := range []string{access_token, refresh_token} {
+
+		status, header, response := introspect(t, srv, "", "", token_str)
+		if status != http.StatusUnauthorized || response["error"] != "invalid_client" || !strings.Contains(header.Get("WWW-Authenticate"), "Basic") {
+			t.Fatalf("anonymous: status %d, %v", status, response)
+		}
+
+		if status, _, response = introspect(t, srv, testClientID, "wrong secret", token_str); status != http.StatusUnauthorized {
+			t.Fatalf("wrong secret: status %d, %v", status, response)
+		}
+
+		if status, _, response = introspect(t, srv, testClientID, testClientSecret, token_str); status != http.StatusOK || response["active"] != true {
+			t.Fatalf("authenticated client: status %d, %v", status, response)
+		}
+	}
+}
+
+func TestOAuthIntrospectRestrictsAudience(t *testing.T) {
+
+	srv, store := newTestServer(t)
+
+	err := store.SaveClient(storage.Client{ID: testClientID, SecretHash: password.HashSecret(testClientSecret), CreatedAt: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, access_token, _ := signIn(t, srv, "alice")
+
+	exchanged := exchangeToken(t, srv, store, access_token)
+
+	// Токен для reports-service раскрывается только ему самому
+	if status, _, response := introspect(t, srv, testClientID, testClientSecret, exchanged); status != http.StatusOK || response["active"] != false {
+		t.Fatalf("other client: status %d, %v", status, response)
+	}
+
+	if status, _, response := introspect(t, srv, downstreamClientID, downstreamClientSecret, exchanged); status != http.StatusOK || response["active"] != true {
+		t.Fatalf("audience client: status %d, %v", status, response)
+	}
+}
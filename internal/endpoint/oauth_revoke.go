@@ -0,0 +1,121 @@
+package endpoint
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/redeflesq/auth-example/internal/model"
+	"github.com/redeflesq/auth-example/internal/server"
+	"github.com/redeflesq/auth-example/internal/storage"
+	"github.com/redeflesq/auth-example/internal/token"
+)
+
+// OAuthRevoke godoc
+// @Summary Token revocation (RFC 7009)
+// @Description Revokes an access JWT or a refresh token. Revoking a refresh token also revokes the access token issued with it. Does not require an Authorization header, so a client that only holds the refresh token can still sign out. Access tokens issued for other audiences (token exchange) are not revoked, since they share the pair_id of the original session. Unknown or invalid tokens are also answered with 200.
+// @Tags OAuth
+// @Accept x-www-form-urlencoded
+// @Accept json
+// @Produce json
+// @Param token formData string true "Access or refresh token"
+// @Param token_type_hint formData string false "access_token or refresh_token"
+// @Success 200 {object} model.SuccessResponse "Token revoked or was not valid"
+// @Failure 400 {object} model.ErrorResponse "Missing token"
+// @Failure 500 {object} model.ErrorResponse "Internal server error"
+// @Router /oauth/revoke [post]
+// @Example request
+//
+//	token=dGhpcyBpcyBhIHNhbXBsZSByZWZyZXNoIHRva2Vu&token_type_hint=refresh_token
+//
+// @Example response 200
+//
+//	{
+//	  "success": "Token revoked"
+//	}
+//
+// @Example response 400
+//
+//	{
+//	  "error": "invalid_request"
+//	}
+func (h *Handler) OAuthRevoke(writer http.ResponseWriter, req *http.Request) {
+
+	oreq, ok := parseOAuthTokenRequest(req)
+	if !ok {
+		server.SetResponse(writer, http.StatusBadRequest, model.ErrorResponse{Error: "invalid_request"})
+		return
+	}
+
+	for _, token_type := range tokenTypesByHint(oreq.TokenTypeHint) {
+
+		var revoked bool
+		var err error
+
+		if token_type == TokenTypeAccess {
+			revoked, err = h.revokeAccessToken(oreq.Token)
+		} else {
+			revoked, err = h.revokeRefreshToken(oreq.Token)
+		}
+
+		if err != nil {
+			log.Println(err)
+			server.SetResponse(writer, http.StatusInternalServerError, model.ErrorResponse{Error: "server_error"})
+			return
+		}
+
+		if revoked {
+			break
+		}
+	}
+
+	// Ответ не раскрывает, был ли токен действительным (RFC 7009, раздел 2.2)
+	server.SetResponse(writer, http.StatusOK, model.SuccessResponse{Success: "Token revoked"})
+}
+
+func (h *Handler) revokeAccessToken(token_str string) (bool, error) {
+
+	claims := &model.Claims{}
+
+	// Истекший токен отзывать не нужно, он и так не пройдёт проверку
+	access_token, err := token.ParseJWT(token_str, claims)
+	if err != nil || !access_token.Valid {
+		return false, nil
+	}
+
+	// Обменянный токен сохраняет pair_id субъекта, и его отзыв завершил бы исходную сессию.
+	// Отзываются только токены, выпущенные для самого сервиса
+	if !server.AudienceAccepted(claims) {
+		return false, nil
+	}
+
+	return true, h.Store.RevokeAccessToken(claims.PairID, claims.ExpiresAt.Time)
+}
+
+func (h *Handler) revokeRefreshToken(token_str string) (bool, error) {
+
+	pair_id, token_data, err := token.DecodeRefreshToken(token_str)
+	if err != nil {
+		return false, nil
+	}
+
+	stored_token, err := h.Store.FindRefreshTokenByPairID(pair_id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if !token.VerifyRefreshToken(token_data, stored_token.TokenHash, stored_token.UserID) {
+		return false, nil
+	}
+
+	if err = h.Store.RevokeRefreshTokens(pair_id); err != nil {
+		return false, err
+	}
+
+	// Access токен выдан вместе с refresh, его точный срок неизвестен
+	return true, h.Store.RevokeAccessToken(pair_id, time.Now().Add(token.JWTExpiration()))
+}
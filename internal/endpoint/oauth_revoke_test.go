@@ -0,0 +1,104 @@
+package endpoint_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redeflesq/auth-example/internal/password"
+	"github.com/redeflesq/auth-example/internal/storage"
+)
+
+const (
+	downstreamClientID     = "reports-service"
+	downstreamClientSecret = "reports-service-secret"
+)
+
+// postForm отправляет form-urlencoded запрос от имени клиента, пустой client_id - анонимно
+func postForm(t *testing.T, srv *httptest.Server, path, client_id, secret string, form url.Values) (int, map[string]any) {
+
+	t.Helper()
+
+	req, err := http.NewRequest("POST", srv.URL+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if client_id != "" {
+		req.SetBasicAuth(client_id, secret)
+	}
+
+	response, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	var result map[string]any
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+
+	return response.StatusCode, result
+}
+
+// exchangeToken регистрирует сервис reports-service и обменивает для него токен пользователя
+func exchangeToken(t *testing.T, srv *httptest.Server, store storage.Store, access_token string) string {
+
+	t.Helper()
+
+	err := store.SaveClient(storage.Client{ID: downstreamClientID, SecretHash: password.HashSecret(downstreamClientSecret), CreatedAt: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, response := postForm(t, srv, "/oauth/token", downstreamClientID, downstreamClientSecret, url.Values{
+		"grant_type":         {"urn:ietf:params:oauth:grant-type:token-exchange"},
+		"subject_token":      {access_token},
+		"subject_token_type": {"urn:ietf:params:oauth:token-type:access_token"},
+		"audience":           {downstreamClientID},
+	})
+	if status != http.StatusOK {
+		t.Fatalf("exchange: status %d, %v", status, response)
+	}
+
+	return response["access_token"].(string)
+}
+
+func TestOAuthRevokeAccessToken(t *testing.T) {
+
+	srv, _ := newTestServer(t)
+
+	_, access_token, _ := signIn(t, srv, "alice")
+
+	if status, response := postForm(t, srv, "/oauth/revoke", "", "", url.Values{"token": {access_token}}); status != http.StatusOK {
+		t.Fatalf("revoke: status %d, %v", status, response)
+	}
+
+	if status, _ := call(t, srv, "GET", "/auth/me", access_token, nil); status != http.StatusUnauthorized {
+		t.Fatalf("me after revoke: status %d", status)
+	}
+}
+
+func TestOAuthRevokeIgnoresExchangedToken(t *testing.T) {
+
+	srv, store := newTestServer(t)
+
+	_, access_token, _ := signIn(t, srv, "alice")
+
+	exchanged := exchangeToken(t, srv, store, access_token)
+
+	// Обменянный токен несёт pair_id сессии, но сервис-получатель не может ею распоряжаться
+	if status, response := postForm(t, srv, "/oauth/revoke", "", "", url.Values{"token": {exchanged}, "token_type_hint": {"access_token"}}); status != http.StatusOK {
+		t.Fatalf("revoke: status %d, %v", status, response)
+	}
+
+	if status, response := call(t, srv, "GET", "/auth/me", access_token, nil); status != http.StatusOK {
+		t.Fatalf("session revoked with the exchanged token: status %d, %v", status, response)
+	}
+}
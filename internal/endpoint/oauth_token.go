@@ -0,0 +1,280 @@
+package endpoint
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+
+	"github.com/redeflesq/auth-example/internal/model"
+	"github.com/redeflesq/auth-example/internal/password"
+	"github.com/redeflesq/auth-example/internal/server"
+	"github.com/redeflesq/auth-example/internal/storage"
+	"github.com/redeflesq/auth-example/internal/token"
+)
+
+const (
+	GrantTypeAuthorizationCode = "authorization_code"
+	GrantTypeClientCredentials = "client_credentials"
+)
+
+// oauthGrant обрабатывает запрос к /oauth/token для одного grant_type после аутентификации клиента
+type oauthGrant func(h *Handler, writer http.ResponseWriter, req *http.Request, client storage.Client)
+
+// oauthGrants - поддерживаемые /oauth/token grant_type, discovery публикует их же
+var oauthGrants = map[string]oauthGrant{
+	GrantTypeAuthorizationCode: (*Handler).grantAuthorizationCode,
+	GrantTypeClientCredentials: (*Handler).grantClientCredentials,
+	GrantTypeDeviceCode:        (*Handler).grantDeviceCode,
+	GrantTypeTokenExchange:     (*Handler).grantTokenExchange,
+}
+
+// RFC 7636, раздел 4.1: 43-128 символов из [A-Z] / [a-z] / [0-9] / "-" / "." / "_" / "~"
+var codeVerifierPattern = regexp.MustCompile(`^[A-Za-z0-9._~-]{43,128}$`)
+
+// OAuthToken godoc
+// @Summary OAuth2 token endpoint (RFC 6749)
+// @Description Exchanges an authorization code for access and refresh tokens, or issues a machine access token to an authenticated client (grant_type=client_credentials, no refresh token, sub is the client_id, token_use is client). Devices poll it with grant_type=urn:ietf:params:oauth:grant-type:device_code and the device_code from /oauth/device_authorization, getting authorization_pending until the user approves and slow_down when polling faster than the interval. A service authenticated as a client exchanges a user's access token (grant_type=urn:ietf:params:oauth:grant-type:token-exchange, RFC 8693) for a token restricted to a registered downstream service in audience, with the caller recorded in act. The exchanged token keeps the subject's pair_id, so it is revoked with the original session, expires no later than the subject token and is not accepted by this service's own endpoints. The code_verifier must match the code_challenge sent to /oauth/authorize (PKCE, S256), client_id and redirect_uri must match the ones the code was issued for. Confidential clients authenticate with HTTP Basic or an mTLS certificate, public clients only send client_id. A code can be used once. Every grant accepts scope to request a subset of the allowed scopes: user scopes limited by the client for user tokens, the client's own scopes for client_credentials and the subject token's scopes for token exchange. client_credentials also accepts audience to issue the token for another registered service.
+// @Tags OAuth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param grant_type formData string true "authorization_code, client_credentials, urn:ietf:params:oauth:grant-type:device_code or urn:ietf:params:oauth:grant-type:token-exchange"
+// @Param code formData string false "Authorization code"
+// @Param redirect_uri formData string false "redirect_uri used in the authorization request"
+// @Param code_verifier formData string false "PKCE code verifier"
+// @Param device_code formData string false "Device code"
+// @Param subject_token formData string false "Access token to exchange"
+// @Param subject_token_type formData string false "urn:ietf:params:oauth:token-type:access_token or urn:ietf:params:oauth:token-type:jwt"
+// @Param audience formData string false "client_id of the downstream service"
+// @Param scope formData string false "Space-separated subset of the allowed scopes, all of them by default"
+// @Param client_id formData string false "Client id, required for public clients"
+// @Success 200 {object} model.OAuthTokenResponse "Issued tokens"
+// @Failure 400 {object} model.ErrorResponse "invalid_request, invalid_grant, unauthorized_client, unsupported_grant_type, authorization_pending, slow_down, access_denied, expired_token, invalid_target or invalid_scope"
+// @Failure 401 {object} model.ErrorResponse "invalid_client"
+// @Failure 500 {object} model.ErrorResponse "server_error"
+// @Router /oauth/token [post]
+// @Example request
+//
+//	grant_type=authorization_code&code=SplxlOBeZQQYbYS6WxSbIA&redirect_uri=https%3A%2F%2Fapp.example.com%2Fcallback&client_id=web-app&code_verifier=dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk
+//
+// @Example response 200
+//
+//	{
+//	  "access_token": "eyJhbGciOiJIUzUxMiIs...",
+//	  "token_type": "Bearer",
+//	  "expires_in": 900,
+//	  "refresh_token": "dGhpcyBpcyBhIHNhbXBsZSByZWZyZXNoIHRva2Vu",
+//	  "scope": "profile sessions:read"
+//	}
+//
+// @Example response 400
+//
+//	{
+//	  "error": "invalid_grant"
+//	}
+func (h *Handler) OAuthToken(writer http.ResponseWriter, req *http.Request) {
+
+	// RFC 6749, раздел 5.1: ответ с токенами не кэшируется
+	writer.Header().Set("Cache-Control", "no-store")
+	writer.Header().Set("Pragma", "no-cache")
+
+	if err := req.ParseForm(); err != nil {
+		server.SetResponse(writer, http.StatusBadRequest, model.ErrorResponse{Error: "invalid_request"})
+		return
+	}
+
+	grant, ok := oauthGrants[req.PostForm.Get("grant_type")]
+	if !ok {
+		server.SetResponse(writer, http.StatusBadRequest, model.ErrorResponse{Error: "unsupported_grant_type"})
+		return
+	}
+
+	client, err := h.oauthClient(req)
+	if errors.Is(err, errInvalidClient) {
+		writer.Header().Set("WWW-Authenticate", `Basic realm="auth"`)
+		server.SetResponse(writer, http.StatusUnauthorized, model.ErrorResponse{Error: "invalid_client"})
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		server.SetResponse(writer, http.StatusInternalServerError, model.ErrorResponse{Error: "server_error"})
+		return
+	}
+
+	grant(h, writer, req, client)
+}
+
+// oauthClient определяет клиента запроса: конфиденциальный аутентифицируется через
+// authenticateClient, публичный только называет себя в client_id
+func (h *Handler) oauthClient(req *http.Request) (storage.Client, error) {
+
+	client_id := req.PostForm.Get("client_id")
+
+	client, err := h.authenticateClient(req)
+	if err != nil {
+		return client, err
+	}
+
+	if client.ID != "" {
+		if client_id != "" && client_id != client.ID {
+			return storage.Client{}, errInvalidClient
+		}
+		return client, nil
+	}
+
+	if client_id == "" {
+		return storage.Client{}, errInvalidClient
+	}
+
+	client, err = h.Store.FindClient(client_id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return storage.Client{}, errInvalidClient
+	}
+	if err != nil {
+		return storage.Client{}, err
+	}
+
+	// Конфиденциальный клиент не может пропустить аутентификацию, назвав только client_id
+	if !client.IsPublic() {
+		return storage.Client{}, errInvalidClient
+	}
+
+	return client, nil
+}
+
+func (h *Handler) grantAuthorizationCode(writer http.ResponseWriter, req *http.Request, client storage.Client) {
+
+	code := req.PostForm.Get("code")
+	code_verifier := req.PostForm.Get("code_verifier")
+
+	if code == "" || !codeVerifierPattern.MatchString(code_verifier) {
+		server.SetResponse(writer, http.StatusBadRequest, model.ErrorResponse{Error: "invalid_request"})
+		return
+	}
+
+	// Код удаляется до проверок, поэтому даже неудачная попытка его расходует
+	stored_code, err := h.Store.ConsumeAuthorizationCode(password.HashSecret(code))
+	if errors.Is(err, storage.ErrNotFound) {
+		server.SetResponse(writer, http.StatusBadRequest, model.ErrorResponse{Error: "invalid_grant"})
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		server.SetResponse(writer, http.StatusInternalServerError, model.ErrorResponse{Error: "server_error"})
+		return
+	}
+
+	if stored_code.ClientID != client.ID ||
+		stored_code.RedirectURI != req.PostForm.Get("redirect_uri") ||
+		!verifyCodeChallenge(code_verifier, stored_code.CodeChallenge) {
+		server.SetResponse(writer, http.StatusBadRequest, model.ErrorResponse{Error: "invalid_grant"})
+		return
+	}
+
+	tokens_pair, err := h.createSession(req, stored_code.UserID, client.ID, stored_code.Scope)
+	if err != nil {
+		log.Println(err)
+		server.SetResponse(writer, http.StatusInternalServerError, model.ErrorResponse{Error: "server_error"})
+		return
+	}
+
+	writeOAuthTokens(writer, tokens_pair)
+}
+
+// writeOAuthTokens отвечает новой парой токенов в формате RFC 6749
+func writeOAuthTokens(writer http.ResponseWriter, tokens_pair model.TokenPair) {
+
+	server.SetResponse(writer, http.StatusOK, model.OAuthTokenResponse{
+		AccessToken:  tokens_pair.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(token.JWTExpiration().Seconds()),
+		RefreshToken: tokens_pair.RefreshToken.Token,
+		Scope:        tokens_pair.Scope,
+	})
+}
+
+// grantClientCredentials выдаёт машинный токен самому клиенту. Публичный клиент
+// не аутентифицирован, поэтому токен от своего имени получить не может. Токен получает
+// только scope клиента и может быть выпущен для другого зарегистрированного сервиса в audience
+func (h *Handler) grantClientCredentials(writer http.ResponseWriter, req *http.Request, client storage.Client) {
+
+	if client.IsPublic() {
+		server.SetResponse(writer, http.StatusBadRequest, model.ErrorResponse{Error: "unauthorized_client"})
+		return
+	}
+
+	scope, ok := token.GrantScope(req.PostForm.Get("scope"), client.Scopes)
+	if !ok {
+		server.SetResponse(writer, http.StatusBadRequest, model.ErrorResponse{Error: "invalid_scope"})
+		return
+	}
+
+	audience := req.PostForm.Get("audience")
+	if ok, err := h.validAudience(audience); err != nil {
+		log.Println(err)
+		server.SetResponse(writer, http.StatusInternalServerError, model.ErrorResponse{Error: "server_error"})
+		return
+	} else if !ok {
+		server.SetResponse(writer, http.StatusBadRequest, model.ErrorResponse{Error: "invalid_target"})
+		return
+	}
+
+	access_token, err := token.GenerateClientJWT(client.ID, scope, audience)
+	if err != nil {
+		log.Println(err)
+		server.SetResponse(writer, http.StatusInternalServerError, model.ErrorResponse{Error: "server_error"})
+		return
+	}
+
+	server.SetResponse(writer, http.StatusOK, model.OAuthTokenResponse{
+		AccessToken: access_token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(token.JWTExpiration().Seconds()),
+		Scope:       scope,
+	})
+}
+
+// validAudience проверяет, что audience - зарегистрированный сервис. Пустой audience - сам сервис
+func (h *Handler) validAudience(audience string) (bool, error) {
+
+	if audience == "" {
+		return true, nil
+	}
+
+	_, err := h.Store.FindClient(audience)
+
+	if errors.Is(err, storage.ErrNotFound) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// verifyCodeChallenge проверяет BASE64URL(SHA256(code_verifier)) == code_challenge (RFC 7636, раздел 4.6)
+func verifyCodeChallenge(code_verifier, code_challenge string) bool {
+
+	sum := sha256.Sum256([]byte(code_verifier))
+
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(code_challenge)) == 1
+}
+
+// supportedGrantTypes возвращает grant_type для discovery: /auth/token принимает password,
+// остальные обслуживает /oauth/token
+func supportedGrantTypes() []string {
+
+	grant_types := []string{"password"}
+
+	for grant_type := range oauthGrants {
+		grant_types = append(grant_types, grant_type)
+	}
+
+	sort.Strings(grant_types[1:])
+
+	return grant_types
+}
@@ -0,0 +1,104 @@
+package endpoint
+
+import (
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/redeflesq/auth-example/internal/model"
+	"github.com/redeflesq/auth-example/internal/server"
+	"github.com/redeflesq/auth-example/internal/storage"
+	"github.com/redeflesq/auth-example/internal/token"
+)
+
+// RFC 8693, разделы 2.1 и 3
+const (
+	GrantTypeTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+	TokenTypeURIAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+	TokenTypeURIJWT         = "urn:ietf:params:oauth:token-type:jwt"
+)
+
+// grantTokenExchange выпускает для сервиса audience токен от имени владельца subject_token.
+// Вызывающий сервис должен быть аутентифицированным клиентом и попадает в act. Токен,
+// выпущенный для другого сервиса, может обменять только сервис из его audience
+func (h *Handler) grantTokenExchange(writer http.ResponseWriter, req *http.Request, client storage.Client) {
+
+	if client.IsPublic() {
+		server.SetResponse(writer, http.StatusBadRequest, model.ErrorResponse{Error: "unauthorized_client"})
+		return
+	}
+
+	subject_token := req.PostForm.Get("subject_token")
+	subject_token_type := req.PostForm.Get("subject_token_type")
+	audience := req.PostForm.Get("audience")
+
+	if subject_token == "" || audience == "" ||
+		(subject_token_type != TokenTypeURIAccessToken && subject_token_type != TokenTypeURIJWT) {
+		server.SetResponse(writer, http.StatusBadRequest, model.ErrorResponse{Error: "invalid_request"})
+		return
+	}
+
+	if requested := req.PostForm.Get("requested_token_type"); requested != "" && requested != TokenTypeURIAccessToken {
+		server.SetResponse(writer, http.StatusBadRequest, model.ErrorResponse{Error: "invalid_request"})
+		return
+	}
+
+	// Получателем может быть только зарегистрированный сервис
+	if ok, err := h.validAudience(audience); err != nil {
+		log.Println(err)
+		server.SetResponse(writer, http.StatusInternalServerError, model.ErrorResponse{Error: "server_error"})
+		return
+	} else if !ok {
+		server.SetResponse(writer, http.StatusBadRequest, model.ErrorResponse{Error: "invalid_target"})
+		return
+	}
+
+	subject := &model.Claims{}
+
+	parsed, err := token.ParseJWT(subject_token, subject)
+	if err != nil || !parsed.Valid {
+		server.SetResponse(writer, http.StatusBadRequest, model.ErrorResponse{Error: "invalid_request"})
+		return
+	}
+
+	if len(subject.Audience) > 0 && !slices.Contains(subject.Audience, token.Audience()) && !slices.Contains(subject.Audience, client.ID) {
+		server.SetResponse(writer, http.StatusBadRequest, model.ErrorResponse{Error: "invalid_request"})
+		return
+	}
+
+	// Обмен может только сузить scope исходного токена
+	scope, ok := token.GrantScope(req.PostForm.Get("scope"), strings.Fields(subject.Scope))
+	if !ok {
+		server.SetResponse(writer, http.StatusBadRequest, model.ErrorResponse{Error: "invalid_scope"})
+		return
+	}
+
+	revoked, err := server.AccessTokenIsRevoked(h.Store, subject)
+	if err != nil {
+		log.Println(err)
+		server.SetResponse(writer, http.StatusInternalServerError, model.ErrorResponse{Error: "server_error"})
+		return
+	}
+	if revoked {
+		server.SetResponse(writer, http.StatusBadRequest, model.ErrorResponse{Error: "invalid_request"})
+		return
+	}
+
+	access_token, expires_at, err := token.GenerateExchangedJWT(subject, client.ID, audience, scope)
+	if err != nil {
+		log.Println(err)
+		server.SetResponse(writer, http.StatusInternalServerError, model.ErrorResponse{Error: "server_error"})
+		return
+	}
+
+	server.SetResponse(writer, http.StatusOK, model.OAuthTokenResponse{
+		AccessToken:     access_token,
+		TokenType:       "Bearer",
+		ExpiresIn:       int64(time.Until(expires_at).Round(time.Second).Seconds()),
+		Scope:           scope,
+		IssuedTokenType: TokenTypeURIAccessToken,
+	})
+}
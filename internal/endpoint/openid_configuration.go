@@ -0,0 +1,131 @@
+package endpoint
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/redeflesq/auth-example/internal/model"
+	"github.com/redeflesq/auth-example/internal/server"
+	"github.com/redeflesq/auth-example/internal/token"
+)
+
+// Имена маршрутов, из которых строятся адреса в discovery документе
+const (
+	RouteJWKS          = "jwks"
+	RouteAuthorization = "authorization"
+	RouteToken         = "token"
+	RouteRevocation    = "revocation"
+	RouteIntrospection = "introspection"
+
+	RouteDeviceAuthorization = "device_authorization"
+	RouteDeviceVerification  = "device_verification"
+)
+
+// OpenIDConfiguration godoc
+// @Summary OpenID Connect discovery document
+// @Description Describes issuer, endpoints, scopes and access token claims. Generated from the registered routes and the current token configuration, endpoints that are not served are omitted. ID tokens are not issued, so id_token_signing_alg_values_supported is omitted. claims_supported lists the claims set by the service and the ones declared by the claims provider.
+// @Tags Keys
+// @Produce json
+// @Success 200 {object} model.OpenIDConfigurationResponse "Discovery document"
+// @Router /.well-known/openid-configuration [get]
+// @Example response 200
+//
+//	{
+//	  "issuer": "https://auth.example.com",
+//	  "jwks_uri": "https://auth.example.com/.well-known/jwks.json",
+//	  "authorization_endpoint": "https://auth.example.com/oauth/authorize",
+//	  "token_endpoint": "https://auth.example.com/oauth/token",
+//	  "device_authorization_endpoint": "https://auth.example.com/oauth/device_authorization",
+//	  "response_types_supported": ["code"],
+//	  "subject_types_supported": ["public"],
+//	  "grant_types_supported": ["password", "authorization_code", "client_credentials", "urn:ietf:params:oauth:grant-type:device_code"],
+//	  "code_challenge_methods_supported": ["S256"],
+//	  "claims_supported": ["iss", "sub", "aud", "exp", "iat", "user_id", "pair_id", "azp", "token_use", "act", "scope", "roles", "tenant"],
+//	  "scopes_supported": ["profile", "sessions:read", "sessions:write", "admin"]
+//	}
+func (h *Handler) OpenIDConfiguration(writer http.ResponseWriter, req *http.Request) {
+
+	base, from_issuer := baseURL(req)
+
+	response := model.OpenIDConfigurationResponse{
+		Issuer:                            token.Issuer(),
+		JWKSURI:                           h.routeURL(base, RouteJWKS),
+		AuthorizationEndpoint:             h.routeURL(base, RouteAuthorization),
+		TokenEndpoint:                     h.routeURL(base, RouteToken),
+		RevocationEndpoint:                h.routeURL(base, RouteRevocation),
+		IntrospectionEndpoint:             h.routeURL(base, RouteIntrospection),
+		DeviceAuthorizationEndpoint:       h.routeURL(base, RouteDeviceAuthorization),
+		ResponseTypesSupported:            []string{"code"},
+		SubjectTypesSupported:             []string{"public"},
+		GrantTypesSupported:               supportedGrantTypes(),
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		TokenEndpointAuthMethodsSupported: append([]string{"none"}, clientAuthMethods...),
+		ClaimsSupported:                   token.SupportedClaims(),
+		ScopesSupported:                   append(token.UserScopes(), token.ScopeAdmin),
+	}
+
+	// Адреса, построенные по заголовкам запроса, нельзя отдавать общему кэшу:
+	// запрос с подменённым Host отравил бы документ для всех клиентов
+	if from_issuer {
+		writer.Header().Set("Cache-Control", "public, max-age=60")
+	} else {
+		writer.Header().Set("Cache-Control", "private, max-age=60")
+		writer.Header().Set("Vary", "Host, X-Forwarded-Proto")
+	}
+
+	server.SetResponse(writer, http.StatusOK, response)
+}
+
+// baseURL берёт схему и хост из issuer, если это URL, иначе из запроса.
+// Второе значение сообщает, что адрес взят из issuer и не зависит от запроса
+func baseURL(req *http.Request) (string, bool) {
+
+	if issuer, err := url.Parse(token.Issuer()); err == nil && issuer.Scheme != "" && issuer.Host != "" {
+		return strings.TrimSuffix(issuer.String(), "/"), true
+	}
+
+	scheme := "http"
+
+	if req.TLS != nil {
+		scheme = "https"
+	}
+
+	// X-Forwarded-Proto может прислать любой клиент, верим ему только за прокси
+	if forwarded := req.Header.Get("X-Forwarded-Proto"); trustedProxy() && (forwarded == "http" || forwarded == "https") {
+		scheme = forwarded
+	}
+
+	return scheme + "://" + req.Host, false
+}
+
+// trustedProxy сообщает, что сервис стоит за прокси, который сам выставляет X-Forwarded-Proto
+func trustedProxy() bool {
+
+	trusted, _ := strconv.ParseBool(os.Getenv("AUTH_TRUSTED_PROXY"))
+
+	return trusted
+}
+
+func (h *Handler) routeURL(base, name string) string {
+
+	if h.Router == nil {
+		return ""
+	}
+
+	route := h.Router.Get(name)
+
+	if route == nil {
+		return ""
+	}
+
+	path, err := route.URLPath()
+
+	if err != nil {
+		return ""
+	}
+
+	return base + path.Path
+}
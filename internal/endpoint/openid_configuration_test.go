@@ -0,0 +1,99 @@
+package endpoint_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/redeflesq/auth-example/internal/endpoint"
+	"github.com/redeflesq/auth-example/internal/model"
+	"github.com/redeflesq/auth-example/internal/storage"
+	"github.com/redeflesq/auth-example/internal/token"
+)
+
+// discovery запрашивает discovery документ с заданными Host и X-Forwarded-Proto
+func discovery(t *testing.T, host, forwarded_proto string) (model.OpenIDConfigurationResponse, http.Header) {
+
+	t.Helper()
+
+	handler := endpoint.New(storage.NewMemoryStore())
+
+	router := mux.NewRouter()
+	handler.Router = router
+
+	router.HandleFunc("/.well-known/jwks.json", handler.JWKS).Methods("GET").Name(endpoint.RouteJWKS)
+	router.HandleFunc("/.well-known/openid-configuration", handler.OpenIDConfiguration).Methods("GET")
+
+	req := httptest.NewRequest("GET", "/.well-known/openid-configuration", nil)
+	req.Host = host
+	if forwarded_proto != "" {
+		req.Header.Set("X-Forwarded-Proto", forwarded_proto)
+	}
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+
+	var response model.OpenIDConfigurationResponse
+	if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+
+	return response, recorder.Header()
+}
+
+func TestDiscoveryFromRequestIsNotShared(t *testing.T) {
+
+	t.Setenv("JWT_ISSUER", "auth-example")
+	t.Setenv("AUTH_TRUSTED_PROXY", "")
+
+	response, header := discovery(t, "evil.example", "https")
+
+	if response.JWKSURI != "http://evil.example/.well-known/jwks.json" {
+		t.Fatalf("jwks_uri %q, X-Forwarded-Proto must be ignored without a trusted proxy", response.JWKSURI)
+	}
+
+	if cache_control := header.Get("Cache-Control"); cache_control != "private, max-age=60" {
+		t.Fatalf("Cache-Control %q for a request-derived document", cache_control)
+	}
+
+	t.Setenv("AUTH_TRUSTED_PROXY", "true")
+
+	if response, _ = discovery(t, "auth.example.com", "https"); response.JWKSURI != "https://auth.example.com/.well-known/jwks.json" {
+		t.Fatalf("jwks_uri %q behind a trusted proxy", response.JWKSURI)
+	}
+}
+
+func TestDiscoveryFromIssuerIsPublic(t *testing.T) {
+
+	t.Setenv("JWT_ISSUER", "https://auth.example.com")
+
+	response, header := discovery(t, "evil.example", "http")
+
+	if response.JWKSURI != "https://auth.example.com/.well-known/jwks.json" {
+		t.Fatalf("jwks_uri %q, want it built from JWT_ISSUER", response.JWKSURI)
+	}
+
+	if cache_control := header.Get("Cache-Control"); cache_control != "public, max-age=60" {
+		t.Fatalf("Cache-Control %q", cache_control)
+	}
+}
+
+func TestDiscoveryClaimsFromProvider(t *testing.T) {
+
+	provider := token.NewHTTPClaimsProvider("http://localhost", time.Second)
+	provider.Names = []string{"tenant"}
+
+	token.SetClaimsProvider(provider)
+	t.Cleanup(func() { token.SetClaimsProvider(nil) })
+
+	response, _ := discovery(t, "auth.example.com", "")
+
+	if !slices.Contains(response.ClaimsSupported, "roles") || !slices.Contains(response.ClaimsSupported, "tenant") {
+		t.Fatalf("claims_supported %v", response.ClaimsSupported)
+	}
+}
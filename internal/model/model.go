@@ -1,13 +1,144 @@
 package model
 
-import "github.com/golang-jwt/jwt/v5"
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Значения token_use: токен пользователя или машинный токен клиента (client_credentials)
+const (
+	TokenUseUser   = "user"
+	TokenUseClient = "client"
+)
+
+// Роли пользователей. user есть у всех, admin и support открывают /admin
+const (
+	RoleUser    = "user"
+	RoleAdmin   = "admin"
+	RoleSupport = "support"
+)
+
+// IsRole сообщает, что role - одна из известных ролей
+func IsRole(role string) bool {
+	return role == RoleUser || role == RoleAdmin || role == RoleSupport
+}
 
 type Claims struct {
-	UserID string `json:"user_id"`
-	PairID string `json:"pair_id"`
+	UserID          string         `json:"user_id,omitempty"`
+	PairID          string         `json:"pair_id"`             // у машинного токена - только идентификатор для отзыва
+	AuthorizedParty string         `json:"azp,omitempty"`       // client_id клиента, получившего токен
+	TokenUse        string         `json:"token_use,omitempty"` // пустой у токенов, выпущенных до появления машинных
+	Actor           *Actor         `json:"act,omitempty"`       // сервис, действующий от имени субъекта (token exchange)
+	Scope           string         `json:"scope,omitempty"`     // разрешения токена через пробел
+	Roles           []string       `json:"roles,omitempty"`     // роли пользователя на момент выпуска
+	Extra           map[string]any `json:"-"`                   // claims от провайдера claims, в JWT на верхнем уровне
 	jwt.RegisteredClaims
 }
 
+// Зарегистрированные claims (RFC 7519), которые заполняет сервис. nbf и jti не выпускаются
+var issuedRegisteredClaims = []string{"iss", "sub", "aud", "exp", "iat"}
+
+// reservedClaims заполняет сам сервис, в Extra они не попадают
+var reservedClaims = append(ClaimNames(), "nbf", "jti")
+
+// ClaimNames возвращает claims, которые сервис выпускает в access токенах: поля Claims
+// с JSON именем и зарегистрированные claims, без claims провайдера
+func ClaimNames() []string {
+
+	names := slices.Clone(issuedRegisteredClaims)
+
+	claims_type := reflect.TypeOf(Claims{})
+
+	for i := 0; i < claims_type.NumField(); i++ {
+
+		field := claims_type.Field(i)
+
+		if name, _, _ := strings.Cut(field.Tag.Get("json"), ","); !field.Anonymous && name != "" && name != "-" {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// IsReservedClaim сообщает, что claim name заполняет сам сервис
+func IsReservedClaim(name string) bool {
+	return slices.Contains(reservedClaims, name)
+}
+
+// MarshalJSON добавляет Extra к остальным claims на верхнем уровне
+func (c Claims) MarshalJSON() ([]byte, error) {
+
+	type plain Claims
+
+	data, err := json.Marshal(plain(c))
+	if err != nil || len(c.Extra) == 0 {
+		return data, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err = json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	merged := make(map[string]any, len(fields)+len(c.Extra))
+	for name, value := range c.Extra {
+		if !IsReservedClaim(name) {
+			merged[name] = value
+		}
+	}
+	for name, value := range fields {
+		merged[name] = value
+	}
+
+	return json.Marshal(merged)
+}
+
+// UnmarshalJSON собирает claims, которых нет в структуре, в Extra
+func (c *Claims) UnmarshalJSON(data []byte) error {
+
+	type plain Claims
+
+	if err := json.Unmarshal(data, (*plain)(c)); err != nil {
+		return err
+	}
+
+	var all map[string]any
+	if err := json.Unmarshal(data, &all); err != nil {
+		return err
+	}
+
+	for name := range all {
+		if IsReservedClaim(name) {
+			delete(all, name)
+		}
+	}
+
+	if len(all) > 0 {
+		c.Extra = all
+	}
+
+	return nil
+}
+
+// Actor - участник цепочки делегирования (RFC 8693, раздел 4.1). Вложенный act -
+// предыдущий сервис в цепочке
+type Actor struct {
+	Subject string `json:"sub"`
+	Actor   *Actor `json:"act,omitempty"`
+}
+
+// IsClient сообщает, что токен выдан клиенту от его имени, а не пользователю. Такой токен
+// несёт client_id в sub и не имеет user_id
+func (c *Claims) IsClient() bool {
+	return c.TokenUse == TokenUseClient
+}
+
 type RefreshToken_ struct {
 	Token string `json:"token"`
 	Hash  string `json:"hash"`
@@ -17,6 +148,7 @@ type TokenPair struct {
 	AccessToken  string `json:"access_token"`
 	RefreshToken RefreshToken_
 	PairID       string `json:"pair_id"`
+	Scope        string `json:"scope"`
 }
 
 // Responses
@@ -28,6 +160,7 @@ type SuccessResponse struct {
 type TokenResponse struct {
 	AccessToken  string `json:"access_token"`
 	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope,omitempty"`
 }
 
 type UserIdResponse struct {
@@ -38,12 +171,145 @@ type ErrorResponse struct {
 	Error string `json:"error"`
 }
 
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JWKSResponse struct {
+	Keys []JWK `json:"keys"`
+}
+
+type OpenIDConfigurationResponse struct {
+	Issuer                            string   `json:"issuer"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint,omitempty"`
+	TokenEndpoint                     string   `json:"token_endpoint,omitempty"`
+	RevocationEndpoint                string   `json:"revocation_endpoint,omitempty"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint,omitempty"`
+	DeviceAuthorizationEndpoint       string   `json:"device_authorization_endpoint,omitempty"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported,omitempty"`
+	ScopesSupported                   []string `json:"scopes_supported,omitempty"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported,omitempty"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported,omitempty"`
+	ClaimsSupported                   []string `json:"claims_supported,omitempty"`
+}
+
+// OAuthTokenResponse - ответ /oauth/token (RFC 6749, раздел 5.1)
+type OAuthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	// Для token exchange (RFC 8693, раздел 2.2.1)
+	IssuedTokenType string `json:"issued_token_type,omitempty"`
+}
+
+// IntrospectionResponse - ответ RFC 7662, для неактивного токена заполнено только active
+type IntrospectionResponse struct {
+	Active    bool     `json:"active"`
+	TokenType string   `json:"token_type,omitempty"`
+	Sub       string   `json:"sub,omitempty"`
+	Exp       int64    `json:"exp,omitempty"`
+	Iat       int64    `json:"iat,omitempty"`
+	Iss       string   `json:"iss,omitempty"`
+	PairID    string   `json:"pair_id,omitempty"`
+	ClientID  string   `json:"client_id,omitempty"`
+	TokenUse  string   `json:"token_use,omitempty"`
+	Aud       []string `json:"aud,omitempty"`
+	Act       *Actor   `json:"act,omitempty"`
+	Scope     string   `json:"scope,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
+}
+
+// DeviceAuthorizationResponse - ответ /oauth/device_authorization (RFC 8628, раздел 3.2)
+type DeviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete,omitempty"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int64  `json:"interval"`
+}
+
+// DeviceVerificationResponse описывает устройство, которое пользователь собирается подтвердить
+type DeviceVerificationResponse struct {
+	UserCode  string    `json:"user_code"`
+	ClientID  string    `json:"client_id"`
+	UserAgent string    `json:"user_agent"`
+	IPAddress string    `json:"ip_address"`
+	Scope     string    `json:"scope"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type SessionResponse struct {
+	PairID     string    `json:"pair_id"`
+	Device     string    `json:"device"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+type SessionsResponse struct {
+	Sessions []SessionResponse `json:"sessions"`
+}
+
+// AdminUserResponse - учётная запись пользователя для операторов
+type AdminUserResponse struct {
+	UserID    string    `json:"user_id"`
+	Username  string    `json:"username"`
+	Roles     []string  `json:"roles"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
 // Requests
 
 type TokenRequest struct {
 	RefreshToken string `json:"refresh_token"` // It's not hash
 }
 
-type UserIdRequest struct {
-	UserID string `json:"user_id"`
+// AuthTokenRequest - вход по username и password. user_id принимается только в режиме доверенного издателя
+type AuthTokenRequest struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	UserID   string `json:"user_id,omitempty"`
+	Scope    string `json:"scope,omitempty"` // подмножество разрешённых scope через пробел, пустой - все
+}
+
+type RegisterRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// OAuthTokenRequest - тело запросов RFC 7662 / RFC 7009 (form или JSON)
+type OAuthTokenRequest struct {
+	Token         string `json:"token"`
+	TokenTypeHint string `json:"token_type_hint"` // access_token или refresh_token
+}
+
+// DeviceVerificationRequest подтверждает (approve=true) или отклоняет запрос устройства
+type DeviceVerificationRequest struct {
+	UserCode string `json:"user_code"`
+	Approve  bool   `json:"approve"`
+}
+
+// UserRolesRequest заменяет роли пользователя
+type UserRolesRequest struct {
+	Roles []string `json:"roles"`
+}
+
+type LogoutAllRequest struct {
+	KeepCurrent bool `json:"keep_current"`
 }
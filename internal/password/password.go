@@ -0,0 +1,125 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Параметры argon2id по рекомендациям OWASP: 19 MiB памяти, 2 прохода, 1 поток
+const (
+	argonMemory  = 19 * 1024
+	argonTime    = 2
+	argonThreads = 1
+	argonKeyLen  = 32
+	argonSaltLen = 16
+)
+
+// Пароли короче не принимаются при регистрации
+const MinLength = 8
+
+// Hash возвращает хеш argon2id в формате PHC: $argon2id$v=19$m=...,t=...,p=...$salt$hash
+func Hash(password string) (string, error) {
+
+	salt := make([]byte, argonSaltLen)
+
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, argonTime, argonMemory, argonThreads, argonKeyLen)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, argonMemory, argonTime, argonThreads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// Verify сверяет пароль с хешем. Параметры берутся из самого хеша,
+// поэтому хеши со старыми параметрами остаются рабочими
+func Verify(password, encoded string) (bool, error) {
+
+	parts := strings.Split(encoded, "$")
+
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return false, fmt.Errorf("unsupported password hash format")
+	}
+
+	var version int
+	var memory, time uint32
+	var threads uint8
+
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, fmt.Errorf("unsupported argon2 version")
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return false, fmt.Errorf("invalid argon2 parameters: %w", err)
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, err
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, err
+	}
+
+	candidate := argon2.IDKey([]byte(password), salt, time, memory, threads, uint32(len(key)))
+
+	return subtle.ConstantTimeCompare(key, candidate) == 1, nil
+}
+
+var (
+	dummy_once sync.Once
+	dummy_hash string
+)
+
+// VerifyDummy тратит на проверку столько же времени, сколько Verify, и всегда неуспешна.
+// Вызывается для несуществующих пользователей, чтобы их нельзя было отличить по времени ответа
+func VerifyDummy(password string) {
+
+	dummy_once.Do(func() {
+		dummy_hash, _ = Hash("dummy password")
+	})
+
+	Verify(password, dummy_hash)
+}
+
+// GenerateSecret создаёт случайный секрет (client_secret, код авторизации). У него 256 бит
+// энтропии, поэтому для хранения достаточно SHA-256 без медленного хеширования
+func GenerateSecret() (string, error) {
+
+	secret := make([]byte, 32)
+
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// Секреты клиентов из конфигурации короче не принимаются: HashSecret без соли и медленного
+// хеширования годится только для секретов с энтропией, сравнимой с GenerateSecret
+const MinSecretLength = 32
+
+func HashSecret(secret string) string {
+
+	sum := sha256.Sum256([]byte(secret))
+
+	return hex.EncodeToString(sum[:])
+}
+
+func VerifySecret(secret, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashSecret(secret)), []byte(hash)) == 1
+}
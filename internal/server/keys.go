@@ -0,0 +1,110 @@
+package server
+
+import (
+	"log"
+	"time"
+
+	"github.com/redeflesq/auth-example/internal/storage"
+	"github.com/redeflesq/auth-example/internal/token"
+)
+
+// RotateSigningKeys периодически синхронизирует набор ключей подписи с хранилищем,
+// выпускает новый ключ раз в interval и удаляет ключи, которыми уже не может
+// быть подписан ни один токен, предъявляемый на /auth/refresh
+func RotateSigningKeys(store storage.Store, interval time.Duration) {
+	for {
+		err := syncSigningKeys(store, interval)
+		if err != nil {
+			log.Printf("Signing keys sync error: %v", err)
+		}
+		time.Sleep(token.KeySyncInterval)
+	}
+}
+
+func syncSigningKeys(store storage.Store, interval time.Duration) error {
+
+	stored, err := store.ListSigningKeys()
+
+	if err != nil {
+		return err
+	}
+
+	if len(stored) == 0 || time.Since(stored[len(stored)-1].CreatedAt) >= interval {
+
+		key, err := token.GenerateKey()
+
+		if err != nil {
+			return err
+		}
+
+		private_key, err := token.MarshalPrivateKey(key)
+
+		if err != nil {
+			return err
+		}
+
+		// Ключ в хранилище зашифрован: чтение базы или её резервной копии не даёт подделывать токены
+		private_key, err = token.EncryptPrivateKey(key.ID, key.Method.Alg(), private_key)
+
+		if err != nil {
+			return err
+		}
+
+		signing_key := storage.SigningKey{
+			ID:         key.ID,
+			Algorithm:  key.Method.Alg(),
+			PrivateKey: private_key,
+			CreatedAt:  key.CreatedAt,
+		}
+
+		if err = store.SaveSigningKey(signing_key); err != nil {
+			return err
+		}
+
+		log.Printf("Signing key %s generated", key.ID)
+
+		stored = append(stored, signing_key)
+	}
+
+	var list []token.Key
+
+	for i, signing_key := range stored {
+
+		// Access токен, подписанный ключом, может прийти на refresh вместе
+		// с refresh токеном, поэтому ключ живёт весь срок refresh токена
+		if i+1 < len(stored) {
+
+			retired_at := stored[i+1].CreatedAt.Add(token.KeyActivationDelay)
+
+			if time.Since(retired_at) > storage.RefreshTokenLifetime() {
+
+				if err = store.DeleteSigningKey(signing_key.ID); err != nil {
+					return err
+				}
+
+				log.Printf("Signing key %s deleted", signing_key.ID)
+				continue
+			}
+		}
+
+		private_key, err := token.DecryptPrivateKey(signing_key.ID, signing_key.Algorithm, signing_key.PrivateKey)
+
+		if err != nil {
+			log.Printf("Failed to decrypt signing key %s: %v", signing_key.ID, err)
+			continue
+		}
+
+		key, err := token.ParsePrivateKey(signing_key.ID, signing_key.Algorithm, private_key, signing_key.CreatedAt)
+
+		if err != nil {
+			log.Printf("Failed to load signing key %s: %v", signing_key.ID, err)
+			continue
+		}
+
+		list = append(list, key)
+	}
+
+	token.SetRotatedKeys(list)
+
+	return nil
+}
@@ -0,0 +1,188 @@
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/redeflesq/auth-example/internal/storage"
+	"github.com/redeflesq/auth-example/internal/token"
+)
+
+func initKeys(t *testing.T) {
+
+	t.Helper()
+
+	t.Setenv("JWT_ALGORITHM", "HS512")
+	t.Setenv("JWT_SECRET", "keys-test-secret")
+	t.Setenv("JWT_EXPIRATION_MINUTES", "15")
+	t.Setenv("REFRESH_TOKEN_EXPIRATION_MINUTES", "1440")
+	t.Setenv("JWT_KEY_ENCRYPTION_KEY", base64.StdEncoding.EncodeToString(make([]byte, 32)))
+
+	if err := token.Init(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// storedKey сохраняет в хранилище ключ, выпущенный в момент created_at
+func storedKey(t *testing.T, store storage.Store, created_at time.Time) string {
+
+	t.Helper()
+
+	key, err := token.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	private_key, _ := token.MarshalPrivateKey(key)
+
+	private_key, err = token.EncryptPrivateKey(key.ID, key.Method.Alg(), private_key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = store.SaveSigningKey(storage.SigningKey{ID: key.ID, Algorithm: key.Method.Alg(), PrivateKey: private_key, CreatedAt: created_at})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key.ID
+}
+
+func storedIDs(t *testing.T, store storage.Store) []string {
+
+	t.Helper()
+
+	stored, err := store.ListSigningKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	for _, key := range stored {
+		ids = append(ids, key.ID)
+	}
+
+	return ids
+}
+
+func TestSyncSigningKeysGeneratesByInterval(t *testing.T) {
+
+	initKeys(t)
+
+	store := storage.NewMemoryStore()
+
+	if err := syncSigningKeys(store, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	first := storedIDs(t, store)
+	if len(first) != 1 {
+		t.Fatalf("%d keys after the first sync, want 1", len(first))
+	}
+
+	// Интервал ротации не прошёл - новый ключ не выпускается
+	if err := syncSigningKeys(store, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	if ids := storedIDs(t, store); len(ids) != 1 {
+		t.Fatalf("%d keys before the rotation interval, want 1", len(ids))
+	}
+
+	if err := syncSigningKeys(store, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if ids := storedIDs(t, store); len(ids) != 2 || ids[0] != first[0] {
+		t.Fatalf("keys %v after the rotation interval, want %s and a new one", ids, first[0])
+	}
+}
+
+func TestSyncSigningKeysDeletionWindow(t *testing.T) {
+
+	initKeys(t)
+
+	store := storage.NewMemoryStore()
+	lifetime := storage.RefreshTokenLifetime()
+
+	// Преемник старого ключа активирован чуть больше срока жизни refresh токена назад,
+	// преемник среднего - чуть меньше
+	oldest := storedKey(t, store, time.Now().Add(-2*lifetime))
+	middle := storedKey(t, store, time.Now().Add(-lifetime-token.KeyActivationDelay-time.Minute))
+	newest := storedKey(t, store, time.Now().Add(-lifetime-token.KeyActivationDelay+time.Minute))
+
+	if err := syncSigningKeys(store, lifetime); err != nil {
+		t.Fatal(err)
+	}
+
+	ids := storedIDs(t, store)
+	if len(ids) != 3 || ids[0] != middle || ids[1] != newest {
+		t.Fatalf("keys %v, want %s, %s and a new one without %s", ids, middle, newest, oldest)
+	}
+
+	// Удалённый ключ больше не проверяет подписи, оставшиеся загружены в набор
+	verified := map[string]bool{}
+	for _, key := range token.PublishedKeys() {
+		verified[key.ID] = true
+	}
+
+	if verified[oldest] || !verified[ids[2]] {
+		t.Fatalf("published %v after sync", verified)
+	}
+}
+
+func TestSyncSigningKeysStoresEncrypted(t *testing.T) {
+
+	initKeys(t)
+
+	store := storage.NewMemoryStore()
+
+	if err := syncSigningKeys(store, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := store.ListSigningKeys()
+	if err != nil || len(stored) != 1 {
+		t.Fatalf("%d keys, %v", len(stored), err)
+	}
+
+	// Для HS512 в хранилище попал бы сам секрет
+	published := token.PublishedKeys()
+	key := published[len(published)-1]
+
+	if secret, ok := key.Private.([]byte); !ok || key.ID != stored[0].ID || bytes.Contains(stored[0].PrivateKey, secret) {
+		t.Fatalf("signing key %s stored in plaintext", stored[0].ID)
+	}
+}
+
+func TestSyncSigningKeysSkipsPlaintext(t *testing.T) {
+
+	initKeys(t)
+
+	store := storage.NewMemoryStore()
+
+	// Ключ, записанный в хранилище без шифрования, не должен попасть в набор
+	key, err := token.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	private_key, _ := token.MarshalPrivateKey(key)
+
+	err = store.SaveSigningKey(storage.SigningKey{ID: key.ID, Algorithm: key.Method.Alg(), PrivateKey: private_key, CreatedAt: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := syncSigningKeys(store, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, published := range token.PublishedKeys() {
+		if published.ID == key.ID {
+			t.Fatalf("plaintext signing key %s loaded", key.ID)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 
@@ -32,9 +33,9 @@ func GetTokenString(req *http.Request) string {
 	return strings.TrimPrefix(auth_header, "Bearer ")
 }
 
-func CleanRevokedTokens() {
+func CleanRevokedTokens(store storage.Store) {
 	for {
-		_, err := storage.DB.Exec("DELETE FROM revoked_tokens WHERE expires_at < NOW()")
+		err := store.CleanRevokedTokens()
 		if err != nil {
 			log.Printf("Token cleanup error: %v", err)
 		}
@@ -42,35 +43,154 @@ func CleanRevokedTokens() {
 	}
 }
 
-func AuthMiddleware(next http.Handler) http.Handler {
+func ReloadRevocationCache(store *storage.CachedStore, interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		err := store.Reload()
+		if err != nil {
+			log.Printf("Revocation cache reload error: %v", err)
+		}
+	}
+}
 
-	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+// ListenRevocations получает отзывы от других реплик и переподписывается при ошибке
+func ListenRevocations(notifier storage.RevocationNotifier, handler storage.RevocationHandler) {
+	for {
+		err := notifier.ListenRevocations(handler)
+		log.Printf("Revocation listener error: %v", err)
+		handler.Desync()
+		time.Sleep(5 * time.Second)
+	}
+}
 
-		token_str := GetTokenString(req)
+// AccessTokenIsRevoked проверяет, отозвана ли пара токена или все токены пользователя,
+// выпущенные до его iat. У машинного токена нет пользователя, он отзывается только по pair_id
+func AccessTokenIsRevoked(store storage.Store, claims *model.Claims) (bool, error) {
 
-		if token_str == "" {
-			SetResponse(writer, http.StatusUnauthorized, model.ErrorResponse{Error: "Authorization required"})
-			return
-		}
+	revoked, err := store.AccessTokenIsRevoked(claims.PairID)
+
+	if err != nil || revoked || claims.IsClient() {
+		return revoked, err
+	}
 
-		claims := &model.Claims{}
+	valid_after, err := store.TokensValidAfter(claims.UserID)
 
-		token, err := token.ParseJWT(token_str, claims)
+	if err != nil {
+		return false, err
+	}
 
-		if err != nil || !token.Valid {
-			SetResponse(writer, http.StatusUnauthorized, model.ErrorResponse{Error: "Invalid token"})
-			return
-		}
+	return claims.IssuedAt == nil || claims.IssuedAt.Time.Before(valid_after), nil
+}
+
+// AudienceAccepted пропускает токены без aud и выпущенные для самого сервиса. Токен, полученный
+// обменом для другого сервиса, здесь не действует
+func AudienceAccepted(claims *model.Claims) bool {
+	return len(claims.Audience) == 0 || slices.Contains(claims.Audience, token.Audience())
+}
 
-		revoked, err := storage.AccessTokenIsRevoked(claims.PairID)
+func AuthMiddleware(store storage.Store) func(http.Handler) http.Handler {
 
-		if err != nil || revoked {
-			SetResponse(writer, http.StatusUnauthorized, model.ErrorResponse{Error: "Token revoked"})
-			return
-		}
+	return func(next http.Handler) http.Handler {
+
+		return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+
+			token_str := GetTokenString(req)
+
+			if token_str == "" {
+				SetResponse(writer, http.StatusUnauthorized, model.ErrorResponse{Error: "Authorization required"})
+				return
+			}
+
+			claims := &model.Claims{}
+
+			token, err := token.ParseJWT(token_str, claims)
+
+			if err != nil || !token.Valid {
+				SetResponse(writer, http.StatusUnauthorized, model.ErrorResponse{Error: "Invalid token"})
+				return
+			}
+
+			if !AudienceAccepted(claims) {
+				SetResponse(writer, http.StatusUnauthorized, model.ErrorResponse{Error: "Invalid token"})
+				return
+			}
+
+			revoked, err := AccessTokenIsRevoked(store, claims)
+
+			if err != nil || revoked {
+				SetResponse(writer, http.StatusUnauthorized, model.ErrorResponse{Error: "Token revoked"})
+				return
+			}
 
-		ctx := context.WithValue(req.Context(), "claims", claims)
+			// Маршруты /auth/* работают с сессиями пользователя, машинному токену они недоступны
+			if claims.IsClient() {
+				SetResponse(writer, http.StatusForbidden, model.ErrorResponse{Error: "User token required"})
+				return
+			}
 
-		next.ServeHTTP(writer, req.WithContext(ctx))
-	})
+			ctx := context.WithValue(req.Context(), "claims", claims)
+
+			next.ServeHTTP(writer, req.WithContext(ctx))
+		})
+	}
+}
+
+// RequireScopes - AuthMiddleware, который дополнительно требует от токена все перечисленные scope
+func RequireScopes(store storage.Store, scopes ...string) func(http.Handler) http.Handler {
+
+	auth := AuthMiddleware(store)
+
+	return func(next http.Handler) http.Handler {
+
+		return auth(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+
+			claims := req.Context().Value("claims").(*model.Claims)
+
+			if !requireScopes(writer, claims, scopes...) {
+				return
+			}
+
+			next.ServeHTTP(writer, req)
+		}))
+	}
+}
+
+// requireScopes отвечает 403, если в токене нет всех перечисленных scope
+func requireScopes(writer http.ResponseWriter, claims *model.Claims, scopes ...string) bool {
+
+	// RFC 6750, раздел 3.1
+	if !token.HasScopes(claims, scopes...) {
+		writer.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+strings.Join(scopes, " ")+`"`)
+		SetResponse(writer, http.StatusForbidden, model.ErrorResponse{Error: "Insufficient scope"})
+		return false
+	}
+
+	return true
+}
+
+// RequireRoles - AuthMiddleware, который пропускает только токены с одной из перечисленных ролей
+// и scope. Одной роли недостаточно: токен оператора, выданный стороннему клиенту с урезанным
+// scope, не должен открывать операторские маршруты
+func RequireRoles(store storage.Store, scope string, roles ...string) func(http.Handler) http.Handler {
+
+	auth := AuthMiddleware(store)
+
+	return func(next http.Handler) http.Handler {
+
+		return auth(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+
+			claims := req.Context().Value("claims").(*model.Claims)
+
+			if !slices.ContainsFunc(roles, func(role string) bool { return slices.Contains(claims.Roles, role) }) {
+				SetResponse(writer, http.StatusForbidden, model.ErrorResponse{Error: "Insufficient role"})
+				return
+			}
+
+			if !requireScopes(writer, claims, scope) {
+				return
+			}
+
+			next.ServeHTTP(writer, req)
+		}))
+	}
 }
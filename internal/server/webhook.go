@@ -3,6 +3,7 @@ package server
 import (
 	"bytes"
 	"encoding/json"
+	"log"
 	"net/http"
 	"os"
 )
@@ -30,3 +31,29 @@ func SendWebhook(user_id, old_ip, new_ip string) {
 
 	http.Post(url, "application/json", bytes.NewBuffer(json_payload))
 }
+
+// SendSecurityEvent сообщает на WEBHOOK_URL о подозрительной активности
+func SendSecurityEvent(event, user_id, message string, details map[string]string) {
+
+	log.Printf("Security event %s for user %s: %s %v", event, user_id, message, details)
+
+	url := os.Getenv("WEBHOOK_URL")
+
+	if url == "" {
+		return
+	}
+
+	payload := map[string]string{
+		"event":   event,
+		"user_id": user_id,
+		"message": message,
+	}
+
+	for key, value := range details {
+		payload[key] = value
+	}
+
+	json_payload, _ := json.Marshal(payload)
+
+	http.Post(url, "application/json", bytes.NewBuffer(json_payload))
+}
@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"hash/fnv"
+	"math"
+	"sync"
+	"time"
+)
+
+// Доля ложноположительных ответов фильтра, при которой он перестраивается под число отозванных пар
+const bloomFalsePositiveRate = 0.01
+
+// BloomCache - негативный кэш: фильтр Блума содержит все отозванные пары, и если пары
+// в нём точно нет, токен не отозван без обращения к хранилищу. Остальные запросы
+// передаются в следующий кэш. Из фильтра нельзя удалять, поэтому он перестраивается
+// целиком при Reset
+type BloomCache struct {
+	mu       sync.RWMutex
+	next     RevocationCache
+	bits     []uint64
+	hashes   uint64
+	capacity int // минимальное число элементов, под которое строится фильтр
+}
+
+func NewBloomCache(next RevocationCache, capacity int) *BloomCache {
+
+	cache := &BloomCache{next: next, capacity: capacity}
+
+	// Пока фильтр не загружен, все пары считаются возможно отозванными
+	cache.bits, cache.hashes = []uint64{math.MaxUint64}, 1
+
+	return cache
+}
+
+func (c *BloomCache) Lookup(pair_id string) (bool, bool) {
+
+	if !c.mayContain(pair_id) {
+		return false, true
+	}
+
+	return c.next.Lookup(pair_id)
+}
+
+func (c *BloomCache) Add(pair_id string, revoked bool, ttl time.Duration) {
+
+	if revoked {
+		c.mu.Lock()
+		c.insert(pair_id)
+		c.mu.Unlock()
+	}
+
+	c.next.Add(pair_id, revoked, ttl)
+}
+
+func (c *BloomCache) Reset(revoked_pairs []string) {
+
+	// Размер и число хеш-функций по стандартным формулам для заданной доли ложных срабатываний
+	items := float64(max(len(revoked_pairs)*2, c.capacity, 1))
+	bits := math.Ceil(-items * math.Log(bloomFalsePositiveRate) / (math.Ln2 * math.Ln2))
+	hashes := max(uint64(math.Round(bits/items*math.Ln2)), 1)
+
+	c.mu.Lock()
+
+	c.bits = make([]uint64, (int(bits)+63)/64)
+	c.hashes = hashes
+
+	for _, pair_id := range revoked_pairs {
+		c.insert(pair_id)
+	}
+
+	c.mu.Unlock()
+
+	c.next.Reset(revoked_pairs)
+}
+
+// Invalidate перестраивает фильтр: иначе он отвечал бы "не отозван" для новых отозванных пар
+func (c *BloomCache) Invalidate(revoked_pairs func() ([]string, error)) error {
+
+	pairs, err := revoked_pairs()
+
+	if err != nil {
+		return err
+	}
+
+	c.Reset(pairs)
+
+	return nil
+}
+
+func (c *BloomCache) mayContain(pair_id string) bool {
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	found := true
+
+	c.positions(pair_id, func(word int, bit uint64) {
+		found = found && c.bits[word]&bit != 0
+	})
+
+	return found
+}
+
+// insert вызывается под c.mu
+func (c *BloomCache) insert(pair_id string) {
+	c.positions(pair_id, func(word int, bit uint64) {
+		c.bits[word] |= bit
+	})
+}
+
+// positions перебирает биты элемента двойным хешированием: h1 + i*h2
+func (c *BloomCache) positions(pair_id string, visit func(word int, bit uint64)) {
+
+	first, second := fnv.New64a(), fnv.New64()
+	first.Write([]byte(pair_id))
+	second.Write([]byte(pair_id))
+	h1, h2 := first.Sum64(), second.Sum64()|1
+
+	size := uint64(len(c.bits)) * 64
+
+	for i := uint64(0); i < c.hashes; i++ {
+		position := (h1 + i*h2) % size
+		visit(int(position/64), 1<<(position%64))
+	}
+}
@@ -0,0 +1,267 @@
+package storage
+
+import (
+	"container/list"
+	"math"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RevocationCache кэширует результаты проверки отзыва access токенов по pair_id
+type RevocationCache interface {
+	// Lookup возвращает закэшированный результат, ok=false означает, что нужно спросить хранилище
+	Lookup(pair_id string) (revoked bool, ok bool)
+	Add(pair_id string, revoked bool, ttl time.Duration)
+	// Reset заменяет содержимое кэша полным списком отозванных пар
+	Reset(revoked_pairs []string)
+	// Invalidate вызывается после массового отзыва, так как заранее неизвестно, какие из
+	// закэшированных ответов устарели. revoked_pairs читает полный список из хранилища,
+	// кэш вызывает его, только если без списка не может восстановиться
+	Invalidate(revoked_pairs func() ([]string, error)) error
+}
+
+// Размер кэша эпох в режиме REVOCATION_SYNC=notify, если REVOCATION_CACHE_SIZE не задан
+const DefaultEpochCacheSize = 10000
+
+// RevocationCacheSize возвращает размер кэша из REVOCATION_CACHE_SIZE, 0 - кэш выключен
+func RevocationCacheSize() int {
+
+	size, err := strconv.Atoi(os.Getenv("REVOCATION_CACHE_SIZE"))
+
+	if err != nil || size < 0 {
+		return 0
+	}
+
+	return size
+}
+
+// RevocationCacheTTL возвращает время жизни ответа "не отозван" из REVOCATION_CACHE_TTL_SECONDS.
+// Отзыв на другой реплике становится виден не позже чем через это время
+func RevocationCacheTTL() time.Duration {
+
+	seconds, err := strconv.Atoi(os.Getenv("REVOCATION_CACHE_TTL_SECONDS"))
+
+	if err != nil || seconds < 1 {
+		seconds = 5
+	}
+
+	return time.Second * time.Duration(seconds)
+}
+
+// RevocationBloomFilter сообщает, включён ли негативный кэш на фильтре Блума (REVOCATION_BLOOM_FILTER)
+func RevocationBloomFilter() bool {
+
+	enabled, _ := strconv.ParseBool(os.Getenv("REVOCATION_BLOOM_FILTER"))
+
+	return enabled
+}
+
+// NewRevocationCache создаёт LRU кэш и, если REVOCATION_BLOOM_FILTER=true, оборачивает его фильтром Блума
+func NewRevocationCache(size int) RevocationCache {
+
+	var cache RevocationCache = NewLRUCache(size)
+
+	if RevocationBloomFilter() {
+		cache = NewBloomCache(cache, size)
+	}
+
+	return cache
+}
+
+// LRUCache хранит не более size последних ответов, каждый до истечения своего TTL
+type LRUCache struct {
+	entries *lru[string, bool]
+}
+
+func NewLRUCache(size int) *LRUCache {
+	return &LRUCache{entries: newLRU[string, bool](size)}
+}
+
+func (c *LRUCache) Lookup(pair_id string) (bool, bool) {
+	return c.entries.get(pair_id)
+}
+
+func (c *LRUCache) Add(pair_id string, revoked bool, ttl time.Duration) {
+	c.entries.set(pair_id, revoked, ttl)
+}
+
+// Reset удаляет ответы "не отозван". Отзыв необратим, поэтому остальные остаются верными
+func (c *LRUCache) Reset(revoked_pairs []string) {
+	c.entries.removeIf(func(revoked bool) bool { return !revoked })
+}
+
+// Invalidate не читает список: достаточно удалить ответы "не отозван"
+func (c *LRUCache) Invalidate(revoked_pairs func() ([]string, error)) error {
+	c.Reset(nil)
+	return nil
+}
+
+// RevokedSet хранит все отозванные пары в памяти и отвечает без обращения к хранилищу,
+// пока синхронизирован уведомлениями об отзывах (см. RevocationNotifier). Без синхронизации
+// ответы "не отозван" могут быть устаревшими, поэтому запросы уходят в хранилище
+type RevokedSet struct {
+	mu     sync.RWMutex
+	synced bool
+	pairs  map[string]time.Time // pair_id -> момент, после которого токен истёк сам
+}
+
+func NewRevokedSet() *RevokedSet {
+	return &RevokedSet{pairs: make(map[string]time.Time)}
+}
+
+func (c *RevokedSet) Lookup(pair_id string) (bool, bool) {
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	expires_at, revoked := c.pairs[pair_id]
+
+	if revoked && expires_at.After(time.Now()) {
+		return true, true
+	}
+
+	return false, c.synced
+}
+
+// Add запоминает только отзывы, ответы "не отозван" следуют из полноты набора
+func (c *RevokedSet) Add(pair_id string, revoked bool, ttl time.Duration) {
+
+	if !revoked {
+		return
+	}
+
+	c.mu.Lock()
+	c.pairs[pair_id] = time.Now().Add(ttl)
+	c.mu.Unlock()
+}
+
+// Reset заменяет набор, попутно удаляя истекшие пары. Срок отозванных пар из списка неизвестен,
+// поэтому они хранятся до следующего Reset
+func (c *RevokedSet) Reset(revoked_pairs []string) {
+
+	pairs := make(map[string]time.Time, len(revoked_pairs))
+
+	for _, pair_id := range revoked_pairs {
+		pairs[pair_id] = time.Unix(math.MaxInt32, 0)
+	}
+
+	c.mu.Lock()
+	c.pairs = pairs
+	c.mu.Unlock()
+}
+
+// Invalidate перечитывает набор: без новых пар ответы "не отозван" были бы неверными
+func (c *RevokedSet) Invalidate(revoked_pairs func() ([]string, error)) error {
+
+	pairs, err := revoked_pairs()
+
+	if err != nil {
+		return err
+	}
+
+	c.Reset(pairs)
+
+	return nil
+}
+
+func (c *RevokedSet) setSynced(synced bool) {
+	c.mu.Lock()
+	c.synced = synced
+	c.mu.Unlock()
+}
+
+type lruEntry[K comparable, V any] struct {
+	key        K
+	value      V
+	expires_at time.Time
+}
+
+type lru[K comparable, V any] struct {
+	mu    sync.Mutex
+	size  int
+	items map[K]*list.Element
+	order *list.List // от недавно использованных к давно
+}
+
+func newLRU[K comparable, V any](size int) *lru[K, V] {
+	return &lru[K, V]{size: size, items: make(map[K]*list.Element), order: list.New()}
+}
+
+func (c *lru[K, V]) get(key K) (V, bool) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var zero V
+
+	element, ok := c.items[key]
+
+	if !ok {
+		return zero, false
+	}
+
+	entry := element.Value.(*lruEntry[K, V])
+
+	if !entry.expires_at.After(time.Now()) {
+		c.order.Remove(element)
+		delete(c.items, key)
+		return zero, false
+	}
+
+	c.order.MoveToFront(element)
+
+	return entry.value, true
+}
+
+func (c *lru[K, V]) set(key K, value V, ttl time.Duration) {
+
+	if ttl <= 0 || c.size <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expires_at := time.Now().Add(ttl)
+
+	if element, ok := c.items[key]; ok {
+		entry := element.Value.(*lruEntry[K, V])
+		entry.value, entry.expires_at = value, expires_at
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&lruEntry[K, V]{key: key, value: value, expires_at: expires_at})
+
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*lruEntry[K, V]).key)
+	}
+}
+
+func (c *lru[K, V]) remove(key K) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.items[key]; ok {
+		c.order.Remove(element)
+		delete(c.items, key)
+	}
+}
+
+func (c *lru[K, V]) removeIf(match func(V) bool) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, element := range c.items {
+		if match(element.Value.(*lruEntry[K, V]).value) {
+			c.order.Remove(element)
+			delete(c.items, key)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package storage
+
+import (
+	"sync"
+	"time"
+)
+
+// CachedStore добавляет к хранилищу кэш проверки отзыва access токенов и эпох
+// пользователей, которые AuthMiddleware выполняет на каждый запрос. Отзывы,
+// сделанные через CachedStore, видны сразу, сделанные другими репликами - не позже
+// чем через negative_ttl
+type CachedStore struct {
+	Store
+
+	cache           RevocationCache
+	epochs          *lru[string, time.Time]
+	access_lifetime time.Duration
+	negative_ttl    time.Duration
+
+	// mu упорядочивает запись в кэш после чтения из хранилища и инвалидацию после отзыва:
+	// ответ, прочитанный до отзыва, не попадёт в кэш после него
+	mu         sync.Mutex
+	generation uint64
+}
+
+// NewCachedStore оборачивает store и загружает в кэш список отозванных токенов.
+// access_lifetime ограничивает время жизни ответа "отозван": позже токен истекает сам
+func NewCachedStore(store Store, cache RevocationCache, size int, access_lifetime, negative_ttl time.Duration) (*CachedStore, error) {
+
+	cached := &CachedStore{
+		Store:           store,
+		cache:           cache,
+		epochs:          newLRU[string, time.Time](size),
+		access_lifetime: access_lifetime,
+		negative_ttl:    min(negative_ttl, access_lifetime),
+	}
+
+	if err := cached.Reload(); err != nil {
+		return nil, err
+	}
+
+	return cached, nil
+}
+
+// Reload перечитывает отозванные токены из хранилища и сбрасывает ответы, которые могли устареть
+func (s *CachedStore) Reload() error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.reload()
+}
+
+// reload вызывается под s.mu
+func (s *CachedStore) reload() error {
+
+	revoked, err := s.Store.ListRevokedTokens()
+
+	if err != nil {
+		return err
+	}
+
+	s.generation++
+	s.cache.Reset(revoked)
+	s.epochs.removeIf(func(time.Time) bool { return true })
+
+	return nil
+}
+
+func (s *CachedStore) AccessTokenIsRevoked(pair_id string) (bool, error) {
+
+	if revoked, ok := s.cache.Lookup(pair_id); ok {
+		return revoked, nil
+	}
+
+	generation := s.currentGeneration()
+
+	revoked, err := s.Store.AccessTokenIsRevoked(pair_id)
+
+	if err != nil {
+		return false, err
+	}
+
+	ttl := s.negative_ttl
+	if revoked {
+		ttl = s.access_lifetime
+	}
+
+	s.mu.Lock()
+	if generation == s.generation {
+		s.cache.Add(pair_id, revoked, ttl)
+	}
+	s.mu.Unlock()
+
+	return revoked, nil
+}
+
+func (s *CachedStore) TokensValidAfter(user_id string) (time.Time, error) {
+
+	if valid_after, ok := s.epochs.get(user_id); ok {
+		return valid_after, nil
+	}
+
+	generation := s.currentGeneration()
+
+	valid_after, err := s.Store.TokensValidAfter(user_id)
+
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	s.mu.Lock()
+	if generation == s.generation {
+		s.epochs.set(user_id, valid_after, s.negative_ttl)
+	}
+	s.mu.Unlock()
+
+	return valid_after, nil
+}
+
+func (s *CachedStore) RevokeAccessToken(pair_id string, expires_time time.Time) error {
+
+	if err := s.Store.RevokeAccessToken(pair_id, expires_time); err != nil {
+		return err
+	}
+
+	s.revoked(pair_id, expires_time)
+
+	return nil
+}
+
+func (s *CachedStore) RotateRefreshToken(old RefreshToken, access_expires time.Time, new_token RefreshToken) error {
+
+	if err := s.Store.RotateRefreshToken(old, access_expires, new_token); err != nil {
+		return err
+	}
+
+	s.revoked(old.PairID, access_expires)
+
+	return nil
+}
+
+// Массовые отзывы затрагивают заранее неизвестные пары, поэтому после них кэш инвалидируется
+
+func (s *CachedStore) RevokeTokenFamily(family_id string, access_expires time.Time) error {
+
+	if err := s.Store.RevokeTokenFamily(family_id, access_expires); err != nil {
+		return err
+	}
+
+	return s.invalidate()
+}
+
+func (s *CachedStore) RevokeUserSessions(user_id, except_family_id string, access_lifetime time.Duration) error {
+
+	if err := s.Store.RevokeUserSessions(user_id, except_family_id, access_lifetime); err != nil {
+		return err
+	}
+
+	return s.invalidate()
+}
+
+func (s *CachedStore) InvalidateUserTokens(user_id string, access_lifetime time.Duration) error {
+
+	if err := s.Store.InvalidateUserTokens(user_id, access_lifetime); err != nil {
+		return err
+	}
+
+	s.UserTokensInvalidated(user_id)
+
+	return s.invalidate()
+}
+
+// invalidate сбрасывает ответы, которые мог сделать неверными массовый отзыв. Список
+// отозванных пар читается из хранилища, только если без него кэш не восстановить
+func (s *CachedStore) invalidate() error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.generation++
+
+	return s.cache.Invalidate(s.Store.ListRevokedTokens)
+}
+
+// Методы RevocationHandler: отзывы, полученные от других реплик
+
+func (s *CachedStore) AccessTokenRevoked(pair_id string) {
+	s.revoked(pair_id, time.Now().Add(s.access_lifetime))
+}
+
+func (s *CachedStore) UserTokensInvalidated(user_id string) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.generation++
+	s.epochs.remove(user_id)
+}
+
+func (s *CachedStore) Resync() error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.reload(); err != nil {
+		return err
+	}
+
+	if set, ok := s.cache.(*RevokedSet); ok {
+		set.setSynced(true)
+	}
+
+	return nil
+}
+
+func (s *CachedStore) Desync() {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if set, ok := s.cache.(*RevokedSet); ok {
+		set.setSynced(false)
+	}
+
+	// Эпохи, прочитанные до разрыва, могли устареть
+	s.generation++
+	s.epochs.removeIf(func(time.Time) bool { return true })
+}
+
+func (s *CachedStore) revoked(pair_id string, expires_time time.Time) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.generation++
+	s.cache.Add(pair_id, true, min(time.Until(expires_time), s.access_lifetime))
+}
+
+func (s *CachedStore) currentGeneration() uint64 {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.generation
+}
@@ -0,0 +1,329 @@
+package storage
+
+import (
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingStore считает обращения к хранилищу, которые AuthMiddleware делает на каждый запрос
+type countingStore struct {
+	*MemoryStore
+	calls atomic.Int64
+	lists atomic.Int64 // полные чтения списка отозванных пар
+}
+
+func (s *countingStore) AccessTokenIsRevoked(pair_id string) (bool, error) {
+	s.calls.Add(1)
+	return s.MemoryStore.AccessTokenIsRevoked(pair_id)
+}
+
+func (s *countingStore) TokensValidAfter(user_id string) (time.Time, error) {
+	s.calls.Add(1)
+	return s.MemoryStore.TokensValidAfter(user_id)
+}
+
+func (s *countingStore) ListRevokedTokens() ([]string, error) {
+	s.lists.Add(1)
+	return s.MemoryStore.ListRevokedTokens()
+}
+
+const (
+	benchmarkSessions = 10000
+	benchmarkRevoked  = 1000
+)
+
+func newBenchmarkStore(b *testing.B) *countingStore {
+
+	store := &countingStore{MemoryStore: NewMemoryStore()}
+
+	for i := 0; i < benchmarkRevoked; i++ {
+		if err := store.RevokeAccessToken("revoked-"+strconv.Itoa(i), time.Now().Add(time.Hour)); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	return store
+}
+
+// benchmarkRevocationCheck повторяет проверки AuthMiddleware для запросов от benchmarkSessions
+// сессий, каждый десятый запрос - с отозванным токеном, и сообщает число обращений к хранилищу на запрос
+func benchmarkRevocationCheck(b *testing.B, wrap func(Store) Store) {
+
+	counting := newBenchmarkStore(b)
+	store := wrap(counting)
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+
+		pair_id := "active-" + strconv.Itoa(i%benchmarkSessions)
+		if i%10 == 0 {
+			pair_id = "revoked-" + strconv.Itoa(i%benchmarkRevoked)
+		}
+
+		if _, err := store.AccessTokenIsRevoked(pair_id); err != nil {
+			b.Fatal(err)
+		}
+
+		if _, err := store.TokensValidAfter("user-" + strconv.Itoa(i%benchmarkSessions)); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.ReportMetric(float64(counting.calls.Load())/float64(b.N), "store_calls/op")
+}
+
+func newBenchmarkCachedStore(b *testing.B, store Store, cache RevocationCache) Store {
+
+	cached, err := NewCachedStore(store, cache, benchmarkSessions, 15*time.Minute, time.Minute)
+
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	return cached
+}
+
+func BenchmarkRevocationCheck(b *testing.B) {
+
+	b.Run("NoCache", func(b *testing.B) {
+		benchmarkRevocationCheck(b, func(store Store) Store { return store })
+	})
+
+	b.Run("LRU", func(b *testing.B) {
+		benchmarkRevocationCheck(b, func(store Store) Store {
+			return newBenchmarkCachedStore(b, store, NewLRUCache(benchmarkSessions))
+		})
+	})
+
+	// LRU меньше числа сессий: без фильтра промахи уходят в хранилище
+	b.Run("SmallLRU", func(b *testing.B) {
+		benchmarkRevocationCheck(b, func(store Store) Store {
+			return newBenchmarkCachedStore(b, store, NewLRUCache(benchmarkSessions/10))
+		})
+	})
+
+	// Набор, синхронизируемый уведомлениями об отзывах
+	b.Run("RevokedSet", func(b *testing.B) {
+		benchmarkRevocationCheck(b, func(store Store) Store {
+			cached := newBenchmarkCachedStore(b, store, NewRevokedSet()).(*CachedStore)
+			if err := cached.Resync(); err != nil {
+				b.Fatal(err)
+			}
+			return cached
+		})
+	})
+
+	b.Run("SmallLRUWithBloom", func(b *testing.B) {
+		benchmarkRevocationCheck(b, func(store Store) Store {
+			return newBenchmarkCachedStore(b, store, NewBloomCache(NewLRUCache(benchmarkSessions/10), benchmarkSessions/10))
+		})
+	})
+}
+
+// newSessionStore создаёт кэшированное хранилище с одной сессией пользователя user_id
+func newSessionStore(t *testing.T, cache RevocationCache, user_id, pair_id string) (*CachedStore, *countingStore) {
+
+	t.Helper()
+
+	counting := &countingStore{MemoryStore: NewMemoryStore()}
+
+	err := counting.SaveRefreshToken(RefreshToken{UserID: user_id, PairID: pair_id, TokenHash: "hash-" + pair_id, ExpiresAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cached, err := NewCachedStore(counting, cache, 100, 15*time.Minute, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cached, counting
+}
+
+func expectRevoked(t *testing.T, store Store, pair_id string, want bool) {
+
+	t.Helper()
+
+	revoked, err := store.AccessTokenIsRevoked(pair_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if revoked != want {
+		t.Fatalf("%s revoked: %v, want %v", pair_id, revoked, want)
+	}
+}
+
+func TestMassRevocationWithLRUSkipsList(t *testing.T) {
+
+	cached, counting := newSessionStore(t, NewLRUCache(100), "user", "pair")
+
+	// Ответ "не отозван" попадает в кэш
+	expectRevoked(t, cached, "pair", false)
+	expectRevoked(t, cached, "pair", false)
+
+	if calls := counting.calls.Load(); calls != 1 {
+		t.Fatalf("%d store calls for a cached answer, want 1", calls)
+	}
+
+	lists := counting.lists.Load()
+
+	if err := cached.RevokeUserSessions("user", "", 15*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	if counting.lists.Load() != lists {
+		t.Fatal("LRU cache read the revoked list on mass revocation")
+	}
+
+	// Устаревший ответ сброшен, пара отозвана
+	expectRevoked(t, cached, "pair", true)
+}
+
+func TestMassRevocationRebuildsFullCaches(t *testing.T) {
+
+	caches := map[string]func() RevocationCache{
+		"RevokedSet": func() RevocationCache { return NewRevokedSet() },
+		"Bloom":      func() RevocationCache { return NewBloomCache(NewLRUCache(100), 100) },
+	}
+
+	for name, cache := range caches {
+		t.Run(name, func(t *testing.T) {
+
+			cached, counting := newSessionStore(t, cache(), "user", "pair")
+
+			if err := cached.Resync(); err != nil {
+				t.Fatal(err)
+			}
+
+			expectRevoked(t, cached, "pair", false)
+
+			lists := counting.lists.Load()
+
+			if err := cached.RevokeTokenFamily("pair", time.Now().Add(time.Hour)); err != nil {
+				t.Fatal(err)
+			}
+
+			if counting.lists.Load() != lists+1 {
+				t.Fatalf("%d revoked list reads on mass revocation, want 1", counting.lists.Load()-lists)
+			}
+
+			expectRevoked(t, cached, "pair", true)
+		})
+	}
+}
+
+func TestInvalidateUserTokensEvictsOnlyUser(t *testing.T) {
+
+	cached, counting := newSessionStore(t, NewLRUCache(100), "alice", "pair")
+
+	for _, user_id := range []string{"alice", "bob", "alice", "bob"} {
+		if _, err := cached.TokensValidAfter(user_id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if calls := counting.calls.Load(); calls != 2 {
+		t.Fatalf("%d store calls for cached epochs, want 2", calls)
+	}
+
+	if err := cached.InvalidateUserTokens("alice", 15*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	valid_after, err := cached.TokensValidAfter("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if valid_after.IsZero() {
+		t.Fatal("stale epoch returned after InvalidateUserTokens")
+	}
+
+	if _, err = cached.TokensValidAfter("bob"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Перечитана только эпоха alice
+	if calls := counting.calls.Load(); calls != 3 {
+		t.Fatalf("%d store calls, want only alice's epoch to be re-read", calls)
+	}
+}
+
+func TestRevokedSetDesyncResync(t *testing.T) {
+
+	set := NewRevokedSet()
+	cached, counting := newSessionStore(t, set, "user", "pair")
+
+	// До первой синхронизации ответы "не отозван" не доверяются набору
+	expectRevoked(t, cached, "pair", false)
+
+	if calls := counting.calls.Load(); calls != 1 {
+		t.Fatalf("%d store calls before Resync, want 1", calls)
+	}
+
+	if err := cached.Resync(); err != nil {
+		t.Fatal(err)
+	}
+
+	expectRevoked(t, cached, "pair", false)
+
+	if calls := counting.calls.Load(); calls != 1 {
+		t.Fatalf("synced set queried the store: %d calls", calls)
+	}
+
+	// Отзыв на другой реплике во время разрыва: уведомление потеряно
+	cached.Desync()
+
+	if err := counting.RevokeAccessToken("pair", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	expectRevoked(t, cached, "pair", true)
+
+	if set.synced {
+		t.Fatal("set stays synced after Desync")
+	}
+
+	// После переподключения набор загружается заново и снова отвечает сам
+	if err := cached.Resync(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !set.synced {
+		t.Fatal("set is not synced after Resync")
+	}
+
+	calls := counting.calls.Load()
+
+	expectRevoked(t, cached, "pair", true)
+	expectRevoked(t, cached, "other", false)
+
+	if counting.calls.Load() != calls {
+		t.Fatal("resynced set queried the store")
+	}
+}
+
+func TestDesyncDropsEpochs(t *testing.T) {
+
+	cached, counting := newSessionStore(t, NewRevokedSet(), "user", "pair")
+
+	for i := 0; i < 2; i++ {
+		if _, err := cached.TokensValidAfter("user"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cached.Desync()
+
+	if _, err := cached.TokensValidAfter("user"); err != nil {
+		t.Fatal(err)
+	}
+
+	if calls := counting.calls.Load(); calls != 2 {
+		t.Fatalf("%d store calls, want the epoch to be re-read after Desync", calls)
+	}
+}
@@ -0,0 +1,619 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore хранит токены в памяти процесса. Подходит для тестов и
+// одиночного инстанса в dev окружении, данные теряются при перезапуске
+type MemoryStore struct {
+	mu             sync.RWMutex
+	refresh_tokens map[string]*RefreshToken     // token_hash -> token
+	revoked_tokens map[string]time.Time         // pair_id -> expires_at
+	token_epochs   map[string]time.Time         // user_id -> tokens_valid_after
+	users          map[string]User              // username -> user
+	clients        map[string]Client            // client_id -> client
+	codes          map[string]AuthorizationCode // code_hash -> code
+	device_codes   map[string]DeviceCode        // code_hash -> code
+	signing_keys   []SigningKey
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		refresh_tokens: make(map[string]*RefreshToken),
+		revoked_tokens: make(map[string]time.Time),
+		token_epochs:   make(map[string]time.Time),
+		users:          make(map[string]User),
+		clients:        make(map[string]Client),
+		codes:          make(map[string]AuthorizationCode),
+		device_codes:   make(map[string]DeviceCode),
+	}
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+func (s *MemoryStore) SaveRefreshToken(token RefreshToken) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.saveRefreshToken(token)
+}
+
+func (s *MemoryStore) saveRefreshToken(token RefreshToken) error {
+
+	if _, exists := s.refresh_tokens[token.TokenHash]; exists {
+		return fmt.Errorf("refresh token hash already exists")
+	}
+
+	if token.FamilyID == "" {
+		token.FamilyID = token.PairID
+	}
+
+	token.IsRevoked = false
+	token.IsRotated = false
+	token.CreatedAt = time.Now()
+
+	s.refresh_tokens[token.TokenHash] = &token
+
+	return nil
+}
+
+func (s *MemoryStore) FindRefreshToken(user_id, pair_id string) (RefreshToken, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, token := range s.refresh_tokens {
+		if token.UserID == user_id && token.PairID == pair_id {
+			return *token, nil
+		}
+	}
+
+	return RefreshToken{UserID: user_id, PairID: pair_id}, ErrNotFound
+}
+
+func (s *MemoryStore) FindRefreshTokenByPairID(pair_id string) (RefreshToken, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, token := range s.refresh_tokens {
+		if token.PairID == pair_id {
+			return *token, nil
+		}
+	}
+
+	return RefreshToken{PairID: pair_id}, ErrNotFound
+}
+
+func (s *MemoryStore) RotateRefreshToken(old RefreshToken, access_expires time.Time, new_token RefreshToken) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.refresh_tokens[old.TokenHash]
+
+	if !ok || token.IsRevoked || !token.ExpiresAt.After(time.Now()) {
+		return ErrAlreadyUsed
+	}
+
+	if _, exists := s.refresh_tokens[new_token.TokenHash]; exists {
+		return fmt.Errorf("refresh token hash already exists")
+	}
+
+	token.IsRevoked = true
+	token.IsRotated = true
+
+	if _, exists := s.revoked_tokens[old.PairID]; !exists {
+		s.revoked_tokens[old.PairID] = access_expires
+	}
+
+	new_token.FamilyID = token.FamilyID
+	new_token.ParentPairID = token.PairID
+	new_token.ClientID = token.ClientID
+	new_token.Scope = token.Scope
+
+	return s.saveRefreshToken(new_token)
+}
+
+func (s *MemoryStore) RevokeRefreshTokens(pair_id string) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, token := range s.refresh_tokens {
+		if token.PairID == pair_id {
+			token.IsRevoked = true
+		}
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) ListSessions(user_id string) ([]Session, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	started_at := make(map[string]time.Time)
+
+	for _, token := range s.refresh_tokens {
+		if token.UserID == user_id && token.PairID == token.FamilyID {
+			started_at[token.FamilyID] = token.CreatedAt
+		}
+	}
+
+	var sessions []Session
+
+	for _, token := range s.refresh_tokens {
+
+		if token.UserID != user_id || !token.IsActive() {
+			continue
+		}
+
+		sessions = append(sessions, Session{
+			PairID:     token.PairID,
+			FamilyID:   token.FamilyID,
+			UserAgent:  token.UserAgent,
+			IPAddress:  token.IPAddress,
+			CreatedAt:  started_at[token.FamilyID],
+			LastUsedAt: token.CreatedAt,
+			ExpiresAt:  token.ExpiresAt,
+		})
+	}
+
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt) })
+
+	return sessions, nil
+}
+
+func (s *MemoryStore) RevokeTokenFamily(family_id string, access_expires time.Time) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, token := range s.refresh_tokens {
+		if token.FamilyID != family_id {
+			continue
+		}
+
+		token.IsRevoked = true
+
+		if _, exists := s.revoked_tokens[token.PairID]; !exists {
+			s.revoked_tokens[token.PairID] = access_expires
+		}
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) RevokeUserSessions(user_id, except_family_id string, access_lifetime time.Duration) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	for _, token := range s.refresh_tokens {
+
+		if token.UserID != user_id || token.FamilyID == except_family_id {
+			continue
+		}
+
+		if !token.IsRevoked || token.CreatedAt.After(now.Add(-access_lifetime)) {
+			if _, exists := s.revoked_tokens[token.PairID]; !exists {
+				s.revoked_tokens[token.PairID] = now.Add(access_lifetime)
+			}
+		}
+
+		token.IsRevoked = true
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) InvalidateUserTokens(user_id string, access_lifetime time.Duration) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	valid_after := tokensEpoch(now)
+
+	if valid_after.After(s.token_epochs[user_id]) {
+		s.token_epochs[user_id] = valid_after
+	}
+
+	for _, token := range s.refresh_tokens {
+
+		if token.UserID != user_id {
+			continue
+		}
+
+		if _, exists := s.revoked_tokens[token.PairID]; !exists && !token.CreatedAt.Before(valid_after) {
+			s.revoked_tokens[token.PairID] = now.Add(access_lifetime)
+		}
+
+		token.IsRevoked = true
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) TokensValidAfter(user_id string) (time.Time, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.token_epochs[user_id], nil
+}
+
+func (s *MemoryStore) AccessTokenIsRevoked(pair_id string) (bool, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, revoked := s.revoked_tokens[pair_id]
+
+	return revoked, nil
+}
+
+func (s *MemoryStore) ListRevokedTokens() ([]string, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+
+	var list []string
+
+	for pair_id, expires_at := range s.revoked_tokens {
+		if expires_at.After(now) {
+			list = append(list, pair_id)
+		}
+	}
+
+	return list, nil
+}
+
+func (s *MemoryStore) RevokeAccessToken(pair_id string, expires_time time.Time) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.revoked_tokens[pair_id]; !exists {
+		s.revoked_tokens[pair_id] = expires_time
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) CleanRevokedTokens() error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	for pair_id, expires_at := range s.revoked_tokens {
+		if expires_at.Before(now) {
+			delete(s.revoked_tokens, pair_id)
+		}
+	}
+
+	for code_hash, code := range s.codes {
+		if code.ExpiresAt.Before(now) {
+			delete(s.codes, code_hash)
+		}
+	}
+
+	for code_hash, code := range s.device_codes {
+		if code.ExpiresAt.Before(now) {
+			delete(s.device_codes, code_hash)
+		}
+	}
+
+	for user_id, valid_after := range s.token_epochs {
+		if valid_after.Before(now.Add(-RefreshTokenLifetime())) {
+			delete(s.token_epochs, user_id)
+		}
+	}
+
+	// Корень цепочки хранит время начала сессии для ListSessions, поэтому он
+	// остаётся, пока в цепочке есть неистекшие токены
+	live_families := make(map[string]bool)
+
+	for _, token := range s.refresh_tokens {
+		if !token.ExpiresAt.Before(now) {
+			live_families[token.FamilyID] = true
+		}
+	}
+
+	// В отличие от Postgres истекшие refresh токены тоже удаляем,
+	// иначе память будет расти бесконечно
+	for hash, token := range s.refresh_tokens {
+		if token.ExpiresAt.Before(now) && !(token.PairID == token.FamilyID && live_families[token.FamilyID]) {
+			delete(s.refresh_tokens, hash)
+		}
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) CreateUser(user User) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.users[user.Username]; exists {
+		return ErrUserExists
+	}
+
+	s.users[user.Username] = user
+
+	return nil
+}
+
+func (s *MemoryStore) FindUserByUsername(username string) (User, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[username]
+
+	if !ok {
+		return User{}, ErrNotFound
+	}
+
+	return user, nil
+}
+
+func (s *MemoryStore) FindUser(user_id string) (User, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, user := range s.users {
+		if user.ID == user_id {
+			return user, nil
+		}
+	}
+
+	return User{}, ErrNotFound
+}
+
+func (s *MemoryStore) SetUserRoles(user_id string, roles []string) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for username, user := range s.users {
+		if user.ID == user_id {
+			user.Roles = roles
+			s.users[username] = user
+			return nil
+		}
+	}
+
+	return ErrNotFound
+}
+
+func (s *MemoryStore) SaveClient(client Client) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, ok := s.clients[client.ID]; ok {
+		client.CreatedAt = existing.CreatedAt
+	}
+
+	s.clients[client.ID] = client
+
+	return nil
+}
+
+func (s *MemoryStore) FindClient(client_id string) (Client, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	client, ok := s.clients[client_id]
+
+	if !ok {
+		return Client{}, ErrNotFound
+	}
+
+	return client, nil
+}
+
+func (s *MemoryStore) FindClientByCertSubject(cert_subject string) (Client, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, client := range s.clients {
+		if cert_subject != "" && client.CertSubject == cert_subject {
+			return client, nil
+		}
+	}
+
+	return Client{}, ErrNotFound
+}
+
+func (s *MemoryStore) ListClients() ([]Client, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]Client, 0, len(s.clients))
+
+	for _, client := range s.clients {
+		list = append(list, client)
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+
+	return list, nil
+}
+
+func (s *MemoryStore) DeleteClient(client_id string) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.clients[client_id]; !ok {
+		return ErrNotFound
+	}
+
+	delete(s.clients, client_id)
+
+	return nil
+}
+
+func (s *MemoryStore) SaveAuthorizationCode(code AuthorizationCode) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.codes[code.CodeHash] = code
+
+	return nil
+}
+
+func (s *MemoryStore) ConsumeAuthorizationCode(code_hash string) (AuthorizationCode, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	code, ok := s.codes[code_hash]
+
+	delete(s.codes, code_hash)
+
+	if !ok || !code.ExpiresAt.After(time.Now()) {
+		return AuthorizationCode{}, ErrNotFound
+	}
+
+	return code, nil
+}
+
+func (s *MemoryStore) SaveDeviceCode(code DeviceCode) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.device_codes {
+		if existing.UserCode == code.UserCode {
+			return fmt.Errorf("user code %s already exists", code.UserCode)
+		}
+	}
+
+	s.device_codes[code.CodeHash] = code
+
+	return nil
+}
+
+func (s *MemoryStore) FindDeviceCode(user_code string) (DeviceCode, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, code := range s.device_codes {
+		if code.UserCode == user_code && code.ExpiresAt.After(time.Now()) {
+			return code, nil
+		}
+	}
+
+	return DeviceCode{}, ErrNotFound
+}
+
+func (s *MemoryStore) ResolveDeviceCode(user_code, user_id, status string) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for code_hash, code := range s.device_codes {
+		if code.UserCode == user_code && code.Status == DeviceCodePending && code.ExpiresAt.After(time.Now()) {
+			code.UserID = user_id
+			code.Status = status
+			s.device_codes[code_hash] = code
+			return nil
+		}
+	}
+
+	return ErrNotFound
+}
+
+func (s *MemoryStore) PollDeviceCode(code_hash string) (DeviceCode, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	code, ok := s.device_codes[code_hash]
+
+	if !ok {
+		return DeviceCode{}, ErrNotFound
+	}
+
+	polled := code
+	polled.LastPolledAt = time.Now()
+	s.device_codes[code_hash] = polled
+
+	return code, nil
+}
+
+func (s *MemoryStore) ConsumeDeviceCode(code_hash string) (DeviceCode, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	code, ok := s.device_codes[code_hash]
+
+	if !ok || code.Status == DeviceCodePending {
+		return DeviceCode{}, ErrNotFound
+	}
+
+	delete(s.device_codes, code_hash)
+
+	return code, nil
+}
+
+func (s *MemoryStore) SaveSigningKey(key SigningKey) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.signing_keys = append(s.signing_keys, key)
+
+	sort.Slice(s.signing_keys, func(i, j int) bool { return s.signing_keys[i].CreatedAt.Before(s.signing_keys[j].CreatedAt) })
+
+	return nil
+}
+
+func (s *MemoryStore) ListSigningKeys() ([]SigningKey, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]SigningKey(nil), s.signing_keys...), nil
+}
+
+func (s *MemoryStore) DeleteSigningKey(kid string) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, key := range s.signing_keys {
+		if key.ID == kid {
+			s.signing_keys = append(s.signing_keys[:i], s.signing_keys[i+1:]...)
+			break
+		}
+	}
+
+	return nil
+}
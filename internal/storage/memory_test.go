@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCleanRevokedTokensKeepsLiveFamilyRoot(t *testing.T) {
+
+	store := NewMemoryStore()
+
+	root := RefreshToken{UserID: "u1", PairID: "p1", TokenHash: "h1", ExpiresAt: time.Now().Add(time.Hour)}
+	if err := store.SaveRefreshToken(root); err != nil {
+		t.Fatal(err)
+	}
+
+	started_at := store.refresh_tokens["h1"].CreatedAt
+
+	// Цепочка p1 -> p2 -> p3
+	previous := root
+
+	for _, next := range []RefreshToken{
+		{UserID: "u1", PairID: "p2", TokenHash: "h2", ExpiresAt: time.Now().Add(time.Hour)},
+		{UserID: "u1", PairID: "p3", TokenHash: "h3", ExpiresAt: time.Now().Add(time.Hour)},
+	} {
+		if err := store.RotateRefreshToken(previous, time.Now().Add(time.Minute), next); err != nil {
+			t.Fatal(err)
+		}
+		previous = next
+	}
+
+	// Корень и промежуточная пара истекли раньше текущей пары цепочки
+	store.refresh_tokens["h1"].ExpiresAt = time.Now().Add(-time.Minute)
+	store.refresh_tokens["h2"].ExpiresAt = time.Now().Add(-time.Minute)
+
+	// Цепочка другой сессии истекла целиком
+	if err := store.SaveRefreshToken(RefreshToken{UserID: "u1", PairID: "p9", TokenHash: "h9", ExpiresAt: time.Now().Add(-time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.CleanRevokedTokens(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := store.refresh_tokens["h2"]; ok {
+		t.Fatal("expired rotated pair kept")
+	}
+
+	if _, ok := store.refresh_tokens["h9"]; ok {
+		t.Fatal("expired family kept")
+	}
+
+	sessions, err := store.ListSessions("u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sessions) != 1 || sessions[0].PairID != "p3" || !sessions[0].CreatedAt.Equal(started_at) {
+		t.Fatalf("sessions %+v, want p3 started at %v", sessions, started_at)
+	}
+}
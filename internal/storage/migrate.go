@@ -0,0 +1,352 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redeflesq/auth-example/migrations"
+)
+
+// Произвольный ключ для pg_advisory_lock, общий для всех реплик
+const migrationLockKey = 0x61757468
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Migrator реализуется хранилищами со схемой (Postgres, SQLite)
+type Migrator interface {
+	MigrateUp() error
+	MigrateDown(steps int) error
+	MigrationStatus() ([]MigrationStatus, error)
+}
+
+func LoadMigrations(dialect string) ([]Migration, error) {
+
+	files, err := fs.Glob(migrations.FS, path.Join(dialect, "*.sql"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	by_version := make(map[int]*Migration)
+
+	for _, file := range files {
+
+		base := path.Base(file)
+
+		var direction string
+		switch {
+		case strings.HasSuffix(base, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(base, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("invalid migration file name %q", base)
+		}
+
+		version_str, name, ok := strings.Cut(strings.TrimSuffix(base, "."+direction+".sql"), "_")
+		version, err := strconv.Atoi(version_str)
+
+		if !ok || err != nil || version < 1 {
+			return nil, fmt.Errorf("invalid migration file name %q", base)
+		}
+
+		content, err := fs.ReadFile(migrations.FS, file)
+
+		if err != nil {
+			return nil, err
+		}
+
+		migration, exists := by_version[version]
+
+		if !exists {
+			migration = &Migration{Version: version, Name: name}
+			by_version[version] = migration
+		}
+
+		if direction == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	list := make([]Migration, 0, len(by_version))
+
+	for _, migration := range by_version {
+
+		if migration.Up == "" {
+			return nil, fmt.Errorf("migration %04d_%s has no up script", migration.Version, migration.Name)
+		}
+
+		list = append(list, *migration)
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+
+	return list, nil
+}
+
+// sqlMigrator применяет миграции из migrations.FS и ведёт учёт
+// применённых версий в таблице schema_migrations
+type sqlMigrator struct {
+	db      *sql.DB
+	dialect string
+	lock    string
+	unlock  string
+}
+
+// rebind переводит позиционные плейсхолдеры (?) в нумерованные ($N) для Postgres.
+// В SQLite $N связываются в порядке появления, поэтому там остаются ?
+func (m *sqlMigrator) rebind(query string) string {
+
+	if m.dialect != "postgres" {
+		return query
+	}
+
+	var builder strings.Builder
+
+	n := 0
+
+	for _, char := range query {
+
+		if char != '?' {
+			builder.WriteRune(char)
+			continue
+		}
+
+		n++
+		builder.WriteString("$" + strconv.Itoa(n))
+	}
+
+	return builder.String()
+}
+
+func (m *sqlMigrator) withConn(fn func(ctx context.Context, conn *sql.Conn) error) error {
+
+	ctx := context.Background()
+
+	conn, err := m.db.Conn(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	// Блокировка держится на соединении, поэтому все миграции идут через него
+	if m.lock != "" {
+
+		if _, err = conn.ExecContext(ctx, m.lock); err != nil {
+			return fmt.Errorf("failed to acquire migration lock: %w", err)
+		}
+
+		defer func() {
+			if _, err := conn.ExecContext(ctx, m.unlock); err != nil {
+				log.Printf("Failed to release migration lock: %v", err)
+			}
+		}()
+	}
+
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version INTEGER PRIMARY KEY,
+    name TEXT NOT NULL,
+    applied_at TIMESTAMP NOT NULL
+)`)
+
+	if err != nil {
+		return err
+	}
+
+	return fn(ctx, conn)
+}
+
+func (m *sqlMigrator) appliedVersions(ctx context.Context, conn *sql.Conn) (map[int]time.Time, error) {
+
+	rows, err := conn.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+
+	for rows.Next() {
+
+		var version int
+		var applied_at time.Time
+
+		if err = rows.Scan(&version, &applied_at); err != nil {
+			return nil, err
+		}
+
+		applied[version] = applied_at
+	}
+
+	return applied, rows.Err()
+}
+
+func (m *sqlMigrator) apply(ctx context.Context, conn *sql.Conn, script string, record func(tx *sql.Tx) error) error {
+
+	tx, err := conn.BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+
+	if err = record(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m *sqlMigrator) MigrateUp() error {
+
+	list, err := LoadMigrations(m.dialect)
+
+	if err != nil {
+		return err
+	}
+
+	return m.withConn(func(ctx context.Context, conn *sql.Conn) error {
+
+		applied, err := m.appliedVersions(ctx, conn)
+
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range list {
+
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+
+			err = m.apply(ctx, conn, migration.Up, func(tx *sql.Tx) error {
+				_, err := tx.ExecContext(ctx,
+					m.rebind("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)"),
+					migration.Version, migration.Name, time.Now().UTC(),
+				)
+				return err
+			})
+
+			if err != nil {
+				return fmt.Errorf("migration %04d_%s failed: %w", migration.Version, migration.Name, err)
+			}
+
+			log.Printf("Migration %04d_%s applied", migration.Version, migration.Name)
+		}
+
+		return nil
+	})
+}
+
+func (m *sqlMigrator) MigrateDown(steps int) error {
+
+	list, err := LoadMigrations(m.dialect)
+
+	if err != nil {
+		return err
+	}
+
+	return m.withConn(func(ctx context.Context, conn *sql.Conn) error {
+
+		applied, err := m.appliedVersions(ctx, conn)
+
+		if err != nil {
+			return err
+		}
+
+		for i := len(list) - 1; i >= 0 && steps > 0; i-- {
+
+			migration := list[i]
+
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+
+			if migration.Down == "" {
+				return fmt.Errorf("migration %04d_%s has no down script", migration.Version, migration.Name)
+			}
+
+			err = m.apply(ctx, conn, migration.Down, func(tx *sql.Tx) error {
+				_, err := tx.ExecContext(ctx, m.rebind("DELETE FROM schema_migrations WHERE version = ?"), migration.Version)
+				return err
+			})
+
+			if err != nil {
+				return fmt.Errorf("migration %04d_%s rollback failed: %w", migration.Version, migration.Name, err)
+			}
+
+			log.Printf("Migration %04d_%s rolled back", migration.Version, migration.Name)
+
+			steps--
+		}
+
+		return nil
+	})
+}
+
+func (m *sqlMigrator) MigrationStatus() ([]MigrationStatus, error) {
+
+	list, err := LoadMigrations(m.dialect)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var status []MigrationStatus
+
+	err = m.withConn(func(ctx context.Context, conn *sql.Conn) error {
+
+		applied, err := m.appliedVersions(ctx, conn)
+
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range list {
+
+			applied_at, ok := applied[migration.Version]
+
+			status = append(status, MigrationStatus{
+				Version:   migration.Version,
+				Name:      migration.Name,
+				Applied:   ok,
+				AppliedAt: applied_at,
+			})
+		}
+
+		return nil
+	})
+
+	return status, err
+}
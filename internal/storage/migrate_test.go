@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestMigratorRebind(t *testing.T) {
+
+	query := "INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)"
+
+	if got := (&sqlMigrator{dialect: "sqlite"}).rebind(query); got != query {
+		t.Fatalf("sqlite: %s", got)
+	}
+
+	if got := (&sqlMigrator{dialect: "postgres"}).rebind(query); got != "INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)" {
+		t.Fatalf("postgres: %s", got)
+	}
+}
+
+func TestSQLiteMigrateUpDown(t *testing.T) {
+
+	if !sqliteAvailable {
+		t.Skip("sqlite driver requires cgo")
+	}
+
+	t.Setenv("SQLITE_PATH", filepath.Join(t.TempDir(), "auth.db"))
+
+	store, err := NewSQLiteStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	list, err := LoadMigrations("sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = store.MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = store.MigrateDown(1); err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := store.MigrationStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, migration := range status {
+
+		// Откатывается только последняя миграция, остальные записаны с версией и именем
+		if want := i < len(list)-1; migration.Applied != want || migration.Name != list[i].Name {
+			t.Fatalf("migration %04d_%s applied %v, want %v", migration.Version, migration.Name, migration.Applied, want)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const revocationChannel = "token_revocations"
+
+// Как часто проверять соединение LISTEN, если уведомлений нет
+const listenerPingInterval = 90 * time.Second
+
+// RevocationNotifier реализуется хранилищами, которые сообщают об отзывах, сделанных любой репликой
+type RevocationNotifier interface {
+	// ListenRevocations передаёт отзывы в handler до ошибки подписки. После каждого
+	// (пере)подключения вызывается Resync, так как уведомления за время разрыва потеряны
+	ListenRevocations(handler RevocationHandler) error
+}
+
+type RevocationHandler interface {
+	AccessTokenRevoked(pair_id string)
+	UserTokensInvalidated(user_id string)
+	// Resync загружает полный список отзывов после подключения
+	Resync() error
+	// Desync вызывается при разрыве: до Resync об отзывах на других репликах ничего не известно
+	Desync()
+}
+
+// RevocationSync возвращает режим синхронизации отзывов из REVOCATION_SYNC: "notify" - LISTEN/NOTIFY (только postgres)
+func RevocationSync() string {
+	return os.Getenv("REVOCATION_SYNC")
+}
+
+func (s *PostgresStore) ListenRevocations(handler RevocationHandler) error {
+
+	listener := pq.NewListener(s.db_auth, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		switch event {
+		case pq.ListenerEventDisconnected:
+			log.Printf("Revocation listener disconnected: %v", err)
+			handler.Desync()
+		case pq.ListenerEventConnectionAttemptFailed:
+			log.Printf("Revocation listener reconnect failed: %v", err)
+		case pq.ListenerEventReconnected:
+			log.Println("Revocation listener reconnected")
+		}
+	})
+
+	defer listener.Close()
+
+	if err := listener.Listen(revocationChannel); err != nil {
+		return err
+	}
+
+	// Отзывы до подписки могли пройти мимо
+	synced := resync(handler)
+
+	for {
+		select {
+
+		case notification := <-listener.Notify:
+
+			// nil приходит после переподключения
+			if notification == nil {
+				synced = resync(handler)
+				continue
+			}
+
+			if err := dispatchRevocation(handler, notification.Extra); err != nil {
+				log.Println(err)
+			}
+
+		case <-time.After(listenerPingInterval):
+
+			if !synced {
+				synced = resync(handler)
+			}
+
+			go listener.Ping()
+		}
+	}
+}
+
+func resync(handler RevocationHandler) bool {
+
+	if err := handler.Resync(); err != nil {
+		log.Printf("Revocation resync error: %v", err)
+		return false
+	}
+
+	return true
+}
+
+func dispatchRevocation(handler RevocationHandler, payload string) error {
+
+	kind, id, ok := strings.Cut(payload, ":")
+
+	switch {
+	case ok && kind == "access":
+		handler.AccessTokenRevoked(id)
+	case ok && kind == "epoch":
+		handler.UserTokensInvalidated(id)
+	default:
+		return fmt.Errorf("unknown revocation notification %q", payload)
+	}
+
+	return nil
+}
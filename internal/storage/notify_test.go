@@ -0,0 +1,52 @@
+package storage
+
+import "testing"
+
+// recordingHandler запоминает отзывы, переданные dispatchRevocation
+type recordingHandler struct {
+	access []string
+	epochs []string
+}
+
+func (h *recordingHandler) AccessTokenRevoked(pair_id string) { h.access = append(h.access, pair_id) }
+func (h *recordingHandler) UserTokensInvalidated(user_id string) {
+	h.epochs = append(h.epochs, user_id)
+}
+func (h *recordingHandler) Resync() error { return nil }
+func (h *recordingHandler) Desync()       {}
+
+func TestDispatchRevocation(t *testing.T) {
+
+	handler := &recordingHandler{}
+
+	if err := dispatchRevocation(handler, "access:pair-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := dispatchRevocation(handler, "epoch:user-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(handler.access) != 1 || handler.access[0] != "pair-1" {
+		t.Fatalf("access revocations %v, want [pair-1]", handler.access)
+	}
+
+	if len(handler.epochs) != 1 || handler.epochs[0] != "user-1" {
+		t.Fatalf("epoch invalidations %v, want [user-1]", handler.epochs)
+	}
+}
+
+func TestDispatchRevocationRejectsMalformed(t *testing.T) {
+
+	handler := &recordingHandler{}
+
+	for _, payload := range []string{"", "access", "pair-1", "refresh:pair-1", "ACCESS:pair-1"} {
+		if err := dispatchRevocation(handler, payload); err == nil {
+			t.Errorf("payload %q accepted", payload)
+		}
+	}
+
+	if len(handler.access) != 0 || len(handler.epochs) != 0 {
+		t.Fatalf("malformed payloads dispatched: %v, %v", handler.access, handler.epochs)
+	}
+}
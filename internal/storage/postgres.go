@@ -0,0 +1,721 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+type PostgresStore struct {
+	db      *sql.DB
+	db_auth string // строка подключения для LISTEN, которому нужно отдельное соединение
+	*sqlMigrator
+}
+
+func NewPostgresStore() (*PostgresStore, error) {
+
+	db_auth := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
+		os.Getenv("DB_HOST"),
+		os.Getenv("DB_PORT"),
+		os.Getenv("DB_USER"),
+		os.Getenv("DB_PASSWORD"),
+		os.Getenv("DB_NAME"),
+	)
+
+	attemps, err := strconv.Atoi(os.Getenv("DB_CONNECT_ATTEMPS"))
+
+	if err != nil || attemps < 1 {
+		attemps = 10
+	}
+
+	for i := 0; i < attemps; i++ {
+
+		db, err := sql.Open("postgres", db_auth)
+
+		if err != nil {
+			log.Printf("Failed to open DB: %v (attempt %d/%d)", err, i+1, attemps)
+			time.Sleep(2 * time.Second)
+			continue
+		}
+
+		if err = db.Ping(); err == nil {
+			log.Println("DB connected")
+			return &PostgresStore{db: db, db_auth: db_auth, sqlMigrator: &sqlMigrator{
+				db:      db,
+				dialect: "postgres",
+				lock:    fmt.Sprintf("SELECT pg_advisory_lock(%d)", migrationLockKey),
+				unlock:  fmt.Sprintf("SELECT pg_advisory_unlock(%d)", migrationLockKey),
+			}}, nil
+		}
+
+		log.Printf("DB ping failed: %v", err)
+
+		db.Close()
+
+		time.Sleep(2 * time.Second)
+	}
+
+	return nil, fmt.Errorf("failed to connect to DB after %d attempts", attemps)
+}
+
+func (s *PostgresStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *PostgresStore) SaveRefreshToken(token RefreshToken) error {
+	return s.insertRefreshToken(s.db, token)
+}
+
+func (s *PostgresStore) insertRefreshToken(exec execer, token RefreshToken) error {
+
+	if token.FamilyID == "" {
+		token.FamilyID = token.PairID
+	}
+
+	_, err := exec.Exec(
+		`INSERT INTO refresh_tokens (user_id, pair_id, family_id, parent_pair_id, client_id, token_hash, user_agent, ip_address, expires_at, scope)
+         VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, $7, $8, $9, $10)`,
+		token.UserID,
+		token.PairID,
+		token.FamilyID,
+		token.ParentPairID,
+		token.ClientID,
+		token.TokenHash,
+		token.UserAgent,
+		token.IPAddress,
+		token.ExpiresAt,
+		token.Scope,
+	)
+
+	return err
+}
+
+func (s *PostgresStore) FindRefreshToken(user_id, pair_id string) (RefreshToken, error) {
+
+	token := RefreshToken{UserID: user_id, PairID: pair_id}
+
+	err := s.db.QueryRow(
+		`SELECT family_id, COALESCE(parent_pair_id, ''), client_id, token_hash, ip_address, user_agent, is_revoked, is_rotated, created_at, expires_at, scope
+         FROM refresh_tokens WHERE user_id = $1 AND pair_id = $2`,
+		user_id, pair_id,
+	).Scan(&token.FamilyID, &token.ParentPairID, &token.ClientID, &token.TokenHash, &token.IPAddress, &token.UserAgent,
+		&token.IsRevoked, &token.IsRotated, &token.CreatedAt, &token.ExpiresAt, &token.Scope)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return token, ErrNotFound
+	}
+
+	return token, err
+}
+
+func (s *PostgresStore) FindRefreshTokenByPairID(pair_id string) (RefreshToken, error) {
+
+	token := RefreshToken{PairID: pair_id}
+
+	err := s.db.QueryRow(
+		`SELECT user_id, family_id, COALESCE(parent_pair_id, ''), client_id, token_hash, ip_address, user_agent, is_revoked, is_rotated, created_at, expires_at, scope
+         FROM refresh_tokens WHERE pair_id = $1`,
+		pair_id,
+	).Scan(&token.UserID, &token.FamilyID, &token.ParentPairID, &token.ClientID, &token.TokenHash, &token.IPAddress, &token.UserAgent,
+		&token.IsRevoked, &token.IsRotated, &token.CreatedAt, &token.ExpiresAt, &token.Scope)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return token, ErrNotFound
+	}
+
+	return token, err
+}
+
+func (s *PostgresStore) RotateRefreshToken(old RefreshToken, access_expires time.Time, new_token RefreshToken) error {
+
+	tx, err := s.db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	// Условный UPDATE берёт блокировку строки: конкурентная транзакция дождётся
+	// коммита, перепроверит is_revoked и не затронет ни одной строки
+	result, err := tx.Exec(
+		"UPDATE refresh_tokens SET is_revoked = true, is_rotated = true WHERE token_hash = $1 AND is_revoked = false AND expires_at > NOW()",
+		old.TokenHash,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	if rows, err := result.RowsAffected(); err != nil {
+		return err
+	} else if rows != 1 {
+		return ErrAlreadyUsed
+	}
+
+	_, err = tx.Exec(
+		"INSERT INTO revoked_tokens (pair_id, expires_at) VALUES ($1, $2) ON CONFLICT (pair_id) DO NOTHING",
+		old.PairID,
+		access_expires,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	new_token.FamilyID = old.FamilyID
+	new_token.ParentPairID = old.PairID
+	new_token.ClientID = old.ClientID
+	new_token.Scope = old.Scope
+
+	if err = s.insertRefreshToken(tx, new_token); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *PostgresStore) RevokeRefreshTokens(pair_id string) error {
+
+	_, err := s.db.Exec("UPDATE refresh_tokens SET is_revoked = true WHERE pair_id = $1", pair_id)
+
+	return err
+}
+
+func (s *PostgresStore) ListSessions(user_id string) ([]Session, error) {
+
+	// family_id совпадает с pair_id первой пары цепочки, её created_at - момент входа
+	rows, err := s.db.Query(
+		`SELECT t.pair_id, t.family_id, t.user_agent, t.ip_address, f.created_at, t.created_at, t.expires_at
+         FROM refresh_tokens t
+         JOIN refresh_tokens f ON f.pair_id = t.family_id
+         WHERE t.user_id = $1 AND t.is_revoked = false AND t.expires_at > NOW()
+         ORDER BY t.created_at DESC`,
+		user_id,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var sessions []Session
+
+	for rows.Next() {
+
+		var session Session
+
+		err = rows.Scan(&session.PairID, &session.FamilyID, &session.UserAgent, &session.IPAddress,
+			&session.CreatedAt, &session.LastUsedAt, &session.ExpiresAt)
+
+		if err != nil {
+			return nil, err
+		}
+
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+func (s *PostgresStore) RevokeTokenFamily(family_id string, access_expires time.Time) error {
+
+	tx, err := s.db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE refresh_tokens SET is_revoked = true WHERE family_id = $1", family_id)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO revoked_tokens (pair_id, expires_at)
+         SELECT pair_id, $2 FROM refresh_tokens WHERE family_id = $1
+         ON CONFLICT (pair_id) DO NOTHING`,
+		family_id,
+		access_expires,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *PostgresStore) RevokeUserSessions(user_id, except_family_id string, access_lifetime time.Duration) error {
+
+	now := time.Now()
+
+	tx, err := s.db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	// Пары выбираются до отзыва refresh токенов, иначе признак активности будет потерян
+	_, err = tx.Exec(
+		`INSERT INTO revoked_tokens (pair_id, expires_at)
+         SELECT pair_id, $1 FROM refresh_tokens
+         WHERE user_id = $2 AND family_id <> $3 AND (is_revoked = false OR created_at > $4)
+         ON CONFLICT (pair_id) DO NOTHING`,
+		now.Add(access_lifetime),
+		user_id,
+		except_family_id,
+		now.Add(-access_lifetime),
+	)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		"UPDATE refresh_tokens SET is_revoked = true WHERE user_id = $1 AND family_id <> $2 AND is_revoked = false",
+		user_id,
+		except_family_id,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *PostgresStore) InvalidateUserTokens(user_id string, access_lifetime time.Duration) error {
+
+	now := time.Now()
+	valid_after := tokensEpoch(now)
+
+	tx, err := s.db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	// Эпоха только растёт, даже если часы реплик расходятся
+	_, err = tx.Exec(
+		`INSERT INTO user_token_epochs (user_id, tokens_valid_after) VALUES ($1, $2)
+         ON CONFLICT (user_id) DO UPDATE SET tokens_valid_after = GREATEST(user_token_epochs.tokens_valid_after, EXCLUDED.tokens_valid_after)`,
+		user_id,
+		valid_after,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO revoked_tokens (pair_id, expires_at)
+         SELECT pair_id, $1 FROM refresh_tokens WHERE user_id = $2 AND created_at >= $3
+         ON CONFLICT (pair_id) DO NOTHING`,
+		now.Add(access_lifetime),
+		user_id,
+		valid_after,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE refresh_tokens SET is_revoked = true WHERE user_id = $1 AND is_revoked = false", user_id)
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *PostgresStore) TokensValidAfter(user_id string) (time.Time, error) {
+
+	var valid_after time.Time
+	err := s.db.QueryRow("SELECT tokens_valid_after FROM user_token_epochs WHERE user_id = $1", user_id).Scan(&valid_after)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, nil
+	}
+
+	return valid_after, err
+}
+
+func (s *PostgresStore) AccessTokenIsRevoked(pair_id string) (bool, error) {
+
+	var revoked bool
+	err := s.db.QueryRow(
+		"SELECT EXISTS(SELECT 1 FROM revoked_tokens WHERE pair_id = $1)",
+		pair_id,
+	).Scan(&revoked)
+
+	return revoked, err
+}
+
+func (s *PostgresStore) ListRevokedTokens() ([]string, error) {
+
+	rows, err := s.db.Query("SELECT pair_id FROM revoked_tokens WHERE expires_at > NOW()")
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var list []string
+
+	for rows.Next() {
+
+		var pair_id string
+
+		if err = rows.Scan(&pair_id); err != nil {
+			return nil, err
+		}
+
+		list = append(list, pair_id)
+	}
+
+	return list, rows.Err()
+}
+
+func (s *PostgresStore) RevokeAccessToken(pair_id string, expires_time time.Time) error {
+
+	_, err := s.db.Exec(
+		"INSERT INTO revoked_tokens (pair_id, expires_at) VALUES ($1, $2) ON CONFLICT (pair_id) DO NOTHING",
+		pair_id,
+		expires_time,
+	)
+
+	return err
+}
+
+func (s *PostgresStore) CleanRevokedTokens() error {
+
+	_, err := s.db.Exec("DELETE FROM revoked_tokens WHERE expires_at < NOW()")
+
+	if err != nil {
+		return err
+	}
+
+	// Токены, выпущенные до такой эпохи, уже истекли
+	_, err = s.db.Exec("DELETE FROM user_token_epochs WHERE tokens_valid_after < $1", time.Now().Add(-RefreshTokenLifetime()))
+
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec("DELETE FROM authorization_codes WHERE expires_at < NOW()")
+
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec("DELETE FROM device_codes WHERE expires_at < NOW()")
+
+	return err
+}
+
+func (s *PostgresStore) CreateUser(user User) error {
+
+	result, err := s.db.Exec(
+		"INSERT INTO users (id, username, password_hash, roles, created_at) VALUES ($1, $2, $3, $4, $5) ON CONFLICT (username) DO NOTHING",
+		user.ID,
+		user.Username,
+		user.PasswordHash,
+		strings.Join(user.Roles, " "),
+		user.CreatedAt,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrUserExists
+	}
+
+	return nil
+}
+
+func (s *PostgresStore) FindUserByUsername(username string) (User, error) {
+	return scanUser(s.db.QueryRow("SELECT "+userColumns+" FROM users WHERE username = $1", username))
+}
+
+func (s *PostgresStore) FindUser(user_id string) (User, error) {
+	return scanUser(s.db.QueryRow("SELECT "+userColumns+" FROM users WHERE id = $1", user_id))
+}
+
+func (s *PostgresStore) SetUserRoles(user_id string, roles []string) error {
+
+	result, err := s.db.Exec("UPDATE users SET roles = $1 WHERE id = $2", strings.Join(roles, " "), user_id)
+
+	if err != nil {
+		return err
+	}
+
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *PostgresStore) SaveClient(client Client) error {
+
+	_, err := s.db.Exec(
+		`INSERT INTO clients (client_id, secret_hash, cert_subject, redirect_uris, scopes, created_at) VALUES ($1, $2, $3, $4, $5, $6)
+         ON CONFLICT (client_id) DO UPDATE
+         SET secret_hash = EXCLUDED.secret_hash, cert_subject = EXCLUDED.cert_subject, redirect_uris = EXCLUDED.redirect_uris,
+             scopes = EXCLUDED.scopes`,
+		client.ID,
+		client.SecretHash,
+		client.CertSubject,
+		strings.Join(client.RedirectURIs, " "),
+		strings.Join(client.Scopes, " "),
+		client.CreatedAt,
+	)
+
+	return err
+}
+
+func (s *PostgresStore) FindClient(client_id string) (Client, error) {
+	return s.findClient("SELECT "+clientColumns+" FROM clients WHERE client_id = $1", client_id)
+}
+
+func (s *PostgresStore) FindClientByCertSubject(cert_subject string) (Client, error) {
+	return s.findClient("SELECT "+clientColumns+" FROM clients WHERE cert_subject = $1 AND cert_subject <> ''", cert_subject)
+}
+
+func (s *PostgresStore) findClient(query string, arg string) (Client, error) {
+
+	client, err := scanClient(s.db.QueryRow(query, arg))
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return Client{}, ErrNotFound
+	}
+
+	return client, err
+}
+
+func (s *PostgresStore) ListClients() ([]Client, error) {
+
+	rows, err := s.db.Query("SELECT " + clientColumns + " FROM clients ORDER BY client_id")
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var list []Client
+
+	for rows.Next() {
+
+		client, err := scanClient(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, client)
+	}
+
+	return list, rows.Err()
+}
+
+func (s *PostgresStore) DeleteClient(client_id string) error {
+
+	result, err := s.db.Exec("DELETE FROM clients WHERE client_id = $1", client_id)
+
+	if err != nil {
+		return err
+	}
+
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *PostgresStore) SaveAuthorizationCode(code AuthorizationCode) error {
+
+	_, err := s.db.Exec(
+		`INSERT INTO authorization_codes (code_hash, client_id, user_id, redirect_uri, code_challenge, scope, expires_at)
+         VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		code.CodeHash,
+		code.ClientID,
+		code.UserID,
+		code.RedirectURI,
+		code.CodeChallenge,
+		code.Scope,
+		code.ExpiresAt,
+	)
+
+	return err
+}
+
+func (s *PostgresStore) ConsumeAuthorizationCode(code_hash string) (AuthorizationCode, error) {
+
+	// DELETE ... RETURNING: из параллельных обменов одного кода строку получит только один
+	code := AuthorizationCode{CodeHash: code_hash}
+	err := s.db.QueryRow(
+		`DELETE FROM authorization_codes WHERE code_hash = $1 AND expires_at > NOW()
+         RETURNING client_id, user_id, redirect_uri, code_challenge, scope, expires_at`,
+		code_hash,
+	).Scan(&code.ClientID, &code.UserID, &code.RedirectURI, &code.CodeChallenge, &code.Scope, &code.ExpiresAt)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return AuthorizationCode{}, ErrNotFound
+	}
+
+	return code, err
+}
+
+func (s *PostgresStore) SaveDeviceCode(code DeviceCode) error {
+
+	_, err := s.db.Exec(
+		`INSERT INTO device_codes (code_hash, user_code, client_id, status, user_agent, ip_address, scope, expires_at)
+         VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		code.CodeHash,
+		code.UserCode,
+		code.ClientID,
+		code.Status,
+		code.UserAgent,
+		code.IPAddress,
+		code.Scope,
+		code.ExpiresAt,
+	)
+
+	return err
+}
+
+func (s *PostgresStore) FindDeviceCode(user_code string) (DeviceCode, error) {
+	return scanDeviceCode(s.db.QueryRow(
+		"SELECT "+deviceCodeColumns+" FROM device_codes WHERE user_code = $1 AND expires_at > NOW()",
+		user_code,
+	))
+}
+
+func (s *PostgresStore) ResolveDeviceCode(user_code, user_id, status string) error {
+
+	result, err := s.db.Exec(
+		"UPDATE device_codes SET user_id = $1, status = $2 WHERE user_code = $3 AND status = $4 AND expires_at > NOW()",
+		user_id, status, user_code, DeviceCodePending,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	if rows, err := result.RowsAffected(); err != nil {
+		return err
+	} else if rows != 1 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *PostgresStore) PollDeviceCode(code_hash string) (DeviceCode, error) {
+
+	tx, err := s.db.Begin()
+
+	if err != nil {
+		return DeviceCode{}, err
+	}
+
+	defer tx.Rollback()
+
+	code, err := scanDeviceCode(tx.QueryRow("SELECT "+deviceCodeColumns+" FROM device_codes WHERE code_hash = $1 FOR UPDATE", code_hash))
+
+	if err != nil {
+		return DeviceCode{}, err
+	}
+
+	if _, err = tx.Exec("UPDATE device_codes SET last_polled_at = $1 WHERE code_hash = $2", time.Now(), code_hash); err != nil {
+		return DeviceCode{}, err
+	}
+
+	return code, tx.Commit()
+}
+
+func (s *PostgresStore) ConsumeDeviceCode(code_hash string) (DeviceCode, error) {
+
+	// DELETE ... RETURNING: из параллельных опросов токены получит только один
+	return scanDeviceCode(s.db.QueryRow(
+		"DELETE FROM device_codes WHERE code_hash = $1 AND status <> $2 RETURNING "+deviceCodeColumns,
+		code_hash, DeviceCodePending,
+	))
+}
+
+func (s *PostgresStore) SaveSigningKey(key SigningKey) error {
+
+	_, err := s.db.Exec(
+		"INSERT INTO signing_keys (kid, algorithm, private_key, created_at) VALUES ($1, $2, $3, $4)",
+		key.ID,
+		key.Algorithm,
+		string(key.PrivateKey),
+		key.CreatedAt,
+	)
+
+	return err
+}
+
+func (s *PostgresStore) ListSigningKeys() ([]SigningKey, error) {
+
+	rows, err := s.db.Query("SELECT kid, algorithm, private_key, created_at FROM signing_keys ORDER BY created_at")
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var list []SigningKey
+
+	for rows.Next() {
+
+		var key SigningKey
+		var private_key string
+
+		if err = rows.Scan(&key.ID, &key.Algorithm, &private_key, &key.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		key.PrivateKey = []byte(private_key)
+
+		list = append(list, key)
+	}
+
+	return list, rows.Err()
+}
+
+func (s *PostgresStore) DeleteSigningKey(kid string) error {
+
+	_, err := s.db.Exec("DELETE FROM signing_keys WHERE kid = $1", kid)
+
+	return err
+}
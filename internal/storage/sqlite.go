@@ -0,0 +1,700 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// SQLiteStore хранит токены в файле SQLite. Все даты пишутся в UTC,
+// чтобы строковое сравнение в SQLite совпадало с хронологическим.
+// Плейсхолдеры только позиционные (?): $N в SQLite именованные и
+// связываются в порядке появления в запросе, а не по номеру
+type SQLiteStore struct {
+	db *sql.DB
+	*sqlMigrator
+}
+
+func NewSQLiteStore() (*SQLiteStore, error) {
+
+	if !sqliteAvailable {
+		return nil, errors.New("STORAGE_DRIVER=sqlite requires a binary built with CGO_ENABLED=1")
+	}
+
+	path := os.Getenv("SQLITE_PATH")
+
+	if path == "" {
+		path = "auth.db"
+	}
+
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?_busy_timeout=5000&_journal_mode=WAL&_foreign_keys=on", path))
+
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite допускает только одного писателя, отдельная блокировка
+	// для миграций поэтому не нужна
+	db.SetMaxOpenConns(1)
+
+	return &SQLiteStore{db: db, sqlMigrator: &sqlMigrator{db: db, dialect: "sqlite"}}, nil
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *SQLiteStore) SaveRefreshToken(token RefreshToken) error {
+	return s.insertRefreshToken(s.db, token)
+}
+
+func (s *SQLiteStore) insertRefreshToken(exec execer, token RefreshToken) error {
+
+	if token.FamilyID == "" {
+		token.FamilyID = token.PairID
+	}
+
+	_, err := exec.Exec(
+		`INSERT INTO refresh_tokens (user_id, pair_id, family_id, parent_pair_id, client_id, token_hash, user_agent, ip_address, created_at, expires_at, scope)
+         VALUES (?, ?, ?, NULLIF(?, ''), ?, ?, ?, ?, ?, ?, ?)`,
+		token.UserID,
+		token.PairID,
+		token.FamilyID,
+		token.ParentPairID,
+		token.ClientID,
+		token.TokenHash,
+		token.UserAgent,
+		token.IPAddress,
+		time.Now().UTC(),
+		token.ExpiresAt.UTC(),
+		token.Scope,
+	)
+
+	return err
+}
+
+func (s *SQLiteStore) FindRefreshToken(user_id, pair_id string) (RefreshToken, error) {
+
+	token := RefreshToken{UserID: user_id, PairID: pair_id}
+
+	err := s.db.QueryRow(
+		`SELECT family_id, COALESCE(parent_pair_id, ''), client_id, token_hash, ip_address, user_agent, is_revoked, is_rotated, created_at, expires_at, scope
+         FROM refresh_tokens WHERE user_id = ? AND pair_id = ?`,
+		user_id, pair_id,
+	).Scan(&token.FamilyID, &token.ParentPairID, &token.ClientID, &token.TokenHash, &token.IPAddress, &token.UserAgent,
+		&token.IsRevoked, &token.IsRotated, &token.CreatedAt, &token.ExpiresAt, &token.Scope)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return token, ErrNotFound
+	}
+
+	return token, err
+}
+
+func (s *SQLiteStore) FindRefreshTokenByPairID(pair_id string) (RefreshToken, error) {
+
+	token := RefreshToken{PairID: pair_id}
+
+	err := s.db.QueryRow(
+		`SELECT user_id, family_id, COALESCE(parent_pair_id, ''), client_id, token_hash, ip_address, user_agent, is_revoked, is_rotated, created_at, expires_at, scope
+         FROM refresh_tokens WHERE pair_id = ?`,
+		pair_id,
+	).Scan(&token.UserID, &token.FamilyID, &token.ParentPairID, &token.ClientID, &token.TokenHash, &token.IPAddress, &token.UserAgent,
+		&token.IsRevoked, &token.IsRotated, &token.CreatedAt, &token.ExpiresAt, &token.Scope)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return token, ErrNotFound
+	}
+
+	return token, err
+}
+
+func (s *SQLiteStore) RotateRefreshToken(old RefreshToken, access_expires time.Time, new_token RefreshToken) error {
+
+	tx, err := s.db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		"UPDATE refresh_tokens SET is_revoked = true, is_rotated = true WHERE token_hash = ? AND is_revoked = false AND expires_at > ?",
+		old.TokenHash, time.Now().UTC(),
+	)
+
+	if err != nil {
+		return err
+	}
+
+	if rows, err := result.RowsAffected(); err != nil {
+		return err
+	} else if rows != 1 {
+		return ErrAlreadyUsed
+	}
+
+	_, err = tx.Exec(
+		"INSERT INTO revoked_tokens (pair_id, expires_at) VALUES (?, ?) ON CONFLICT (pair_id) DO NOTHING",
+		old.PairID,
+		access_expires.UTC(),
+	)
+
+	if err != nil {
+		return err
+	}
+
+	new_token.FamilyID = old.FamilyID
+	new_token.ParentPairID = old.PairID
+	new_token.ClientID = old.ClientID
+	new_token.Scope = old.Scope
+
+	if err = s.insertRefreshToken(tx, new_token); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) RevokeRefreshTokens(pair_id string) error {
+
+	_, err := s.db.Exec("UPDATE refresh_tokens SET is_revoked = true WHERE pair_id = ?", pair_id)
+
+	return err
+}
+
+func (s *SQLiteStore) ListSessions(user_id string) ([]Session, error) {
+
+	// family_id совпадает с pair_id первой пары цепочки, её created_at - момент входа
+	rows, err := s.db.Query(
+		`SELECT t.pair_id, t.family_id, t.user_agent, t.ip_address, f.created_at, t.created_at, t.expires_at
+         FROM refresh_tokens t
+         JOIN refresh_tokens f ON f.pair_id = t.family_id
+         WHERE t.user_id = ? AND t.is_revoked = false AND t.expires_at > ?
+         ORDER BY t.created_at DESC`,
+		user_id, time.Now().UTC(),
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var sessions []Session
+
+	for rows.Next() {
+
+		var session Session
+
+		err = rows.Scan(&session.PairID, &session.FamilyID, &session.UserAgent, &session.IPAddress,
+			&session.CreatedAt, &session.LastUsedAt, &session.ExpiresAt)
+
+		if err != nil {
+			return nil, err
+		}
+
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+func (s *SQLiteStore) RevokeTokenFamily(family_id string, access_expires time.Time) error {
+
+	tx, err := s.db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE refresh_tokens SET is_revoked = true WHERE family_id = ?", family_id)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO revoked_tokens (pair_id, expires_at)
+         SELECT pair_id, ? FROM refresh_tokens WHERE family_id = ?
+         ON CONFLICT (pair_id) DO NOTHING`,
+		access_expires.UTC(),
+		family_id,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) RevokeUserSessions(user_id, except_family_id string, access_lifetime time.Duration) error {
+
+	now := time.Now().UTC()
+
+	tx, err := s.db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	// Пары выбираются до отзыва refresh токенов, иначе признак активности будет потерян
+	_, err = tx.Exec(
+		`INSERT INTO revoked_tokens (pair_id, expires_at)
+         SELECT pair_id, ? FROM refresh_tokens
+         WHERE user_id = ? AND family_id <> ? AND (is_revoked = false OR created_at > ?)
+         ON CONFLICT (pair_id) DO NOTHING`,
+		now.Add(access_lifetime),
+		user_id,
+		except_family_id,
+		now.Add(-access_lifetime),
+	)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		"UPDATE refresh_tokens SET is_revoked = true WHERE user_id = ? AND family_id <> ? AND is_revoked = false",
+		user_id,
+		except_family_id,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) InvalidateUserTokens(user_id string, access_lifetime time.Duration) error {
+
+	now := time.Now().UTC()
+	valid_after := tokensEpoch(now)
+
+	tx, err := s.db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	// Эпоха только растёт, даже если часы реплик расходятся
+	_, err = tx.Exec(
+		`INSERT INTO user_token_epochs (user_id, tokens_valid_after) VALUES (?, ?)
+         ON CONFLICT (user_id) DO UPDATE SET tokens_valid_after = MAX(user_token_epochs.tokens_valid_after, EXCLUDED.tokens_valid_after)`,
+		user_id,
+		valid_after,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO revoked_tokens (pair_id, expires_at)
+         SELECT pair_id, ? FROM refresh_tokens WHERE user_id = ? AND created_at >= ?
+         ON CONFLICT (pair_id) DO NOTHING`,
+		now.Add(access_lifetime),
+		user_id,
+		valid_after,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE refresh_tokens SET is_revoked = true WHERE user_id = ? AND is_revoked = false", user_id)
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) TokensValidAfter(user_id string) (time.Time, error) {
+
+	var valid_after time.Time
+	err := s.db.QueryRow("SELECT tokens_valid_after FROM user_token_epochs WHERE user_id = ?", user_id).Scan(&valid_after)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, nil
+	}
+
+	return valid_after, err
+}
+
+func (s *SQLiteStore) AccessTokenIsRevoked(pair_id string) (bool, error) {
+
+	var revoked bool
+	err := s.db.QueryRow(
+		"SELECT EXISTS(SELECT 1 FROM revoked_tokens WHERE pair_id = ?)",
+		pair_id,
+	).Scan(&revoked)
+
+	return revoked, err
+}
+
+func (s *SQLiteStore) ListRevokedTokens() ([]string, error) {
+
+	rows, err := s.db.Query("SELECT pair_id FROM revoked_tokens WHERE expires_at > ?", time.Now().UTC())
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var list []string
+
+	for rows.Next() {
+
+		var pair_id string
+
+		if err = rows.Scan(&pair_id); err != nil {
+			return nil, err
+		}
+
+		list = append(list, pair_id)
+	}
+
+	return list, rows.Err()
+}
+
+func (s *SQLiteStore) RevokeAccessToken(pair_id string, expires_time time.Time) error {
+
+	_, err := s.db.Exec(
+		"INSERT INTO revoked_tokens (pair_id, expires_at) VALUES (?, ?) ON CONFLICT (pair_id) DO NOTHING",
+		pair_id,
+		expires_time.UTC(),
+	)
+
+	return err
+}
+
+func (s *SQLiteStore) CleanRevokedTokens() error {
+
+	_, err := s.db.Exec("DELETE FROM revoked_tokens WHERE expires_at < ?", time.Now().UTC())
+
+	if err != nil {
+		return err
+	}
+
+	// Токены, выпущенные до такой эпохи, уже истекли
+	_, err = s.db.Exec("DELETE FROM user_token_epochs WHERE tokens_valid_after < ?", time.Now().UTC().Add(-RefreshTokenLifetime()))
+
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec("DELETE FROM authorization_codes WHERE expires_at < ?", time.Now().UTC())
+
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec("DELETE FROM device_codes WHERE expires_at < ?", time.Now().UTC())
+
+	return err
+}
+
+func (s *SQLiteStore) CreateUser(user User) error {
+
+	result, err := s.db.Exec(
+		"INSERT INTO users (id, username, password_hash, roles, created_at) VALUES (?, ?, ?, ?, ?) ON CONFLICT (username) DO NOTHING",
+		user.ID,
+		user.Username,
+		user.PasswordHash,
+		strings.Join(user.Roles, " "),
+		user.CreatedAt.UTC(),
+	)
+
+	if err != nil {
+		return err
+	}
+
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrUserExists
+	}
+
+	return nil
+}
+
+func (s *SQLiteStore) FindUserByUsername(username string) (User, error) {
+	return scanUser(s.db.QueryRow("SELECT "+userColumns+" FROM users WHERE username = ?", username))
+}
+
+func (s *SQLiteStore) FindUser(user_id string) (User, error) {
+	return scanUser(s.db.QueryRow("SELECT "+userColumns+" FROM users WHERE id = ?", user_id))
+}
+
+func (s *SQLiteStore) SetUserRoles(user_id string, roles []string) error {
+
+	result, err := s.db.Exec("UPDATE users SET roles = ? WHERE id = ?", strings.Join(roles, " "), user_id)
+
+	if err != nil {
+		return err
+	}
+
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *SQLiteStore) SaveClient(client Client) error {
+
+	_, err := s.db.Exec(
+		`INSERT INTO clients (client_id, secret_hash, cert_subject, redirect_uris, scopes, created_at) VALUES (?, ?, ?, ?, ?, ?)
+         ON CONFLICT (client_id) DO UPDATE
+         SET secret_hash = EXCLUDED.secret_hash, cert_subject = EXCLUDED.cert_subject, redirect_uris = EXCLUDED.redirect_uris,
+             scopes = EXCLUDED.scopes`,
+		client.ID,
+		client.SecretHash,
+		client.CertSubject,
+		strings.Join(client.RedirectURIs, " "),
+		strings.Join(client.Scopes, " "),
+		client.CreatedAt.UTC(),
+	)
+
+	return err
+}
+
+func (s *SQLiteStore) FindClient(client_id string) (Client, error) {
+	return s.findClient("SELECT "+clientColumns+" FROM clients WHERE client_id = ?", client_id)
+}
+
+func (s *SQLiteStore) FindClientByCertSubject(cert_subject string) (Client, error) {
+	return s.findClient("SELECT "+clientColumns+" FROM clients WHERE cert_subject = ? AND cert_subject <> ''", cert_subject)
+}
+
+func (s *SQLiteStore) findClient(query string, arg string) (Client, error) {
+
+	client, err := scanClient(s.db.QueryRow(query, arg))
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return Client{}, ErrNotFound
+	}
+
+	return client, err
+}
+
+func (s *SQLiteStore) ListClients() ([]Client, error) {
+
+	rows, err := s.db.Query("SELECT " + clientColumns + " FROM clients ORDER BY client_id")
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var list []Client
+
+	for rows.Next() {
+
+		client, err := scanClient(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, client)
+	}
+
+	return list, rows.Err()
+}
+
+func (s *SQLiteStore) DeleteClient(client_id string) error {
+
+	result, err := s.db.Exec("DELETE FROM clients WHERE client_id = ?", client_id)
+
+	if err != nil {
+		return err
+	}
+
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *SQLiteStore) SaveAuthorizationCode(code AuthorizationCode) error {
+
+	_, err := s.db.Exec(
+		`INSERT INTO authorization_codes (code_hash, client_id, user_id, redirect_uri, code_challenge, scope, expires_at)
+         VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		code.CodeHash,
+		code.ClientID,
+		code.UserID,
+		code.RedirectURI,
+		code.CodeChallenge,
+		code.Scope,
+		code.ExpiresAt.UTC(),
+	)
+
+	return err
+}
+
+func (s *SQLiteStore) ConsumeAuthorizationCode(code_hash string) (AuthorizationCode, error) {
+
+	// DELETE ... RETURNING: из параллельных обменов одного кода строку получит только один
+	code := AuthorizationCode{CodeHash: code_hash}
+	err := s.db.QueryRow(
+		`DELETE FROM authorization_codes WHERE code_hash = ? AND expires_at > ?
+         RETURNING client_id, user_id, redirect_uri, code_challenge, scope, expires_at`,
+		code_hash, time.Now().UTC(),
+	).Scan(&code.ClientID, &code.UserID, &code.RedirectURI, &code.CodeChallenge, &code.Scope, &code.ExpiresAt)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return AuthorizationCode{}, ErrNotFound
+	}
+
+	return code, err
+}
+
+func (s *SQLiteStore) SaveDeviceCode(code DeviceCode) error {
+
+	_, err := s.db.Exec(
+		`INSERT INTO device_codes (code_hash, user_code, client_id, status, user_agent, ip_address, scope, expires_at)
+         VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		code.CodeHash,
+		code.UserCode,
+		code.ClientID,
+		code.Status,
+		code.UserAgent,
+		code.IPAddress,
+		code.Scope,
+		code.ExpiresAt.UTC(),
+	)
+
+	return err
+}
+
+func (s *SQLiteStore) FindDeviceCode(user_code string) (DeviceCode, error) {
+	return scanDeviceCode(s.db.QueryRow(
+		"SELECT "+deviceCodeColumns+" FROM device_codes WHERE user_code = ? AND expires_at > ?",
+		user_code, time.Now().UTC(),
+	))
+}
+
+func (s *SQLiteStore) ResolveDeviceCode(user_code, user_id, status string) error {
+
+	result, err := s.db.Exec(
+		"UPDATE device_codes SET user_id = ?, status = ? WHERE user_code = ? AND status = ? AND expires_at > ?",
+		user_id, status, user_code, DeviceCodePending, time.Now().UTC(),
+	)
+
+	if err != nil {
+		return err
+	}
+
+	if rows, err := result.RowsAffected(); err != nil {
+		return err
+	} else if rows != 1 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *SQLiteStore) PollDeviceCode(code_hash string) (DeviceCode, error) {
+
+	tx, err := s.db.Begin()
+
+	if err != nil {
+		return DeviceCode{}, err
+	}
+
+	defer tx.Rollback()
+
+	code, err := scanDeviceCode(tx.QueryRow("SELECT "+deviceCodeColumns+" FROM device_codes WHERE code_hash = ?", code_hash))
+
+	if err != nil {
+		return DeviceCode{}, err
+	}
+
+	if _, err = tx.Exec("UPDATE device_codes SET last_polled_at = ? WHERE code_hash = ?", time.Now().UTC(), code_hash); err != nil {
+		return DeviceCode{}, err
+	}
+
+	return code, tx.Commit()
+}
+
+func (s *SQLiteStore) ConsumeDeviceCode(code_hash string) (DeviceCode, error) {
+
+	// DELETE ... RETURNING: из параллельных опросов токены получит только один
+	return scanDeviceCode(s.db.QueryRow(
+		"DELETE FROM device_codes WHERE code_hash = ? AND status <> ? RETURNING "+deviceCodeColumns,
+		code_hash, DeviceCodePending,
+	))
+}
+
+func (s *SQLiteStore) SaveSigningKey(key SigningKey) error {
+
+	_, err := s.db.Exec(
+		"INSERT INTO signing_keys (kid, algorithm, private_key, created_at) VALUES (?, ?, ?, ?)",
+		key.ID,
+		key.Algorithm,
+		string(key.PrivateKey),
+		key.CreatedAt.UTC(),
+	)
+
+	return err
+}
+
+func (s *SQLiteStore) ListSigningKeys() ([]SigningKey, error) {
+
+	rows, err := s.db.Query("SELECT kid, algorithm, private_key, created_at FROM signing_keys ORDER BY created_at")
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var list []SigningKey
+
+	for rows.Next() {
+
+		var key SigningKey
+		var private_key string
+
+		if err = rows.Scan(&key.ID, &key.Algorithm, &private_key, &key.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		key.PrivateKey = []byte(private_key)
+
+		list = append(list, key)
+	}
+
+	return list, rows.Err()
+}
+
+func (s *SQLiteStore) DeleteSigningKey(kid string) error {
+
+	_, err := s.db.Exec("DELETE FROM signing_keys WHERE kid = ?", kid)
+
+	return err
+}
@@ -0,0 +1,6 @@
+//go:build cgo
+
+package storage
+
+// sqliteAvailable сообщает, что драйвер go-sqlite3 собран: он обёртка над C библиотекой и требует cgo
+const sqliteAvailable = true
@@ -0,0 +1,6 @@
+//go:build !cgo
+
+package storage
+
+// Без cgo go-sqlite3 собирается заглушкой, которая отказывает при первом подключении
+const sqliteAvailable = false
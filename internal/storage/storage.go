@@ -2,113 +2,296 @@ package storage
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
-	"log"
 	"os"
 	"strconv"
+	"strings"
 	"time"
+)
 
-	_ "github.com/lib/pq"
+var (
+	ErrNotFound    = errors.New("not found")
+	ErrAlreadyUsed = errors.New("refresh token already used")
+	ErrUserExists  = errors.New("user already exists")
 )
 
-var DB *sql.DB
+type RefreshToken struct {
+	UserID       string
+	PairID       string
+	FamilyID     string // pair_id первой пары в цепочке ротаций
+	ParentPairID string // pair_id пары, из которой получен токен (пусто для первой)
+	ClientID     string // API клиент, получивший первую пару цепочки (пусто, если клиент не аутентифицирован)
+	Scope        string // scope первой пары цепочки через пробел, переходит в новые пары при ротации
+	TokenHash    string
+	UserAgent    string
+	IPAddress    string
+	IsRevoked    bool
+	IsRotated    bool // токен был обменян на новую пару
+	CreatedAt    time.Time
+	ExpiresAt    time.Time
+}
 
-func Init() error {
+func (t RefreshToken) IsActive() bool {
+	return !t.IsRevoked && t.ExpiresAt.After(time.Now())
+}
 
-	db_auth := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		os.Getenv("DB_HOST"),
-		os.Getenv("DB_PORT"),
-		os.Getenv("DB_USER"),
-		os.Getenv("DB_PASSWORD"),
-		os.Getenv("DB_NAME"),
-	)
+// Session - цепочка ротаций одного входа, представленная её текущей активной парой
+type Session struct {
+	PairID     string
+	FamilyID   string
+	UserAgent  string
+	IPAddress  string
+	CreatedAt  time.Time // вход, т.е. выпуск первой пары цепочки
+	LastUsedAt time.Time // последний refresh, т.е. выпуск текущей пары
+	ExpiresAt  time.Time
+}
 
-	var err error
+// User - учётная запись для входа по паролю. ID попадает в токены как user_id
+type User struct {
+	ID           string
+	Username     string
+	PasswordHash string // argon2id в формате PHC
+	Roles        []string
+	CreatedAt    time.Time
+}
 
-	attemps, err := strconv.Atoi(os.Getenv("DB_CONNECT_ATTEMPS"))
+// Client - API клиент, которому разрешено получать токены. Аутентифицируется
+// по client_secret (хранится только его SHA-256) или по subject DN сертификата mTLS
+type Client struct {
+	ID           string
+	SecretHash   string
+	CertSubject  string
+	RedirectURIs []string // разрешённые redirect_uri для /oauth/authorize
+	Scopes       []string // scope, которые может получить клиент
+	CreatedAt    time.Time
+}
 
-	if err != nil || attemps < 1 {
-		attemps = 10
-	}
+// IsPublic сообщает, что клиент не может аутентифицироваться (SPA, мобильное приложение)
+func (c Client) IsPublic() bool {
+	return c.SecretHash == "" && c.CertSubject == ""
+}
 
-	for i := 0; i < attemps; i++ {
+// AuthorizationCode - одноразовый код авторизации, привязанный к code_challenge (PKCE, S256)
+type AuthorizationCode struct {
+	CodeHash      string // SHA-256 кода, сам код не хранится
+	ClientID      string
+	UserID        string
+	RedirectURI   string
+	CodeChallenge string
+	Scope         string
+	ExpiresAt     time.Time
+}
 
-		DB, err = sql.Open("postgres", db_auth)
+// Состояния запроса авторизации устройства
+const (
+	DeviceCodePending  = "pending"
+	DeviceCodeApproved = "approved"
+	DeviceCodeDenied   = "denied"
+)
 
-		if err != nil {
-			log.Printf("Failed to open DB: %v (attempt %d/10)", err, i+1)
-			time.Sleep(2 * time.Second)
-			continue
-		}
+// DeviceCode - запрос авторизации устройства (RFC 8628). Устройство опрашивает его
+// по device_code, пользователь подтверждает по user_code
+type DeviceCode struct {
+	CodeHash     string // SHA-256 device_code, сам код не хранится
+	UserCode     string // без разделителя, в верхнем регистре
+	ClientID     string
+	UserID       string // заполняется при подтверждении
+	Status       string
+	UserAgent    string // устройства, запросившего код
+	IPAddress    string
+	Scope        string
+	LastPolledAt time.Time // нулевой, пока устройство не опрашивало
+	ExpiresAt    time.Time
+}
 
-		if err = DB.Ping(); err == nil {
-			log.Println("DB connected")
-			return nil
-		}
+// SigningKey - ключ подписи JWT, полученный ротацией. PrivateKey - PKCS#8 PEM (для HS512 - сам секрет),
+// зашифрованный token.EncryptPrivateKey
+type SigningKey struct {
+	ID         string
+	Algorithm  string
+	PrivateKey []byte
+	CreatedAt  time.Time
+}
 
-		log.Printf("DB ping failed: %v", err)
+// Store описывает хранилище refresh токенов и списка отозванных access токенов
+type Store interface {
+	SaveRefreshToken(token RefreshToken) error
+	// FindRefreshToken возвращает токен пары в любом состоянии (в том числе отозванный
+	// или уже обменянный), проверка активности остаётся за вызывающим
+	FindRefreshToken(user_id, pair_id string) (RefreshToken, error)
+	// FindRefreshTokenByPairID ищет токен только по pair_id, который можно получить из самого refresh токена
+	FindRefreshTokenByPairID(pair_id string) (RefreshToken, error)
+	// RotateRefreshToken атомарно отзывает старый refresh токен, access токен его пары
+	// и сохраняет новый в той же цепочке. Если старый токен уже отозван или истёк,
+	// возвращает ErrAlreadyUsed и ничего не меняет, поэтому из параллельных запросов успешен только один
+	RotateRefreshToken(old RefreshToken, access_expires time.Time, new_token RefreshToken) error
+	RevokeRefreshTokens(pair_id string) error
+	// ListSessions возвращает активные сессии пользователя, последние использованные первыми
+	ListSessions(user_id string) ([]Session, error)
+	// RevokeTokenFamily отзывает все refresh токены цепочки и access токены всех её пар
+	RevokeTokenFamily(family_id string, access_expires time.Time) error
+	// RevokeUserSessions отзывает все refresh токены пользователя, кроме цепочки except_family_id
+	// (пустая строка - без исключений), и вносит в revoked_tokens все пары, access токены
+	// которых ещё могут быть живы: с активным refresh токеном или выпущенные не раньше access_lifetime назад
+	RevokeUserSessions(user_id, except_family_id string, access_lifetime time.Duration) error
+	// InvalidateUserTokens одной записью отзывает все выпущенные пользователю токены:
+	// сдвигает tokens_valid_after на текущий момент и отзывает его refresh токены
+	InvalidateUserTokens(user_id string, access_lifetime time.Duration) error
+	// TokensValidAfter возвращает момент последней инвалидации токенов пользователя
+	// (нулевое время, если её не было). Access токены с более ранним iat отозваны
+	TokensValidAfter(user_id string) (time.Time, error)
 
-		DB.Close()
+	AccessTokenIsRevoked(pair_id string) (bool, error)
+	// ListRevokedTokens возвращает pair_id всех отозванных и ещё не истекших access токенов
+	ListRevokedTokens() ([]string, error)
+	// RevokeAccessToken идемпотентен: повторный отзыв той же пары не ошибка
+	RevokeAccessToken(pair_id string, expires_time time.Time) error
+	CleanRevokedTokens() error
 
-		time.Sleep(2 * time.Second)
-	}
+	// CreateUser возвращает ErrUserExists, если username занят
+	CreateUser(user User) error
+	FindUserByUsername(username string) (User, error)
+	FindUser(user_id string) (User, error)
+	// SetUserRoles заменяет роли пользователя, для неизвестного user_id возвращает ErrNotFound
+	SetUserRoles(user_id string, roles []string) error
+
+	// SaveClient создаёт клиента или заменяет его учётные данные
+	SaveClient(client Client) error
+	FindClient(client_id string) (Client, error)
+	FindClientByCertSubject(cert_subject string) (Client, error)
+	ListClients() ([]Client, error)
+	DeleteClient(client_id string) error
+
+	SaveAuthorizationCode(code AuthorizationCode) error
+	// ConsumeAuthorizationCode атомарно удаляет код и возвращает его. Для уже
+	// использованного или истекшего кода возвращает ErrNotFound
+	ConsumeAuthorizationCode(code_hash string) (AuthorizationCode, error)
 
-	return fmt.Errorf("failed to connect to DB after 10 attempts")
+	SaveDeviceCode(code DeviceCode) error
+	// FindDeviceCode ищет неистекший запрос по user_code
+	FindDeviceCode(user_code string) (DeviceCode, error)
+	// ResolveDeviceCode подтверждает или отклоняет ожидающий неистекший запрос,
+	// иначе возвращает ErrNotFound
+	ResolveDeviceCode(user_code, user_id, status string) error
+	// PollDeviceCode отмечает опрос устройством и возвращает запрос с временем предыдущего опроса
+	PollDeviceCode(code_hash string) (DeviceCode, error)
+	// ConsumeDeviceCode атомарно удаляет подтверждённый или отклонённый запрос и возвращает его.
+	// Для ожидающего или уже удалённого запроса возвращает ErrNotFound
+	ConsumeDeviceCode(code_hash string) (DeviceCode, error)
+
+	SaveSigningKey(key SigningKey) error
+	// ListSigningKeys возвращает ключи по возрастанию created_at
+	ListSigningKeys() ([]SigningKey, error)
+	DeleteSigningKey(kid string) error
+
+	Close() error
 }
 
-func Close() error {
-	if DB != nil {
-		return DB.Close()
-	}
-	return nil
+// scanner - общий интерфейс *sql.Row и *sql.Rows
+type scanner interface {
+	Scan(dest ...any) error
 }
 
-func SaveRefreshToken(user_id, pair_id, resfresh_hash, useragent, ip_address string) error {
+const userColumns = "id, username, password_hash, roles, created_at"
 
-	expiration_minutes, err := strconv.Atoi(os.Getenv("REFRESH_TOKEN_EXPIRATION_MINUTES"))
+func scanUser(row scanner) (User, error) {
 
-	if err != nil || expiration_minutes < 1440 {
-		expiration_minutes = 43200
+	var user User
+	var roles string
+
+	err := row.Scan(&user.ID, &user.Username, &user.PasswordHash, &roles, &user.CreatedAt)
+
+	user.Roles = strings.Fields(roles)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, ErrNotFound
 	}
 
-	_, err = DB.Exec(
-		"INSERT INTO refresh_tokens (user_id, pair_id, token_hash, user_agent, ip_address, expires_at) VALUES ($1, $2, $3, $4, $5, $6)",
-		user_id,
-		pair_id,
-		resfresh_hash,
-		useragent,
-		ip_address,
-		time.Now().Add(time.Minute*1*time.Duration(expiration_minutes)),
-	)
+	return user, err
+}
+
+const clientColumns = "client_id, secret_hash, cert_subject, redirect_uris, scopes, created_at"
+
+func scanClient(row scanner) (Client, error) {
+
+	var client Client
+	var redirect_uris, scopes string
 
-	return err
+	err := row.Scan(&client.ID, &client.SecretHash, &client.CertSubject, &redirect_uris, &scopes, &client.CreatedAt)
+
+	client.RedirectURIs = strings.Fields(redirect_uris)
+	client.Scopes = strings.Fields(scopes)
+
+	return client, err
 }
 
-func AccessTokenIsRevoked(pair_id string) (bool, error) {
+const deviceCodeColumns = "code_hash, user_code, client_id, user_id, status, user_agent, ip_address, scope, last_polled_at, expires_at"
+
+func scanDeviceCode(row scanner) (DeviceCode, error) {
+
+	var code DeviceCode
+	var last_polled_at sql.NullTime
+
+	err := row.Scan(&code.CodeHash, &code.UserCode, &code.ClientID, &code.UserID, &code.Status,
+		&code.UserAgent, &code.IPAddress, &code.Scope, &last_polled_at, &code.ExpiresAt)
+
+	code.LastPolledAt = last_polled_at.Time
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return DeviceCode{}, ErrNotFound
+	}
+
+	return code, err
+}
 
-	var revoked bool
-	err := DB.QueryRow(
-		"SELECT EXISTS(SELECT 1 FROM revoked_tokens WHERE pair_id = $1)",
-		pair_id,
-	).Scan(&revoked)
+// execer позволяет выполнять один и тот же запрос как на *sql.DB, так и внутри *sql.Tx
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
 
-	return revoked, err
+// tokensEpoch возвращает значение tokens_valid_after для инвалидации в момент now.
+// iat хранится с точностью до секунды, поэтому эпоха округляется вниз, а пары,
+// выпущенные в ту же секунду до инвалидации, дополнительно вносятся в revoked_tokens.
+// Иначе токен, полученный сразу после инвалидации, оказался бы отозванным
+func tokensEpoch(now time.Time) time.Time {
+	return now.Truncate(time.Second)
 }
 
-func RevokeAccessToken(pair_id string, expires_time time.Time) error {
+func RefreshTokenLifetime() time.Duration {
+
+	expiration_minutes, err := strconv.Atoi(os.Getenv("REFRESH_TOKEN_EXPIRATION_MINUTES"))
 
-	_, err := DB.Exec(
-		"INSERT INTO revoked_tokens (pair_id, expires_at) VALUES ($1, $2)",
-		pair_id,
-		expires_time,
-	)
+	if err != nil || expiration_minutes < 1440 {
+		expiration_minutes = 43200
+	}
 
-	return err
+	return time.Minute * 1 * time.Duration(expiration_minutes)
 }
 
-func RevokeRefreshTokens(pair_id string) error {
+func RefreshTokenExpiration() time.Time {
+	return time.Now().Add(RefreshTokenLifetime())
+}
 
-	_, err := DB.Exec("UPDATE refresh_tokens SET is_revoked = true WHERE pair_id = $1", pair_id)
+// New создаёт хранилище по значению STORAGE_DRIVER (postgres по умолчанию)
+func New() (Store, error) {
 
-	return err
+	switch driver := os.Getenv("STORAGE_DRIVER"); driver {
+	case "", "postgres":
+		store, err := NewPostgresStore()
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	case "sqlite":
+		store, err := NewSQLiteStore()
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	case "memory":
+		return NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", driver)
+	}
 }
@@ -0,0 +1,136 @@
+package token
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/redeflesq/auth-example/internal/model"
+)
+
+// ClaimsRequest описывает выпускаемый access токен пользователя
+type ClaimsRequest struct {
+	UserID   string   `json:"user_id"`
+	ClientID string   `json:"client_id,omitempty"`
+	Scope    string   `json:"scope,omitempty"`
+	Roles    []string `json:"roles,omitempty"`
+}
+
+// ClaimsProvider добавляет в access токены пользователей собственные claims (tenant, email,
+// флаги) при входе и при каждом refresh. Claims, которые заполняет сам сервис, отбрасываются,
+// в том числе roles: роли берутся только из учётной записи. Ошибка провайдера прерывает выпуск токена
+type ClaimsProvider interface {
+	Claims(request ClaimsRequest) (map[string]any, error)
+}
+
+// ClaimNamer может реализовать ClaimsProvider, чтобы discovery перечислял его claims в claims_supported
+type ClaimNamer interface {
+	ClaimNames() []string
+}
+
+var claimsProvider ClaimsProvider
+
+// SupportedClaims возвращает claims access токенов для discovery: выпускаемые самим
+// сервисом и объявленные провайдером claims
+func SupportedClaims() []string {
+
+	names := model.ClaimNames()
+
+	if namer, ok := claimsProvider.(ClaimNamer); ok {
+		for _, name := range namer.ClaimNames() {
+			if !model.IsReservedClaim(name) && !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+
+	return names
+}
+
+// SetClaimsProvider регистрирует провайдера claims, nil отключает. Вызывается до запуска сервера
+func SetClaimsProvider(provider ClaimsProvider) {
+	claimsProvider = provider
+}
+
+func providedClaims(request ClaimsRequest) (map[string]any, error) {
+
+	if claimsProvider == nil {
+		return nil, nil
+	}
+
+	claims, err := claimsProvider.Claims(request)
+
+	if err != nil {
+		return nil, fmt.Errorf("claims provider: %w", err)
+	}
+
+	for name := range claims {
+		if model.IsReservedClaim(name) {
+			delete(claims, name)
+		}
+	}
+
+	return claims, nil
+}
+
+// HTTPClaimsProvider запрашивает claims у локального сервиса: POST с ClaimsRequest в JSON,
+// в ответ 200 и JSON объект с claims. Names - claims, которые сервис обещает вернуть
+type HTTPClaimsProvider struct {
+	URL    string
+	Client *http.Client
+	Names  []string
+}
+
+func NewHTTPClaimsProvider(url string, timeout time.Duration) *HTTPClaimsProvider {
+	return &HTTPClaimsProvider{URL: url, Client: &http.Client{Timeout: timeout}}
+}
+
+func (p *HTTPClaimsProvider) ClaimNames() []string {
+	return p.Names
+}
+
+func (p *HTTPClaimsProvider) Claims(request ClaimsRequest) (map[string]any, error) {
+
+	body, err := json.Marshal(request)
+
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := p.Client.Post(p.URL, "application/json", bytes.NewReader(body))
+
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %s", p.URL, response.Status)
+	}
+
+	var claims map[string]any
+
+	if err = json.NewDecoder(io.LimitReader(response.Body, 1<<20)).Decode(&claims); err != nil {
+		return nil, fmt.Errorf("%s returned invalid claims: %w", p.URL, err)
+	}
+
+	return claims, nil
+}
+
+// ClaimsProviderTimeout возвращает таймаут запроса к CLAIMS_PROVIDER_URL из CLAIMS_PROVIDER_TIMEOUT_MS, по умолчанию 2 секунды
+func ClaimsProviderTimeout() time.Duration {
+
+	timeout, err := strconv.Atoi(os.Getenv("CLAIMS_PROVIDER_TIMEOUT_MS"))
+
+	if err != nil || timeout < 1 {
+		return 2 * time.Second
+	}
+
+	return time.Millisecond * time.Duration(timeout)
+}
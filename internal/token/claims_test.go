@@ -0,0 +1,261 @@
+package token
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/redeflesq/auth-example/internal/model"
+)
+
+// staticClaims - провайдер, возвращающий заранее заданные claims
+type staticClaims map[string]any
+
+func (p staticClaims) Claims(request ClaimsRequest) (map[string]any, error) {
+
+	claims := make(map[string]any, len(p))
+	for name, value := range p {
+		claims[name] = value
+	}
+
+	return claims, nil
+}
+
+func useClaimsProvider(t *testing.T, provider ClaimsProvider) {
+
+	t.Helper()
+
+	useKeys(t)
+
+	t.Setenv("JWT_ALGORITHM", "HS512")
+	t.Setenv("JWT_SECRET", "claims-test-secret")
+
+	if err := Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	SetClaimsProvider(provider)
+	t.Cleanup(func() { SetClaimsProvider(nil) })
+}
+
+func TestClaimsJSONRoundTrip(t *testing.T) {
+
+	claims := testClaims()
+	claims.Roles = []string{model.RoleUser}
+	claims.Subject = "subject"
+	claims.Extra = map[string]any{
+		"tenant":   "acme",
+		"features": map[string]any{"beta": true},
+		"pair_id":  "overridden", // зарезервированный claim из Extra не попадает в JSON
+	}
+
+	data, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fields map[string]any
+	if err = json.Unmarshal(data, &fields); err != nil {
+		t.Fatal(err)
+	}
+
+	if fields["tenant"] != "acme" || fields["pair_id"] != claims.PairID || fields["sub"] != "subject" {
+		t.Fatalf("marshalled claims %s", data)
+	}
+
+	var parsed model.Claims
+	if err = json.Unmarshal(data, &parsed); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]any{"tenant": "acme", "features": map[string]any{"beta": true}}
+
+	if !reflect.DeepEqual(parsed.Extra, want) {
+		t.Fatalf("Extra %v, want %v", parsed.Extra, want)
+	}
+
+	if parsed.UserID != claims.UserID || parsed.PairID != claims.PairID || parsed.Subject != "subject" || !slices.Equal(parsed.Roles, claims.Roles) {
+		t.Fatalf("registered claims lost: %+v", parsed)
+	}
+
+	// Без Extra JSON не отличается от обычной структуры
+	claims.Extra = nil
+
+	var empty model.Claims
+	if data, err = json.Marshal(claims); err == nil {
+		err = json.Unmarshal(data, &empty)
+	}
+	if err != nil || empty.Extra != nil {
+		t.Fatalf("claims without Extra: %s, %v", data, err)
+	}
+}
+
+func TestProvidedClaimsSurviveParseJWT(t *testing.T) {
+
+	useClaimsProvider(t, staticClaims{"tenant": "acme", "features": map[string]any{"beta": true}})
+
+	signed, err := GenerateJWT("user-1", "pair-1", "client-1", "profile", []string{model.RoleUser})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := &model.Claims{}
+	if _, err = ParseJWT(signed, claims); err != nil {
+		t.Fatal(err)
+	}
+
+	if claims.Extra["tenant"] != "acme" || !reflect.DeepEqual(claims.Extra["features"], map[string]any{"beta": true}) {
+		t.Fatalf("Extra after ParseJWT: %v", claims.Extra)
+	}
+
+	// Обмен токена переносит claims исходного
+	exchanged, _, err := GenerateExchangedJWT(claims, "service", "audience", "profile")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exchanged_claims := &model.Claims{}
+	if _, _, err = jwt.NewParser().ParseUnverified(exchanged, exchanged_claims); err != nil {
+		t.Fatal(err)
+	}
+
+	if exchanged_claims.Extra["tenant"] != "acme" {
+		t.Fatalf("Extra after token exchange: %v", exchanged_claims.Extra)
+	}
+}
+
+func TestProviderCannotOverrideReservedClaims(t *testing.T) {
+
+	useClaimsProvider(t, staticClaims{
+		"exp":     float64(4102444800),
+		"sub":     "someone-else",
+		"roles":   []any{model.RoleAdmin},
+		"user_id": "someone-else",
+		"scope":   "admin",
+		"tenant":  "acme",
+	})
+
+	before := time.Now()
+
+	signed, err := GenerateJWT("user-1", "pair-1", "", "profile", []string{model.RoleUser})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := &model.Claims{}
+	if _, err = ParseJWT(signed, claims); err != nil {
+		t.Fatal(err)
+	}
+
+	if claims.ExpiresAt.Time.After(before.Add(JWTExpiration() + time.Minute)) {
+		t.Fatalf("exp from the provider: %v", claims.ExpiresAt)
+	}
+
+	if claims.Subject != "" || claims.UserID != "user-1" || claims.Scope != "profile" || !slices.Equal(claims.Roles, []string{model.RoleUser}) {
+		t.Fatalf("reserved claims overridden: %+v", claims)
+	}
+
+	if !reflect.DeepEqual(claims.Extra, map[string]any{"tenant": "acme"}) {
+		t.Fatalf("Extra %v, want only tenant", claims.Extra)
+	}
+}
+
+func TestHTTPClaimsProvider(t *testing.T) {
+
+	var received ClaimsRequest
+
+	srv := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		if err := json.NewDecoder(req.Body).Decode(&received); err != nil {
+			writer.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		writer.Write([]byte(`{"tenant": "acme"}`))
+	}))
+	defer srv.Close()
+
+	request := ClaimsRequest{UserID: "user-1", ClientID: "client-1", Scope: "profile", Roles: []string{model.RoleUser}}
+
+	claims, err := NewHTTPClaimsProvider(srv.URL, time.Second).Claims(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if claims["tenant"] != "acme" || !reflect.DeepEqual(received, request) {
+		t.Fatalf("claims %v, request %+v", claims, received)
+	}
+}
+
+func TestHTTPClaimsProviderErrors(t *testing.T) {
+
+	handlers := map[string]http.HandlerFunc{
+		"non-200": func(writer http.ResponseWriter, req *http.Request) {
+			http.Error(writer, `{"tenant": "acme"}`, http.StatusServiceUnavailable)
+		},
+		"invalid JSON": func(writer http.ResponseWriter, req *http.Request) {
+			writer.Write([]byte(`{"tenant": `))
+		},
+		"not an object": func(writer http.ResponseWriter, req *http.Request) {
+			writer.Write([]byte(`["tenant"]`))
+		},
+		"timeout": func(writer http.ResponseWriter, req *http.Request) {
+			time.Sleep(200 * time.Millisecond)
+			writer.Write([]byte(`{"tenant": "acme"}`))
+		},
+	}
+
+	for name, handler := range handlers {
+		t.Run(name, func(t *testing.T) {
+
+			srv := httptest.NewServer(handler)
+			defer srv.Close()
+
+			useClaimsProvider(t, NewHTTPClaimsProvider(srv.URL, 50*time.Millisecond))
+
+			if _, err := GenerateJWT("user-1", "pair-1", "", "profile", []string{model.RoleUser}); err == nil {
+				t.Fatal("token issued despite the provider error")
+			}
+
+			if _, err := GenerateTokensPair("user-1", "", "profile", []string{model.RoleUser}); err == nil {
+				t.Fatal("tokens pair issued despite the provider error")
+			}
+		})
+	}
+}
+
+func TestSupportedClaims(t *testing.T) {
+
+	names := SupportedClaims()
+
+	// Поля Claims попадают в список сами, Extra и неиспользуемые nbf и jti - нет
+	for _, name := range []string{"iss", "sub", "aud", "exp", "iat", "user_id", "pair_id", "azp", "token_use", "act", "scope", "roles"} {
+		if !slices.Contains(names, name) {
+			t.Fatalf("%s missing from %v", name, names)
+		}
+	}
+
+	for _, name := range []string{"-", "nbf", "jti", "tenant"} {
+		if slices.Contains(names, name) {
+			t.Fatalf("%s in %v", name, names)
+		}
+	}
+
+	provider := NewHTTPClaimsProvider("http://localhost", time.Second)
+	provider.Names = []string{"tenant", "roles", "email"}
+	useClaimsProvider(t, provider)
+
+	names = SupportedClaims()
+
+	if !slices.Contains(names, "tenant") || !slices.Contains(names, "email") {
+		t.Fatalf("provider claims missing from %v", names)
+	}
+
+	if count := len(slices.DeleteFunc(slices.Clone(names), func(name string) bool { return name != "roles" })); count != 1 {
+		t.Fatalf("roles listed %d times", count)
+	}
+}
@@ -0,0 +1,116 @@
+package token
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/redeflesq/auth-example/internal/model"
+)
+
+// publicJWK строит JWK (RFC 7517) без kid, alg и use. Симметричные ключи не публикуются
+func publicJWK(public any) (model.JWK, error) {
+
+	encode := base64.RawURLEncoding.EncodeToString
+
+	switch public := public.(type) {
+
+	case *rsa.PublicKey:
+		return model.JWK{
+			Kty: "RSA",
+			N:   encode(public.N.Bytes()),
+			E:   encode(big.NewInt(int64(public.E)).Bytes()),
+		}, nil
+
+	case *ecdsa.PublicKey:
+		size := (public.Curve.Params().BitSize + 7) / 8
+		return model.JWK{
+			Kty: "EC",
+			Crv: public.Curve.Params().Name,
+			X:   encode(public.X.FillBytes(make([]byte, size))),
+			Y:   encode(public.Y.FillBytes(make([]byte, size))),
+		}, nil
+
+	case ed25519.PublicKey:
+		return model.JWK{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   encode(public),
+		}, nil
+	}
+
+	return model.JWK{}, fmt.Errorf("key type %T can not be published", public)
+}
+
+// thumbprint вычисляет JWK Thumbprint (RFC 7638), он используется как kid статического ключа
+func thumbprint(public any) (string, error) {
+
+	jwk, err := publicJWK(public)
+
+	if err != nil {
+		return "", err
+	}
+
+	// Обязательные члены в лексикографическом порядке, без пробелов
+	var members any
+
+	switch jwk.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	case "EC":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{jwk.Crv, jwk.Kty, jwk.X, jwk.Y}
+	default:
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	}
+
+	data, err := json.Marshal(members)
+
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// JWKS возвращает опубликованные публичные ключи
+func JWKS() model.JWKSResponse {
+
+	response := model.JWKSResponse{Keys: []model.JWK{}}
+
+	for _, key := range PublishedKeys() {
+
+		jwk, err := publicJWK(key.Public)
+
+		if err != nil {
+			continue
+		}
+
+		jwk.Kid = key.ID
+		jwk.Alg = key.Method.Alg()
+		jwk.Use = "sig"
+
+		response.Keys = append(response.Keys, jwk)
+	}
+
+	return response
+}
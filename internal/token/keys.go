@@ -0,0 +1,531 @@
+package token
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Как часто реплики перечитывают набор ключей из хранилища. Новый ключ начинает
+// подписывать токены только через две синхронизации, чтобы к этому моменту
+// все реплики уже могли проверять его подпись
+const (
+	KeySyncInterval    = time.Minute
+	KeyActivationDelay = 2 * KeySyncInterval
+)
+
+type Key struct {
+	ID        string
+	Method    jwt.SigningMethod
+	Private   any // ключ подписи
+	Public    any // ключ проверки подписи
+	CreatedAt time.Time
+	RetiredAt time.Time // момент, когда ключ перестал подписывать (нулевой для текущего)
+}
+
+func (k Key) activatesAt() time.Time {
+
+	// Статический ключ из конфигурации активен сразу
+	if k.CreatedAt.IsZero() {
+		return k.CreatedAt
+	}
+
+	return k.CreatedAt.Add(KeyActivationDelay)
+}
+
+// KeySet содержит статический ключ из конфигурации и ключи, полученные ротацией
+type KeySet struct {
+	mu   sync.RWMutex
+	keys []Key // по возрастанию CreatedAt, статический ключ первый
+}
+
+var keys = &KeySet{}
+
+// Init загружает ключ подписи access токенов согласно JWT_ALGORITHM.
+// HS512 использует общий JWT_SECRET, асимметричные алгоритмы читают PEM из
+// JWT_PRIVATE_KEY_FILE и, опционально, JWT_PUBLIC_KEY_FILE
+func Init() error {
+
+	key, err := loadSigningKey(Algorithm())
+
+	if err != nil {
+		return err
+	}
+
+	keys.set([]Key{key})
+
+	return nil
+}
+
+func Algorithm() string {
+
+	algorithm := os.Getenv("JWT_ALGORITHM")
+
+	if algorithm == "" {
+		return jwt.SigningMethodHS512.Alg()
+	}
+
+	return algorithm
+}
+
+// KeyRotationInterval возвращает период ротации ключей из JWT_KEY_ROTATION_HOURS, 0 - ротация выключена
+func KeyRotationInterval() time.Duration {
+
+	hours, err := strconv.Atoi(os.Getenv("JWT_KEY_ROTATION_HOURS"))
+
+	if err != nil || hours < 1 {
+		return 0
+	}
+
+	return time.Hour * time.Duration(hours)
+}
+
+// SetRotatedKeys заменяет ключи, полученные ротацией, сохраняя статический
+func SetRotatedKeys(rotated []Key) {
+
+	var list []Key
+
+	keys.mu.RLock()
+	if len(keys.keys) > 0 {
+		list = append(list, keys.keys[0])
+	}
+	keys.mu.RUnlock()
+
+	sort.Slice(rotated, func(i, j int) bool { return rotated[i].CreatedAt.Before(rotated[j].CreatedAt) })
+
+	keys.set(append(list, rotated...))
+}
+
+func (s *KeySet) set(list []Key) {
+
+	now := time.Now()
+
+	// Ключ уходит на покой, когда активируется следующий за ним
+	for i := range list {
+
+		list[i].RetiredAt = time.Time{}
+
+		for j := i + 1; j < len(list); j++ {
+			if activates_at := list[j].activatesAt(); !activates_at.After(now) {
+				list[i].RetiredAt = activates_at
+				break
+			}
+		}
+	}
+
+	s.mu.Lock()
+	s.keys = list
+	s.mu.Unlock()
+}
+
+// signingKey возвращает самый новый активный ключ
+func (s *KeySet) signingKey() (Key, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+
+	for i := len(s.keys) - 1; i >= 0; i-- {
+		if !s.keys[i].activatesAt().After(now) {
+			return s.keys[i], nil
+		}
+	}
+
+	return Key{}, fmt.Errorf("signing keys are not loaded")
+}
+
+func (s *KeySet) lookup(kid string) (Key, bool) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, key := range s.keys {
+		if key.ID == kid {
+			return key, true
+		}
+	}
+
+	return Key{}, false
+}
+
+// PublishedKeys возвращает ключи, которыми могут быть подписаны ещё не истекшие
+// access токены: текущий, ещё не активированные и ушедшие на покой не раньше срока жизни токена
+func PublishedKeys() []Key {
+
+	keys.mu.RLock()
+	defer keys.mu.RUnlock()
+
+	var list []Key
+
+	not_before := time.Now().Add(-JWTExpiration())
+
+	for _, key := range keys.keys {
+		if key.RetiredAt.IsZero() || key.RetiredAt.After(not_before) {
+			list = append(list, key)
+		}
+	}
+
+	return list
+}
+
+func loadSigningKey(algorithm string) (Key, error) {
+
+	if algorithm == jwt.SigningMethodHS512.Alg() {
+
+		secret := os.Getenv("JWT_SECRET")
+
+		if secret == "" {
+			return Key{}, fmt.Errorf("JWT_SECRET is required for HS512")
+		}
+
+		return hmacKey(secretKeyID([]byte(secret)), []byte(secret)), nil
+	}
+
+	private_pem, err := os.ReadFile(os.Getenv("JWT_PRIVATE_KEY_FILE"))
+
+	if err != nil {
+		return Key{}, fmt.Errorf("failed to read JWT private key: %w", err)
+	}
+
+	var public_pem []byte
+
+	if path := os.Getenv("JWT_PUBLIC_KEY_FILE"); path != "" {
+
+		public_pem, err = os.ReadFile(path)
+
+		if err != nil {
+			return Key{}, fmt.Errorf("failed to read JWT public key: %w", err)
+		}
+	}
+
+	key, err := parseKeyPair(algorithm, private_pem, public_pem)
+
+	if err != nil {
+		return Key{}, err
+	}
+
+	key.ID, err = thumbprint(key.Public)
+
+	return key, err
+}
+
+func hmacKey(kid string, secret []byte) Key {
+	return Key{ID: kid, Method: jwt.SigningMethodHS512, Private: secret, Public: secret}
+}
+
+// secretKeyID строит kid для общего секрета, не раскрывая его
+func secretKeyID(secret []byte) string {
+
+	sum := sha256.Sum256(append([]byte("kid:"), secret...))
+
+	return hex.EncodeToString(sum[:8])
+}
+
+// parseKeyPair разбирает PEM ключи для асимметричного алгоритма.
+// Если публичный ключ не передан, он выводится из приватного
+func parseKeyPair(algorithm string, private_pem, public_pem []byte) (Key, error) {
+
+	switch algorithm {
+
+	case jwt.SigningMethodRS512.Alg():
+
+		private, err := jwt.ParseRSAPrivateKeyFromPEM(private_pem)
+		if err != nil {
+			return Key{}, err
+		}
+
+		var public *rsa.PublicKey = &private.PublicKey
+		if public_pem != nil {
+			if public, err = jwt.ParseRSAPublicKeyFromPEM(public_pem); err != nil {
+				return Key{}, err
+			}
+		}
+
+		return Key{Method: jwt.SigningMethodRS512, Private: private, Public: public}, nil
+
+	case jwt.SigningMethodES512.Alg():
+
+		private, err := jwt.ParseECPrivateKeyFromPEM(private_pem)
+		if err != nil {
+			return Key{}, err
+		}
+
+		// ES512 определён только для кривой P-521
+		if private.Curve != elliptic.P521() {
+			return Key{}, fmt.Errorf("ES512 requires a P-521 key")
+		}
+
+		var public *ecdsa.PublicKey = &private.PublicKey
+		if public_pem != nil {
+			if public, err = jwt.ParseECPublicKeyFromPEM(public_pem); err != nil {
+				return Key{}, err
+			}
+		}
+
+		return Key{Method: jwt.SigningMethodES512, Private: private, Public: public}, nil
+
+	case jwt.SigningMethodEdDSA.Alg():
+
+		parsed, err := jwt.ParseEdPrivateKeyFromPEM(private_pem)
+		if err != nil {
+			return Key{}, err
+		}
+
+		private, ok := parsed.(ed25519.PrivateKey)
+		if !ok {
+			return Key{}, fmt.Errorf("EdDSA requires an Ed25519 key")
+		}
+
+		public := private.Public()
+		if public_pem != nil {
+			if public, err = jwt.ParseEdPublicKeyFromPEM(public_pem); err != nil {
+				return Key{}, err
+			}
+		}
+
+		return Key{Method: jwt.SigningMethodEdDSA, Private: private, Public: public}, nil
+	}
+
+	return Key{}, fmt.Errorf("unsupported JWT algorithm %q", algorithm)
+}
+
+// GenerateKey создаёт новый ключ для настроенного алгоритма
+func GenerateKey() (Key, error) {
+
+	var private any
+	var err error
+
+	switch algorithm := Algorithm(); algorithm {
+
+	case jwt.SigningMethodHS512.Alg():
+		secret := make([]byte, 64)
+		if _, err = rand.Read(secret); err != nil {
+			return Key{}, err
+		}
+		key := hmacKey(uuid.NewString(), secret)
+		key.CreatedAt = time.Now()
+		return key, nil
+
+	case jwt.SigningMethodRS512.Alg():
+		private, err = rsa.GenerateKey(rand.Reader, 4096)
+
+	case jwt.SigningMethodES512.Alg():
+		private, err = ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+
+	case jwt.SigningMethodEdDSA.Alg():
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+
+	default:
+		return Key{}, fmt.Errorf("unsupported JWT algorithm %q", algorithm)
+	}
+
+	if err != nil {
+		return Key{}, err
+	}
+
+	private_pem, err := MarshalPrivateKey(Key{Private: private})
+
+	if err != nil {
+		return Key{}, err
+	}
+
+	return ParsePrivateKey(uuid.NewString(), Algorithm(), private_pem, time.Now())
+}
+
+// MarshalPrivateKey сериализует ключ для хранения: PKCS#8 PEM, для HS512 сам секрет
+func MarshalPrivateKey(key Key) ([]byte, error) {
+
+	if secret, ok := key.Private.([]byte); ok {
+		return secret, nil
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key.Private)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// Префикс зашифрованного ключа в хранилище, по нему же отличаются ключи, сохранённые до шифрования
+const encryptedKeyPrefix = "v1:"
+
+// KeyEncryptionKey возвращает ключ AES-256 из JWT_KEY_ENCRYPTION_KEY (32 байта в base64),
+// которым шифруются ключи ротации перед сохранением в хранилище
+func KeyEncryptionKey() ([]byte, error) {
+
+	encoded := os.Getenv("JWT_KEY_ENCRYPTION_KEY")
+
+	if encoded == "" {
+		return nil, fmt.Errorf("JWT_KEY_ENCRYPTION_KEY is required for key rotation")
+	}
+
+	key, err := base64.StdEncoding.DecodeString(encoded)
+
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("JWT_KEY_ENCRYPTION_KEY must be 32 bytes in base64")
+	}
+
+	return key, nil
+}
+
+func keyCipher() (cipher.AEAD, error) {
+
+	key, err := KeyEncryptionKey()
+
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// EncryptPrivateKey шифрует результат MarshalPrivateKey для хранения (AES-256-GCM). kid и алгоритм
+// входят в проверяемые данные, поэтому зашифрованный ключ нельзя переставить в чужую запись
+func EncryptPrivateKey(kid, algorithm string, data []byte) ([]byte, error) {
+
+	aead, err := keyCipher()
+
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	sealed := aead.Seal(nonce, nonce, data, []byte(kid+" "+algorithm))
+
+	return []byte(encryptedKeyPrefix + base64.StdEncoding.EncodeToString(sealed)), nil
+}
+
+// DecryptPrivateKey расшифровывает ключ, сохранённый EncryptPrivateKey. Незашифрованные ключи
+// не принимаются: иначе записью в таблицу ключей можно было бы подложить свой ключ подписи
+func DecryptPrivateKey(kid, algorithm string, data []byte) ([]byte, error) {
+
+	encoded, ok := strings.CutPrefix(string(data), encryptedKeyPrefix)
+
+	if !ok {
+		return nil, fmt.Errorf("signing key is not encrypted")
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := keyCipher()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("signing key is truncated")
+	}
+
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+
+	return aead.Open(nil, nonce, ciphertext, []byte(kid+" "+algorithm))
+}
+
+// ParsePrivateKey восстанавливает ключ, сохранённый MarshalPrivateKey
+func ParsePrivateKey(kid, algorithm string, data []byte, created_at time.Time) (Key, error) {
+
+	var key Key
+	var err error
+
+	if algorithm == jwt.SigningMethodHS512.Alg() {
+		key = hmacKey(kid, data)
+	} else if key, err = parseKeyPair(algorithm, data, nil); err != nil {
+		return Key{}, err
+	}
+
+	key.ID = kid
+	key.CreatedAt = created_at
+
+	return key, nil
+}
+
+// verificationKey выбирает ключ по kid и принимает токен, только если его алгоритм
+// совпадает с алгоритмом ключа. Иначе, например, RS512 токен можно было бы подделать
+// как HS512, подписав его публичным ключом. Токены без kid выпущены до ротации
+// и проверяются статическим ключом
+func verificationKey(token *jwt.Token) (any, error) {
+
+	var key Key
+	var ok bool
+
+	if kid, has_kid := token.Header["kid"].(string); has_kid {
+		key, ok = keys.lookup(kid)
+	} else {
+		keys.mu.RLock()
+		if len(keys.keys) > 0 {
+			key, ok = keys.keys[0], true
+		}
+		keys.mu.RUnlock()
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key")
+	}
+
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %q", token.Method.Alg())
+	}
+
+	return key.Public, nil
+}
+
+func validMethods() []string {
+
+	keys.mu.RLock()
+	defer keys.mu.RUnlock()
+
+	var methods []string
+
+	for _, key := range keys.keys {
+
+		known := false
+
+		for _, method := range methods {
+			known = known || method == key.Method.Alg()
+		}
+
+		if !known {
+			methods = append(methods, key.Method.Alg())
+		}
+	}
+
+	return methods
+}
@@ -0,0 +1,472 @@
+package token
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/redeflesq/auth-example/internal/model"
+)
+
+// useKeys подменяет глобальный набор ключей на время теста
+func useKeys(t *testing.T) {
+
+	t.Helper()
+
+	keys.mu.RLock()
+	saved := keys.keys
+	keys.mu.RUnlock()
+
+	t.Cleanup(func() {
+		keys.mu.Lock()
+		keys.keys = saved
+		keys.mu.Unlock()
+	})
+
+	t.Setenv("JWT_EXPIRATION_MINUTES", "15")
+	t.Setenv("JWT_PUBLIC_KEY_FILE", "")
+}
+
+// writeKey сохраняет приватный ключ в PKCS#8 PEM и возвращает путь к файлу
+func writeKey(t *testing.T, private any) string {
+
+	t.Helper()
+
+	private_pem, err := MarshalPrivateKey(Key{Private: private})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "private.pem")
+	if err = os.WriteFile(path, private_pem, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func publicPEM(t *testing.T, public any) []byte {
+
+	t.Helper()
+
+	der, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func testClaims() model.Claims {
+	return model.Claims{
+		UserID:   "00000000-0000-0000-0000-000000000001",
+		PairID:   "00000000-0000-0000-0000-000000000002",
+		TokenUse: model.TokenUseUser,
+	}
+}
+
+func TestRS512RejectsHS512SignedWithPublicKey(t *testing.T) {
+
+	useKeys(t)
+
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("JWT_ALGORITHM", "RS512")
+	t.Setenv("JWT_PRIVATE_KEY_FILE", writeKey(t, private))
+
+	if err = Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	signed, err := signJWT(testClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = ParseJWT(signed, &model.Claims{}); err != nil {
+		t.Fatalf("genuine RS512 token rejected: %v", err)
+	}
+
+	static, _ := keys.signingKey()
+
+	// Подделка: HS512 с публичным PEM в качестве секрета и kid настоящего ключа
+	claims := testClaims()
+	claims.Issuer = Issuer()
+	claims.IssuedAt = jwt.NewNumericDate(time.Now())
+	claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(time.Minute))
+
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS512, claims)
+	forged.Header["kid"] = static.ID
+
+	forged_str, err := forged.SignedString(publicPEM(t, &private.PublicKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = ParseJWT(forged_str, &model.Claims{}); err == nil {
+		t.Fatal("HS512 token signed with the RS512 public key accepted")
+	}
+
+	// verificationKey отказывает сам по себе, не полагаясь на список допустимых алгоритмов
+	if _, err = verificationKey(forged); err == nil {
+		t.Fatal("verificationKey returned a key for a mismatched algorithm")
+	}
+}
+
+func TestAlgNoneRejected(t *testing.T) {
+
+	useKeys(t)
+
+	t.Setenv("JWT_ALGORITHM", "HS512")
+	t.Setenv("JWT_SECRET", "keys-test-secret")
+
+	if err := Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	claims := testClaims()
+	claims.Issuer = Issuer()
+	claims.IssuedAt = jwt.NewNumericDate(time.Now())
+	claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(time.Minute))
+
+	for _, with_kid := range []bool{false, true} {
+
+		unsigned := jwt.NewWithClaims(jwt.SigningMethodNone, claims)
+		if with_kid {
+			static, _ := keys.signingKey()
+			unsigned.Header["kid"] = static.ID
+		}
+
+		unsigned_str, err := unsigned.SignedString(jwt.UnsafeAllowNoneSignatureType)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err = ParseJWT(unsigned_str, &model.Claims{}); err == nil {
+			t.Fatalf("alg none accepted (kid: %v)", with_kid)
+		}
+
+		if _, err = ParseJWTWithoutValidation(unsigned_str, &model.Claims{}); err == nil {
+			t.Fatalf("alg none accepted without claims validation (kid: %v)", with_kid)
+		}
+	}
+}
+
+func TestES512RequiresP521(t *testing.T) {
+
+	useKeys(t)
+
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("JWT_ALGORITHM", "ES512")
+	t.Setenv("JWT_PRIVATE_KEY_FILE", writeKey(t, private))
+
+	if err = Init(); err == nil {
+		t.Fatal("ES512 accepted a P-256 key")
+	}
+
+	private_pem, _ := MarshalPrivateKey(Key{Private: private})
+
+	if _, err = ParsePrivateKey("rotated", "ES512", private_pem, time.Now()); err == nil {
+		t.Fatal("ES512 accepted a stored P-256 key")
+	}
+}
+
+func TestInitRejectsKeyOfAnotherAlgorithm(t *testing.T) {
+
+	useKeys(t)
+
+	_, ed_private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ec_private, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		algorithm string
+		private   any
+	}{
+		{"RS512", ed_private},
+		{"RS512", ec_private},
+		{"ES512", ed_private},
+		{"EdDSA", ec_private},
+	}
+
+	for _, c := range cases {
+
+		t.Setenv("JWT_ALGORITHM", c.algorithm)
+		t.Setenv("JWT_PRIVATE_KEY_FILE", writeKey(t, c.private))
+
+		if err = Init(); err == nil {
+			t.Errorf("%s accepted a %T key", c.algorithm, c.private)
+		}
+	}
+
+	// Публичный ключ должен быть того же типа, что и приватный
+	t.Setenv("JWT_ALGORITHM", "ES512")
+	t.Setenv("JWT_PRIVATE_KEY_FILE", writeKey(t, ec_private))
+
+	public_path := filepath.Join(t.TempDir(), "public.pem")
+	if err = os.WriteFile(public_path, publicPEM(t, ed_private.Public()), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("JWT_PUBLIC_KEY_FILE", public_path)
+
+	if err = Init(); err == nil {
+		t.Error("ES512 accepted an Ed25519 public key")
+	}
+}
+
+// rotatedKey создаёт Ed25519 ключ ротации, выпущенный в момент created_at
+func rotatedKey(t *testing.T, kid string, created_at time.Time) Key {
+
+	t.Helper()
+
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	private_pem, _ := MarshalPrivateKey(Key{Private: private})
+
+	key, err := ParsePrivateKey(kid, "EdDSA", private_pem, created_at)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+func initEdDSA(t *testing.T) Key {
+
+	t.Helper()
+
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("JWT_ALGORITHM", "EdDSA")
+	t.Setenv("JWT_PRIVATE_KEY_FILE", writeKey(t, private))
+
+	if err = Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	static, _ := keys.signingKey()
+
+	return static
+}
+
+func signingKeyID(t *testing.T) string {
+
+	t.Helper()
+
+	signed, err := signJWT(testClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, _, err := jwt.NewParser().ParseUnverified(signed, &model.Claims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return parsed.Header["kid"].(string)
+}
+
+func publishedIDs() map[string]bool {
+
+	ids := map[string]bool{}
+
+	for _, jwk := range JWKS().Keys {
+		ids[jwk.Kid] = true
+	}
+
+	return ids
+}
+
+func TestRotatedKeyActivationDelay(t *testing.T) {
+
+	useKeys(t)
+
+	static := initEdDSA(t)
+
+	// Свежий ключ уже опубликован, но ещё не подписывает
+	fresh := rotatedKey(t, "fresh", time.Now())
+	SetRotatedKeys([]Key{fresh})
+
+	if kid := signingKeyID(t); kid != static.ID {
+		t.Fatalf("signed with %s before the activation delay, want %s", kid, static.ID)
+	}
+
+	if !publishedIDs()["fresh"] {
+		t.Fatal("pending key is not published")
+	}
+
+	// После задержки активации подписывает новый ключ, старый уходит на покой
+	active := rotatedKey(t, "active", time.Now().Add(-KeyActivationDelay-time.Second))
+	SetRotatedKeys([]Key{active, fresh})
+
+	if kid := signingKeyID(t); kid != "active" {
+		t.Fatalf("signed with %s, want the activated key", kid)
+	}
+
+	keys.mu.RLock()
+	retired_at := keys.keys[0].RetiredAt
+	keys.mu.RUnlock()
+
+	if retired_at.IsZero() || retired_at.After(time.Now()) {
+		t.Fatalf("static key is not retired: %v", retired_at)
+	}
+}
+
+func TestRetiredKeyPublishedUntilExpiration(t *testing.T) {
+
+	useKeys(t)
+
+	static := initEdDSA(t)
+
+	// Преемник активирован 5 минут назад: токены статического ключа ещё живы
+	successor := rotatedKey(t, "successor", time.Now().Add(-KeyActivationDelay-5*time.Minute))
+	SetRotatedKeys([]Key{successor})
+
+	if published := publishedIDs(); !published[static.ID] || !published["successor"] {
+		t.Fatalf("published %v, want both keys", published)
+	}
+
+	// Через JWT_EXPIRATION_MINUTES после ухода на покой ключ снимается с публикации
+	successor = rotatedKey(t, "successor", time.Now().Add(-KeyActivationDelay-16*time.Minute))
+	SetRotatedKeys([]Key{successor})
+
+	if published := publishedIDs(); published[static.ID] || !published["successor"] {
+		t.Fatalf("published %v, want only the successor", published)
+	}
+
+	// Снятый с публикации ключ остаётся в наборе для проверки на /auth/refresh
+	if _, ok := keys.lookup(static.ID); !ok {
+		t.Fatal("retired key removed from the key set")
+	}
+}
+
+func TestUnknownKidRejected(t *testing.T) {
+
+	useKeys(t)
+
+	initEdDSA(t)
+
+	SetRotatedKeys([]Key{rotatedKey(t, "rotated", time.Now().Add(-KeyActivationDelay-time.Second))})
+
+	signed, err := signJWT(testClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = ParseJWT(signed, &model.Claims{}); err != nil {
+		t.Fatalf("token of a rotated key rejected: %v", err)
+	}
+
+	// Ключ удалён из хранилища: его токены больше не принимаются
+	SetRotatedKeys(nil)
+
+	if _, err = ParseJWT(signed, &model.Claims{}); err == nil {
+		t.Fatal("token with an unknown kid accepted")
+	}
+
+	if _, err = ParseJWTWithoutValidation(signed, &model.Claims{}); err == nil {
+		t.Fatal("token with an unknown kid accepted without claims validation")
+	}
+}
+
+func TestHMACKeysNotPublished(t *testing.T) {
+
+	useKeys(t)
+
+	t.Setenv("JWT_ALGORITHM", "HS512")
+	t.Setenv("JWT_SECRET", "keys-test-secret")
+
+	if err := Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	SetRotatedKeys([]Key{rotated})
+
+	if published := len(PublishedKeys()); published != 2 {
+		t.Fatalf("%d keys in the verification set, want 2", published)
+	}
+
+	if jwks := JWKS(); len(jwks.Keys) != 0 {
+		t.Fatalf("HMAC keys published: %+v", jwks.Keys)
+	}
+}
+
+func TestPrivateKeyEncryption(t *testing.T) {
+
+	t.Setenv("JWT_KEY_ENCRYPTION_KEY", base64.StdEncoding.EncodeToString(make([]byte, 32)))
+
+	secret := []byte("rotated hmac secret")
+
+	encrypted, err := EncryptPrivateKey("kid-1", "HS512", secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(string(encrypted), string(secret)) {
+		t.Fatal("secret stored in plaintext")
+	}
+
+	if decrypted, err := DecryptPrivateKey("kid-1", "HS512", encrypted); err != nil || string(decrypted) != string(secret) {
+		t.Fatalf("decrypted %q, %v", decrypted, err)
+	}
+
+	// Зашифрованный ключ привязан к своей записи
+	if _, err = DecryptPrivateKey("kid-2", "HS512", encrypted); err == nil {
+		t.Fatal("key decrypted for another kid")
+	}
+
+	if _, err = DecryptPrivateKey("kid-1", "HS512", secret); err == nil {
+		t.Fatal("plaintext key accepted")
+	}
+
+	t.Setenv("JWT_KEY_ENCRYPTION_KEY", base64.StdEncoding.EncodeToString(append(make([]byte, 31), 1)))
+
+	if _, err = DecryptPrivateKey("kid-1", "HS512", encrypted); err == nil {
+		t.Fatal("key decrypted with another encryption key")
+	}
+
+	for _, value := range []string{"", "short", base64.StdEncoding.EncodeToString(make([]byte, 16))} {
+
+		t.Setenv("JWT_KEY_ENCRYPTION_KEY", value)
+
+		if _, err = EncryptPrivateKey("kid-1", "HS512", secret); err == nil {
+			t.Fatalf("encrypted with JWT_KEY_ENCRYPTION_KEY %q", value)
+		}
+	}
+}
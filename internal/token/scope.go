@@ -0,0 +1,79 @@
+package token
+
+import (
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/redeflesq/auth-example/internal/model"
+)
+
+// Scope маршрутов самого сервиса
+const (
+	ScopeProfile       = "profile"
+	ScopeSessionsRead  = "sessions:read"
+	ScopeSessionsWrite = "sessions:write"
+	// Доступ к /admin. Не входит в scope по умолчанию и выдаётся только операторам по явному запросу
+	ScopeAdmin = "admin"
+)
+
+// Audience возвращает aud токенов, выпущенных для самого сервиса, из JWT_AUDIENCE, по умолчанию issuer
+func Audience() string {
+
+	audience := os.Getenv("JWT_AUDIENCE")
+
+	if audience == "" {
+		return Issuer()
+	}
+
+	return audience
+}
+
+// UserScopes возвращает scope, доступные токенам пользователей, из AUTH_USER_SCOPES.
+// По умолчанию - scope маршрутов самого сервиса
+func UserScopes() []string {
+
+	if scopes := strings.Fields(os.Getenv("AUTH_USER_SCOPES")); len(scopes) > 0 {
+		return scopes
+	}
+
+	return []string{ScopeProfile, ScopeSessionsRead, ScopeSessionsWrite}
+}
+
+// GrantScope проверяет, что запрошенные scope входят в allowed, и возвращает scope для токена.
+// Пустой запрос получает все allowed, как в RFC 6749, раздел 3.3
+func GrantScope(requested string, allowed []string) (string, bool) {
+
+	if strings.TrimSpace(requested) == "" {
+		return strings.Join(allowed, " "), true
+	}
+
+	var granted []string
+
+	for _, scope := range strings.Fields(requested) {
+
+		if !slices.Contains(allowed, scope) {
+			return "", false
+		}
+
+		if !slices.Contains(granted, scope) {
+			granted = append(granted, scope)
+		}
+	}
+
+	return strings.Join(granted, " "), true
+}
+
+// HasScopes сообщает, что токен содержит все перечисленные scope
+func HasScopes(claims *model.Claims, scopes ...string) bool {
+
+	granted := strings.Fields(claims.Scope)
+
+	for _, scope := range scopes {
+		if !slices.Contains(granted, scope) {
+			return false
+		}
+	}
+
+	return true
+}
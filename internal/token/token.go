@@ -1,6 +1,7 @@
 package token
 
 import (
+	"crypto/sha256"
 	"encoding/base64"
 	"fmt"
 	"os"
@@ -15,11 +16,24 @@ import (
 	"github.com/redeflesq/auth-example/internal/model"
 )
 
-func HashRefreshToken(token_data, expected_user_id string) ([]byte, error) {
+// refreshTokenSecret возвращает строку, хешируемую bcrypt. bcrypt принимает не больше 72 байт,
+// а user_id из UUID вместе с токеном длиннее, поэтому длинные строки сначала сжимаются SHA-256.
+// Короткие хешируются как раньше, и уже выданные токены остаются действительными
+func refreshTokenSecret(token_data, user_id string) []byte {
+
+	secret := []byte(user_id + ":" + token_data)
+
+	if len(secret) > 72 {
+		sum := sha256.Sum256(secret)
+		secret = []byte(base64.StdEncoding.EncodeToString(sum[:]))
+	}
+
+	return secret
+}
 
-	to_hash := expected_user_id + ":" + token_data
+func HashRefreshToken(token_data, expected_user_id string) ([]byte, error) {
 
-	hash, err := bcrypt.GenerateFromPassword([]byte(to_hash), bcrypt.DefaultCost)
+	hash, err := bcrypt.GenerateFromPassword(refreshTokenSecret(token_data, expected_user_id), bcrypt.DefaultCost)
 
 	return hash, err
 }
@@ -60,53 +74,138 @@ func DecodeRefreshToken(token string) (string, string, error) {
 
 func VerifyRefreshToken(token_data string, hash string, expected_user_id string) bool {
 
-	to_check := expected_user_id + ":" + token_data
-
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(to_check))
+	err := bcrypt.CompareHashAndPassword([]byte(hash), refreshTokenSecret(token_data, expected_user_id))
 
 	return err == nil
 }
 
-func GenerateJWT(user_id string, pair_id string) (string, error) {
+// Issuer возвращает значение iss из JWT_ISSUER. Для OpenID Connect это должен
+// быть https URL сервиса, по умолчанию остаётся прежнее значение
+func Issuer() string {
+
+	issuer := os.Getenv("JWT_ISSUER")
+
+	if issuer == "" {
+		return "auth-example"
+	}
+
+	return issuer
+}
+
+func JWTExpiration() time.Duration {
 
-	secret := []byte(os.Getenv("JWT_SECRET"))
 	expiration, _ := strconv.Atoi(os.Getenv("JWT_EXPIRATION_MINUTES"))
 
-	claims := model.Claims{
-		UserID: user_id,
-		PairID: pair_id,
+	return time.Minute * time.Duration(expiration)
+}
+
+// GenerateJWT выпускает access токен пользователя, дополняя его claims от провайдера claims
+func GenerateJWT(user_id, pair_id, client_id, scope string, roles []string) (string, error) {
+
+	extra, err := providedClaims(ClaimsRequest{UserID: user_id, ClientID: client_id, Scope: scope, Roles: roles})
+
+	if err != nil {
+		return "", err
+	}
+
+	return signJWT(model.Claims{
+		UserID:           user_id,
+		PairID:           pair_id,
+		AuthorizedParty:  client_id,
+		TokenUse:         model.TokenUseUser,
+		Scope:            scope,
+		Roles:            roles,
+		Extra:            extra,
+		RegisteredClaims: jwt.RegisteredClaims{Audience: jwt.ClaimStrings{Audience()}},
+	})
+}
+
+// GenerateClientJWT выпускает машинный токен клиента (client_credentials): sub и azp - client_id,
+// refresh токена нет, pair_id нужен только для отзыва. Пустой audience - токен для самого сервиса
+func GenerateClientJWT(client_id, scope, audience string) (string, error) {
+
+	if audience == "" {
+		audience = Audience()
+	}
+
+	return signJWT(model.Claims{
+		PairID:           uuid.NewString(),
+		AuthorizedParty:  client_id,
+		TokenUse:         model.TokenUseClient,
+		Scope:            scope,
+		RegisteredClaims: jwt.RegisteredClaims{Subject: client_id, Audience: jwt.ClaimStrings{audience}},
+	})
+}
+
+// GenerateExchangedJWT выпускает токен для сервиса audience от имени субъекта subject (RFC 8693).
+// Токен принадлежит той же паре, поэтому отзывается вместе с исходным и живёт не дольше его.
+// client_id вызывающего сервиса записывается в act поверх цепочки из subject. Возвращает срок действия
+func GenerateExchangedJWT(subject *model.Claims, client_id, audience, scope string) (string, time.Time, error) {
+
+	expires_at := time.Now().Add(JWTExpiration())
+
+	if subject.ExpiresAt != nil && subject.ExpiresAt.Time.Before(expires_at) {
+		expires_at = subject.ExpiresAt.Time
+	}
+
+	access_token, err := signJWT(model.Claims{
+		UserID:          subject.UserID,
+		PairID:          subject.PairID,
+		AuthorizedParty: client_id,
+		TokenUse:        subject.TokenUse,
+		Actor:           &model.Actor{Subject: client_id, Actor: subject.Actor},
+		Scope:           scope,
+		Roles:           subject.Roles,
+		Extra:           subject.Extra,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute * time.Duration(expiration))),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			Issuer:    "auth-example",
+			Subject:   subject.Subject,
+			Audience:  jwt.ClaimStrings{audience},
+			ExpiresAt: jwt.NewNumericDate(expires_at),
 		},
+	})
+
+	return access_token, expires_at, err
+}
+
+// signJWT дополняет claims издателем и, если он не задан, сроком действия и подписывает текущим ключом
+func signJWT(claims model.Claims) (string, error) {
+
+	key, err := keys.signingKey()
+
+	if err != nil {
+		return "", err
+	}
+
+	if claims.ExpiresAt == nil {
+		claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(JWTExpiration()))
 	}
+	claims.IssuedAt = jwt.NewNumericDate(time.Now())
+	claims.Issuer = Issuer()
 
-	// Или ES512? Не особо понятно..
-	token := jwt.NewWithClaims(jwt.SigningMethodHS512, claims)
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
 
-	return token.SignedString(secret)
+	return token.SignedString(key.Private)
 }
 
 func ParseJWT(token_str string, claims jwt.Claims) (*jwt.Token, error) {
 
-	token, err := jwt.ParseWithClaims(token_str, claims, func(token *jwt.Token) (any, error) {
-		return []byte(os.Getenv("JWT_SECRET")), nil
-	}, jwt.WithExpirationRequired(), jwt.WithIssuedAt(), jwt.WithIssuer("auth-example"))
+	token, err := jwt.ParseWithClaims(token_str, claims, verificationKey,
+		jwt.WithValidMethods(validMethods()), jwt.WithExpirationRequired(), jwt.WithIssuedAt(), jwt.WithIssuer(Issuer()))
 
 	return token, err
 }
 
 func ParseJWTWithoutValidation(token_str string, claims jwt.Claims) (*jwt.Token, error) {
 
-	token, err := jwt.ParseWithClaims(token_str, claims, func(token *jwt.Token) (any, error) {
-		return []byte(os.Getenv("JWT_SECRET")), nil
-	}, jwt.WithoutClaimsValidation())
+	token, err := jwt.ParseWithClaims(token_str, claims, verificationKey,
+		jwt.WithValidMethods(validMethods()), jwt.WithoutClaimsValidation())
 
 	return token, err
 }
 
-func GenerateTokensPair(user_id string) (model.TokenPair, error) {
+// GenerateTokensPair выпускает пару для пользователя. client_id попадает в azp, пустой - без azp
+func GenerateTokensPair(user_id, client_id, scope string, roles []string) (model.TokenPair, error) {
 
 	var token_pair model.TokenPair
 
@@ -118,7 +217,7 @@ func GenerateTokensPair(user_id string) (model.TokenPair, error) {
 		return token_pair, err
 	}
 
-	jwt, err := GenerateJWT(user_id, pair_id)
+	jwt, err := GenerateJWT(user_id, pair_id, client_id, scope, roles)
 
 	if err != nil {
 		return token_pair, err
@@ -128,6 +227,7 @@ func GenerateTokensPair(user_id string) (model.TokenPair, error) {
 	token_pair.RefreshToken.Hash = refresh_hash
 	token_pair.RefreshToken.Token = refresh_token
 	token_pair.PairID = pair_id
+	token_pair.Scope = scope
 
 	return token_pair, nil
 }
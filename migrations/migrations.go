@@ -0,0 +1,8 @@
+// Package migrations содержит версионированные миграции схемы БД,
+// встроенные в бинарник. Файлы именуются как NNNN_name.up.sql / NNNN_name.down.sql
+package migrations
+
+import "embed"
+
+//go:embed postgres/*.sql sqlite/*.sql
+var FS embed.FS
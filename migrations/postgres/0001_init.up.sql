@@ -15,4 +15,4 @@ CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user_id ON refresh_tokens(user_id)
 CREATE TABLE IF NOT EXISTS revoked_tokens (
     pair_id TEXT PRIMARY KEY,
     expires_at TIMESTAMP NOT NULL
-);
\ No newline at end of file
+);
@@ -0,0 +1,10 @@
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS family_id TEXT;
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS parent_pair_id TEXT;
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS is_rotated BOOLEAN DEFAULT FALSE;
+
+-- Каждая существующая пара становится началом собственной цепочки
+UPDATE refresh_tokens SET family_id = pair_id WHERE family_id IS NULL;
+
+ALTER TABLE refresh_tokens ALTER COLUMN family_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family_id ON refresh_tokens(family_id);
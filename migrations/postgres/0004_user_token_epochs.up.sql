@@ -0,0 +1,5 @@
+-- Access токены пользователя с iat раньше tokens_valid_after считаются отозванными
+CREATE TABLE IF NOT EXISTS user_token_epochs (
+    user_id TEXT PRIMARY KEY,
+    tokens_valid_after TIMESTAMP NOT NULL
+);
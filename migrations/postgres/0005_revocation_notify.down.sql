@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS user_token_epochs_notify ON user_token_epochs;
+DROP TRIGGER IF EXISTS revoked_tokens_notify ON revoked_tokens;
+DROP FUNCTION IF EXISTS notify_user_tokens_invalidated();
+DROP FUNCTION IF EXISTS notify_access_token_revoked();
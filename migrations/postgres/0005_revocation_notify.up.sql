@@ -0,0 +1,24 @@
+-- Реплики держат отозванные пары в памяти и узнают о новых отзывах через LISTEN token_revocations.
+-- Триггеры покрывают все пути отзыва, включая массовые, а уведомление уходит только после коммита.
+-- Refresh токены всегда проверяются в базе, поэтому об их отзыве не сообщается
+CREATE OR REPLACE FUNCTION notify_access_token_revoked() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('token_revocations', 'access:' || NEW.pair_id);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION notify_user_tokens_invalidated() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('token_revocations', 'epoch:' || NEW.user_id);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS revoked_tokens_notify ON revoked_tokens;
+CREATE TRIGGER revoked_tokens_notify AFTER INSERT ON revoked_tokens
+    FOR EACH ROW EXECUTE FUNCTION notify_access_token_revoked();
+
+DROP TRIGGER IF EXISTS user_token_epochs_notify ON user_token_epochs;
+CREATE TRIGGER user_token_epochs_notify AFTER INSERT OR UPDATE ON user_token_epochs
+    FOR EACH ROW EXECUTE FUNCTION notify_user_tokens_invalidated();
@@ -0,0 +1,12 @@
+-- Разрешённые redirect_uri клиента через пробел
+ALTER TABLE clients ADD COLUMN IF NOT EXISTS redirect_uris TEXT NOT NULL DEFAULT '';
+
+-- Коды авторизации одноразовые: строка удаляется при обмене на токены
+CREATE TABLE IF NOT EXISTS authorization_codes (
+    code_hash TEXT PRIMARY KEY,
+    client_id TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    redirect_uri TEXT NOT NULL,
+    code_challenge TEXT NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
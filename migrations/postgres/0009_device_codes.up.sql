@@ -0,0 +1,13 @@
+-- Запросы авторизации устройств (RFC 8628). Строка удаляется, когда устройство
+-- получает токены или отказ, истекшие удаляет очистка
+CREATE TABLE IF NOT EXISTS device_codes (
+    code_hash TEXT PRIMARY KEY,
+    user_code TEXT NOT NULL UNIQUE,
+    client_id TEXT NOT NULL,
+    user_id TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL DEFAULT 'pending',
+    user_agent TEXT NOT NULL DEFAULT '',
+    ip_address TEXT NOT NULL DEFAULT '',
+    last_polled_at TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,4 @@
+ALTER TABLE clients DROP COLUMN IF EXISTS scopes;
+ALTER TABLE device_codes DROP COLUMN IF EXISTS scope;
+ALTER TABLE authorization_codes DROP COLUMN IF EXISTS scope;
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS scope;
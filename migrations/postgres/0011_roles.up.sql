@@ -0,0 +1,2 @@
+-- роли пользователя через пробел: user, admin, support
+ALTER TABLE users ADD COLUMN IF NOT EXISTS roles TEXT NOT NULL DEFAULT 'user';
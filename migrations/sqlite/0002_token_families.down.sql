@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_refresh_tokens_family_id;
+
+ALTER TABLE refresh_tokens DROP COLUMN is_rotated;
+ALTER TABLE refresh_tokens DROP COLUMN parent_pair_id;
+ALTER TABLE refresh_tokens DROP COLUMN family_id;
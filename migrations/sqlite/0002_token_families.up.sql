@@ -0,0 +1,8 @@
+ALTER TABLE refresh_tokens ADD COLUMN family_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE refresh_tokens ADD COLUMN parent_pair_id TEXT;
+ALTER TABLE refresh_tokens ADD COLUMN is_rotated BOOLEAN DEFAULT FALSE;
+
+-- Каждая существующая пара становится началом собственной цепочки
+UPDATE refresh_tokens SET family_id = pair_id WHERE family_id = '';
+
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family_id ON refresh_tokens(family_id);
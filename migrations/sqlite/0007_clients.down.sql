@@ -0,0 +1,3 @@
+ALTER TABLE refresh_tokens DROP COLUMN client_id;
+
+DROP TABLE IF EXISTS clients;
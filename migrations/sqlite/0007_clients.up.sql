@@ -0,0 +1,12 @@
+-- API клиенты, которым разрешено получать токены: по client_secret (хранится SHA-256)
+-- или по subject DN сертификата mTLS
+CREATE TABLE IF NOT EXISTS clients (
+    client_id TEXT PRIMARY KEY,
+    secret_hash TEXT NOT NULL DEFAULT '',
+    cert_subject TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_clients_cert_subject ON clients(cert_subject);
+
+ALTER TABLE refresh_tokens ADD COLUMN client_id TEXT NOT NULL DEFAULT '';
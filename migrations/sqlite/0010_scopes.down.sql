@@ -0,0 +1,4 @@
+ALTER TABLE clients DROP COLUMN scopes;
+ALTER TABLE device_codes DROP COLUMN scope;
+ALTER TABLE authorization_codes DROP COLUMN scope;
+ALTER TABLE refresh_tokens DROP COLUMN scope;
@@ -0,0 +1,7 @@
+-- scope токенов через пробел. Пустой scope у выданных раньше сессий означает scope по умолчанию
+ALTER TABLE refresh_tokens ADD COLUMN scope TEXT NOT NULL DEFAULT '';
+ALTER TABLE authorization_codes ADD COLUMN scope TEXT NOT NULL DEFAULT '';
+ALTER TABLE device_codes ADD COLUMN scope TEXT NOT NULL DEFAULT '';
+
+-- scope, которые может получить клиент, через пробел
+ALTER TABLE clients ADD COLUMN scopes TEXT NOT NULL DEFAULT '';
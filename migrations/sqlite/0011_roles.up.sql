@@ -0,0 +1,2 @@
+-- роли пользователя через пробел: user, admin, support
+ALTER TABLE users ADD COLUMN roles TEXT NOT NULL DEFAULT 'user';
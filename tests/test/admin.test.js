@@ -0,0 +1,172 @@
+const request = require('supertest');
+
+const BASE_URL = 'http://localhost:8080';
+const CLIENT_ID = 'test-client';
+const CLIENT_SECRET = 'test-client-secret-for-jest-tests-only';
+const ADMIN_USERNAME = 'admin';
+const ADMIN_PASSWORD = 'admin-password';
+const USERNAME = 'admin-target-' + Math.random().toString(36).substring(7);
+const PASSWORD = 'correct horse battery staple';
+
+const decodeClaims = (jwt) => JSON.parse(Buffer.from(jwt.split('.')[1], 'base64url').toString());
+
+const signIn = async (username, password, scope) => {
+    const response = await request(BASE_URL)
+        .post('/auth/token')
+        .send({ username, password, scope })
+        .expect(200);
+
+    return response.body.access_token;
+};
+
+describe('Admin API', () => {
+
+    let admin_token = '';
+    let user_id = '';
+
+    beforeAll(async () => {
+        const response = await request(BASE_URL)
+            .post('/auth/register')
+            .send({ username: USERNAME, password: PASSWORD })
+            .expect(201);
+
+        user_id = response.body.user_id;
+        admin_token = await signIn(ADMIN_USERNAME, ADMIN_PASSWORD, 'admin');
+    });
+
+    test('POST /auth/token - should embed roles in the access token', async () => {
+        expect(decodeClaims(admin_token).roles).toContain('admin');
+
+        const user_token = await signIn(USERNAME, PASSWORD);
+        expect(decodeClaims(user_token).roles).toEqual(['user']);
+    });
+
+    test('GET /admin/users - should reject a user without an operator role', async () => {
+        const user_token = await signIn(USERNAME, PASSWORD);
+
+        const response = await request(BASE_URL)
+            .get('/admin/users')
+            .query({ username: USERNAME })
+            .set('Authorization', `Bearer ${user_token}`)
+            .expect(403);
+
+        expect(response.body.error).toBe('Insufficient role');
+    });
+
+    test('GET /admin/users - should reject an operator token without the admin scope', async () => {
+        const default_token = await signIn(ADMIN_USERNAME, ADMIN_PASSWORD);
+        expect(decodeClaims(default_token).scope.split(' ')).not.toContain('admin');
+
+        const response = await request(BASE_URL)
+            .get('/admin/users')
+            .query({ username: USERNAME })
+            .set('Authorization', `Bearer ${default_token}`)
+            .expect(403);
+
+        expect(response.body.error).toBe('Insufficient scope');
+        expect(response.headers['www-authenticate']).toContain('insufficient_scope');
+    });
+
+    test('POST /auth/token - should not grant the admin scope to a user without an operator role', async () => {
+        const response = await request(BASE_URL)
+            .post('/auth/token')
+            .send({ username: USERNAME, password: PASSWORD, scope: 'profile admin' })
+            .expect(200);
+
+        expect(response.body.scope).toBe('profile');
+        expect(decodeClaims(response.body.access_token).scope).toBe('profile');
+    });
+
+    test('POST /auth/token - should not mint an admin token through the trusted client', async () => {
+        const admin = await request(BASE_URL)
+            .get('/admin/users')
+            .query({ username: ADMIN_USERNAME })
+            .set('Authorization', `Bearer ${admin_token}`)
+            .expect(200);
+
+        const response = await request(BASE_URL)
+            .post('/auth/token')
+            .auth(CLIENT_ID, CLIENT_SECRET)
+            .send({ user_id: admin.body.user_id, scope: 'admin' })
+            .expect(403);
+
+        expect(response.body.error).toBe('Operators must sign in with a password');
+    });
+
+    test('GET /admin/users - should find a user by username', async () => {
+        const response = await request(BASE_URL)
+            .get('/admin/users')
+            .query({ username: USERNAME.toUpperCase() })
+            .set('Authorization', `Bearer ${admin_token}`)
+            .expect(200);
+
+        expect(response.body.user_id).toBe(user_id);
+        expect(response.body.roles).toEqual(['user']);
+    });
+
+    test('DELETE /admin/users/{user_id}/sessions/{pair_id} - should revoke a session of the user', async () => {
+        const user_token = await signIn(USERNAME, PASSWORD);
+
+        const sessions = await request(BASE_URL)
+            .get(`/admin/users/${user_id}/sessions`)
+            .set('Authorization', `Bearer ${admin_token}`)
+            .expect(200);
+
+        const { pair_id } = decodeClaims(user_token);
+        expect(sessions.body.sessions.map((session) => session.pair_id)).toContain(pair_id);
+
+        await request(BASE_URL)
+            .delete(`/admin/users/${user_id}/sessions/${pair_id}`)
+            .set('Authorization', `Bearer ${admin_token}`)
+            .expect(200);
+
+        await request(BASE_URL)
+            .get('/auth/me')
+            .set('Authorization', `Bearer ${user_token}`)
+            .expect(401);
+    });
+
+    test('POST /admin/users/{user_id}/logout - should sign the user out everywhere', async () => {
+        const first = await signIn(USERNAME, PASSWORD);
+        const second = await signIn(USERNAME, PASSWORD);
+
+        await request(BASE_URL)
+            .post(`/admin/users/${user_id}/logout`)
+            .set('Authorization', `Bearer ${admin_token}`)
+            .expect(200);
+
+        for (const access_token of [first, second]) {
+            await request(BASE_URL)
+                .get('/auth/me')
+                .set('Authorization', `Bearer ${access_token}`)
+                .expect(401);
+        }
+    });
+
+    test('PUT /admin/users/{user_id}/roles - should grant support access to sessions only', async () => {
+        await request(BASE_URL)
+            .put(`/admin/users/${user_id}/roles`)
+            .set('Authorization', `Bearer ${admin_token}`)
+            .send({ roles: ['root'] })
+            .expect(400);
+
+        await request(BASE_URL)
+            .put(`/admin/users/${user_id}/roles`)
+            .set('Authorization', `Bearer ${admin_token}`)
+            .send({ roles: ['user', 'support'] })
+            .expect(200);
+
+        const support_token = await signIn(USERNAME, PASSWORD, 'admin');
+        expect(decodeClaims(support_token).roles).toEqual(['user', 'support']);
+
+        await request(BASE_URL)
+            .get(`/admin/users/${user_id}/sessions`)
+            .set('Authorization', `Bearer ${support_token}`)
+            .expect(200);
+
+        await request(BASE_URL)
+            .post(`/admin/users/${user_id}/logout`)
+            .set('Authorization', `Bearer ${support_token}`)
+            .expect(403);
+    });
+});
@@ -1,6 +1,8 @@
 const request = require('supertest');
 
 const BASE_URL = 'http://localhost:8080';
+const CLIENT_ID = 'test-client';
+const CLIENT_SECRET = 'test-client-secret-for-jest-tests-only';
 const TEST_USER_ID = 'test-user-' + Math.random().toString(36).substring(7);
 
 describe('Auth Service API', () => {
@@ -17,6 +19,7 @@ describe('Auth Service API', () => {
     test('POST /auth/token - should generate tokens', async () => {
         const response = await request(BASE_URL)
             .post('/auth/token')
+            .auth(CLIENT_ID, CLIENT_SECRET)
             .send({ user_id: TEST_USER_ID });
 
         expect(response.body.access_token).toBeDefined();
@@ -66,9 +69,31 @@ describe('Auth Service API', () => {
             .set('Authorization', `Bearer ${access_token}`); // оставим старый токен
 			
         expect(response.status).toBe(401)
+        expect(response.body.error).toBe('Refresh token reuse detected');
+    });
+
+    test('GET /auth/me - should reject new access token after refresh token reuse', async () => {
+        // повторное использование отзывает всю цепочку, включая новую пару
+        const response = await request(BASE_URL)
+            .get('/auth/me')
+            .set('Authorization', `Bearer ${new_access_token}`)
+            .expect(401);
+
         expect(response.body.error).toBe('Token revoked');
     });
 
+    test('POST /auth/token - should generate tokens after reuse detection', async () => {
+        const response = await request(BASE_URL)
+            .post('/auth/token')
+            .auth(CLIENT_ID, CLIENT_SECRET)
+            .send({ user_id: TEST_USER_ID });
+
+        expect(response.status).toBe(200)
+
+        new_access_token = response.body.access_token;
+        new_refresh_token = response.body.refresh_token;
+    });
+
     test('GET /auth/me - should work with new access token', async () => {
         const response = await request(BASE_URL)
             .get('/auth/me')
@@ -93,6 +118,7 @@ describe('Auth Service API', () => {
     test('POST /auth/token - should generate tokens after revoke', async () => {
         const response = await request(BASE_URL)
             .post('/auth/token')
+            .auth(CLIENT_ID, CLIENT_SECRET)
             .send({ user_id: TEST_USER_ID });
 
         expect(response.body.access_token).toBeDefined();
@@ -134,6 +160,7 @@ describe('Auth Service API', () => {
         const altUser = 'alt-user-' + Math.random().toString(36).substring(7);
         const alt = await request(BASE_URL)
             .post('/auth/token')
+            .auth(CLIENT_ID, CLIENT_SECRET)
             .send({ user_id: altUser });
 
         const mismatched_refresh_token = alt.body.refresh_token;
@@ -176,6 +203,7 @@ describe('Auth Service API', () => {
     test('POST /auth/token - should reject empty user_id', async () => {
         const response = await request(BASE_URL)
             .post('/auth/token')
+            .auth(CLIENT_ID, CLIENT_SECRET)
             .send({}) // нет user_id
             .expect(400);
 
@@ -186,6 +214,7 @@ describe('Auth Service API', () => {
         
         const token = await request(BASE_URL)
             .post('/auth/token')
+            .auth(CLIENT_ID, CLIENT_SECRET)
             .send({ user_id: TEST_USER_ID });
 
         expect(token.body.access_token).toBeDefined();
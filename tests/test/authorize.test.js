@@ -0,0 +1,150 @@
+const crypto = require('crypto');
+const request = require('supertest');
+
+const BASE_URL = 'http://localhost:8080';
+const CLIENT_ID = 'test-client';
+const CLIENT_SECRET = 'test-client-secret-for-jest-tests-only';
+const REDIRECT_URI = 'http://localhost:3000/callback';
+const USERNAME = 'oauth-user-' + Math.random().toString(36).substring(7);
+const PASSWORD = 'correct horse battery staple';
+
+const CODE_VERIFIER = crypto.randomBytes(32).toString('base64url');
+const CODE_CHALLENGE = crypto.createHash('sha256').update(CODE_VERIFIER).digest('base64url');
+
+const authorizeParams = (overrides = {}) => ({
+    response_type: 'code',
+    client_id: CLIENT_ID,
+    redirect_uri: REDIRECT_URI,
+    state: 'xyz',
+    code_challenge: CODE_CHALLENGE,
+    code_challenge_method: 'S256',
+    ...overrides,
+});
+
+// Проходит форму входа и возвращает код из redirect
+const authorize = async (code_challenge = CODE_CHALLENGE) => {
+    const response = await request(BASE_URL)
+        .post('/oauth/authorize')
+        .type('form')
+        .send({ ...authorizeParams({ code_challenge }), username: USERNAME, password: PASSWORD })
+        .expect(302);
+
+    return new URL(response.headers.location).searchParams.get('code');
+};
+
+const exchange = (code, code_verifier = CODE_VERIFIER) => request(BASE_URL)
+    .post('/oauth/token')
+    .auth(CLIENT_ID, CLIENT_SECRET)
+    .type('form')
+    .send({ grant_type: 'authorization_code', code, redirect_uri: REDIRECT_URI, code_verifier });
+
+describe('Authorization code flow', () => {
+
+    beforeAll(async () => {
+        await request(BASE_URL)
+            .post('/auth/register')
+            .send({ username: USERNAME, password: PASSWORD })
+            .expect(201);
+    });
+
+    test('GET /oauth/authorize - should render the sign-in form', async () => {
+        const response = await request(BASE_URL)
+            .get('/oauth/authorize')
+            .query(authorizeParams())
+            .expect(200);
+
+        expect(response.headers['content-type']).toContain('text/html');
+        expect(response.headers['x-frame-options']).toBe('DENY');
+        expect(response.text).toContain('name="password"');
+    });
+
+    test('GET /oauth/authorize - should not redirect to an unregistered redirect_uri', async () => {
+        const response = await request(BASE_URL)
+            .get('/oauth/authorize')
+            .query(authorizeParams({ redirect_uri: 'https://evil.example.com/callback' }))
+            .expect(400);
+
+        expect(response.headers.location).toBeUndefined();
+    });
+
+    test('GET /oauth/authorize - should redirect with an error without PKCE', async () => {
+        const response = await request(BASE_URL)
+            .get('/oauth/authorize')
+            .query(authorizeParams({ code_challenge: '', code_challenge_method: '' }))
+            .expect(302);
+
+        const location = new URL(response.headers.location);
+        expect(location.searchParams.get('error')).toBe('invalid_request');
+        expect(location.searchParams.get('state')).toBe('xyz');
+    });
+
+    test('POST /oauth/authorize - should show the form again for a wrong password', async () => {
+        await request(BASE_URL)
+            .post('/oauth/authorize')
+            .type('form')
+            .send({ ...authorizeParams(), username: USERNAME, password: 'wrong password' })
+            .expect(401);
+    });
+
+    test('POST /oauth/authorize - should redirect with code and state', async () => {
+        const response = await request(BASE_URL)
+            .post('/oauth/authorize')
+            .type('form')
+            .send({ ...authorizeParams(), username: USERNAME, password: PASSWORD })
+            .expect(302);
+
+        const location = new URL(response.headers.location);
+        expect(location.origin + location.pathname).toBe(REDIRECT_URI);
+        expect(location.searchParams.get('code')).toBeTruthy();
+        expect(location.searchParams.get('state')).toBe('xyz');
+    });
+
+    test('POST /oauth/token - should exchange the code once', async () => {
+        const code = await authorize();
+
+        const response = await exchange(code).expect(200);
+
+        expect(response.headers['cache-control']).toBe('no-store');
+        expect(response.body.token_type).toBe('Bearer');
+        expect(response.body.access_token).toBeDefined();
+        expect(response.body.refresh_token).toBeDefined();
+
+        await request(BASE_URL)
+            .get('/auth/me')
+            .set('Authorization', `Bearer ${response.body.access_token}`)
+            .expect(200);
+
+        const replay = await exchange(code).expect(400);
+        expect(replay.body.error).toBe('invalid_grant');
+    });
+
+    test('POST /oauth/token - should reject a wrong code_verifier', async () => {
+        const code = await authorize();
+
+        const response = await exchange(code, crypto.randomBytes(32).toString('base64url')).expect(400);
+
+        expect(response.body.error).toBe('invalid_grant');
+    });
+
+    test('POST /oauth/token - should require authentication of a confidential client', async () => {
+        const code = await authorize();
+
+        const response = await request(BASE_URL)
+            .post('/oauth/token')
+            .type('form')
+            .send({ grant_type: 'authorization_code', code, redirect_uri: REDIRECT_URI, code_verifier: CODE_VERIFIER, client_id: CLIENT_ID })
+            .expect(401);
+
+        expect(response.body.error).toBe('invalid_client');
+    });
+
+    test('POST /oauth/token - should reject an unknown grant_type', async () => {
+        const response = await request(BASE_URL)
+            .post('/oauth/token')
+            .type('form')
+            .send({ grant_type: 'implicit' })
+            .expect(400);
+
+        expect(response.body.error).toBe('unsupported_grant_type');
+    });
+});
@@ -0,0 +1,113 @@
+const request = require('supertest');
+
+const BASE_URL = 'http://localhost:8080';
+const CLIENT_ID = 'test-client';
+const CLIENT_SECRET = 'test-client-secret-for-jest-tests-only';
+const TEST_USER_ID = 'client-user-' + Math.random().toString(36).substring(7);
+
+const decodeClaims = (jwt) => JSON.parse(Buffer.from(jwt.split('.')[1], 'base64url').toString());
+
+describe('API clients', () => {
+
+    test('POST /auth/token - should require client authentication for user_id', async () => {
+        const response = await request(BASE_URL)
+            .post('/auth/token')
+            .send({ user_id: TEST_USER_ID })
+            .expect(401);
+
+        expect(response.body.error).toBe('Client authentication required');
+        expect(response.headers['www-authenticate']).toContain('Basic');
+    });
+
+    test('POST /auth/token - should reject a wrong client secret', async () => {
+        const response = await request(BASE_URL)
+            .post('/auth/token')
+            .auth(CLIENT_ID, 'wrong-secret')
+            .send({ user_id: TEST_USER_ID })
+            .expect(401);
+
+        expect(response.body.error).toBe('Invalid client');
+    });
+
+    test('POST /auth/token - should embed client_id as azp and keep it after refresh', async () => {
+        const issued = await request(BASE_URL)
+            .post('/auth/token')
+            .auth(CLIENT_ID, CLIENT_SECRET)
+            .send({ user_id: TEST_USER_ID })
+            .expect(200);
+
+        expect(decodeClaims(issued.body.access_token).azp).toBe(CLIENT_ID);
+
+        const refreshed = await request(BASE_URL)
+            .post('/auth/refresh')
+            .set('Authorization', `Bearer ${issued.body.access_token}`)
+            .send({ refresh_token: issued.body.refresh_token })
+            .expect(200);
+
+        expect(decodeClaims(refreshed.body.access_token).azp).toBe(CLIENT_ID);
+
+        const introspection = await request(BASE_URL)
+            .post('/oauth/introspect')
+            .auth(CLIENT_ID, CLIENT_SECRET)
+            .type('form')
+            .send({ token: refreshed.body.refresh_token })
+            .expect(200);
+
+        expect(introspection.body.active).toBe(true);
+        expect(introspection.body.client_id).toBe(CLIENT_ID);
+    });
+
+    test('POST /oauth/token - should issue a machine token for client_credentials', async () => {
+        const response = await request(BASE_URL)
+            .post('/oauth/token')
+            .auth(CLIENT_ID, CLIENT_SECRET)
+            .type('form')
+            .send({ grant_type: 'client_credentials' })
+            .expect(200);
+
+        expect(response.body.token_type).toBe('Bearer');
+        expect(response.body.refresh_token).toBeUndefined();
+
+        const claims = decodeClaims(response.body.access_token);
+        expect(claims.sub).toBe(CLIENT_ID);
+        expect(claims.token_use).toBe('client');
+        expect(claims.user_id).toBeUndefined();
+
+        const introspection = await request(BASE_URL)
+            .post('/oauth/introspect')
+            .auth(CLIENT_ID, CLIENT_SECRET)
+            .type('form')
+            .send({ token: response.body.access_token })
+            .expect(200);
+
+        expect(introspection.body.active).toBe(true);
+        expect(introspection.body.sub).toBe(CLIENT_ID);
+        expect(introspection.body.token_use).toBe('client');
+    });
+
+    test('GET /auth/me - should reject a machine token', async () => {
+        const issued = await request(BASE_URL)
+            .post('/oauth/token')
+            .auth(CLIENT_ID, CLIENT_SECRET)
+            .type('form')
+            .send({ grant_type: 'client_credentials' })
+            .expect(200);
+
+        const response = await request(BASE_URL)
+            .get('/auth/me')
+            .set('Authorization', `Bearer ${issued.body.access_token}`)
+            .expect(403);
+
+        expect(response.body.error).toBe('User token required');
+    });
+
+    test('POST /oauth/token - should require client authentication for client_credentials', async () => {
+        const response = await request(BASE_URL)
+            .post('/oauth/token')
+            .type('form')
+            .send({ grant_type: 'client_credentials' })
+            .expect(401);
+
+        expect(response.body.error).toBe('invalid_client');
+    });
+});
@@ -0,0 +1,125 @@
+const request = require('supertest');
+
+const BASE_URL = 'http://localhost:8080';
+const CLIENT_ID = 'test-client';
+const CLIENT_SECRET = 'test-client-secret-for-jest-tests-only';
+const DEVICE_AGENT = 'device-cli/1.0';
+const USERNAME = 'device-user-' + Math.random().toString(36).substring(7);
+const PASSWORD = 'correct horse battery staple';
+const GRANT_TYPE = 'urn:ietf:params:oauth:grant-type:device_code';
+
+const deviceAuthorization = () => request(BASE_URL)
+    .post('/oauth/device_authorization')
+    .auth(CLIENT_ID, CLIENT_SECRET)
+    .set('User-Agent', DEVICE_AGENT)
+    .type('form')
+    .send({})
+    .expect(200);
+
+const poll = (device_code) => request(BASE_URL)
+    .post('/oauth/token')
+    .auth(CLIENT_ID, CLIENT_SECRET)
+    .set('User-Agent', DEVICE_AGENT)
+    .type('form')
+    .send({ grant_type: GRANT_TYPE, device_code });
+
+describe('Device authorization grant', () => {
+
+    let access_token = '';
+
+    beforeAll(async () => {
+        await request(BASE_URL)
+            .post('/auth/register')
+            .send({ username: USERNAME, password: PASSWORD })
+            .expect(201);
+
+        const response = await request(BASE_URL)
+            .post('/auth/token')
+            .send({ username: USERNAME, password: PASSWORD })
+            .expect(200);
+
+        access_token = response.body.access_token;
+    });
+
+    test('POST /oauth/device_authorization - should issue device and user codes', async () => {
+        const response = await deviceAuthorization();
+
+        expect(response.body.device_code).toBeDefined();
+        expect(response.body.user_code).toMatch(/^[A-Z]{4}-[A-Z]{4}$/);
+        expect(response.body.verification_uri).toContain('/oauth/device');
+        expect(response.body.interval).toBe(5);
+    });
+
+    test('POST /oauth/token - should answer authorization_pending, then slow_down', async () => {
+        const { body } = await deviceAuthorization();
+
+        const pending = await poll(body.device_code).expect(400);
+        expect(pending.body.error).toBe('authorization_pending');
+
+        const fast = await poll(body.device_code).expect(400);
+        expect(fast.body.error).toBe('slow_down');
+    });
+
+    test('POST /oauth/device - should issue tokens to the device after approval', async () => {
+        const { body } = await deviceAuthorization();
+
+        const pending = await request(BASE_URL)
+            .get('/oauth/device')
+            .query({ user_code: body.user_code.toLowerCase() })
+            .set('Authorization', `Bearer ${access_token}`)
+            .expect(200);
+
+        expect(pending.body.client_id).toBe(CLIENT_ID);
+        expect(pending.body.user_agent).toBe(DEVICE_AGENT);
+
+        await request(BASE_URL)
+            .post('/oauth/device')
+            .set('Authorization', `Bearer ${access_token}`)
+            .send({ user_code: body.user_code, approve: true })
+            .expect(200);
+
+        const issued = await poll(body.device_code).expect(200);
+        expect(issued.body.refresh_token).toBeDefined();
+
+        const sessions = await request(BASE_URL)
+            .get('/auth/sessions')
+            .set('Authorization', `Bearer ${issued.body.access_token}`)
+            .expect(200);
+
+        const current = sessions.body.sessions.find((session) => session.current);
+        expect(current.device).toBe(DEVICE_AGENT);
+
+        const replay = await poll(body.device_code).expect(400);
+        expect(replay.body.error).toBe('invalid_grant');
+    });
+
+    test('POST /oauth/device - should answer access_denied after denial', async () => {
+        const { body } = await deviceAuthorization();
+
+        await request(BASE_URL)
+            .post('/oauth/device')
+            .set('Authorization', `Bearer ${access_token}`)
+            .send({ user_code: body.user_code, approve: false })
+            .expect(200);
+
+        const response = await poll(body.device_code).expect(400);
+        expect(response.body.error).toBe('access_denied');
+    });
+
+    test('POST /oauth/device - should require authorization', async () => {
+        await request(BASE_URL)
+            .post('/oauth/device')
+            .send({ user_code: 'BCDF-GHJK', approve: true })
+            .expect(401);
+    });
+
+    test('POST /oauth/device - should reject an unknown user code', async () => {
+        const response = await request(BASE_URL)
+            .post('/oauth/device')
+            .set('Authorization', `Bearer ${access_token}`)
+            .send({ user_code: 'BCDF-GHJK', approve: true })
+            .expect(404);
+
+        expect(response.body.error).toBe('Device code not found');
+    });
+});
@@ -0,0 +1,122 @@
+const request = require('supertest');
+
+const BASE_URL = 'http://localhost:8080';
+const CLIENT_ID = 'test-client';
+const CLIENT_SECRET = 'test-client-secret-for-jest-tests-only';
+const USERNAME = 'exchange-user-' + Math.random().toString(36).substring(7);
+const PASSWORD = 'correct horse battery staple';
+const GRANT_TYPE = 'urn:ietf:params:oauth:grant-type:token-exchange';
+const ACCESS_TOKEN_TYPE = 'urn:ietf:params:oauth:token-type:access_token';
+
+const decodeClaims = (jwt) => JSON.parse(Buffer.from(jwt.split('.')[1], 'base64url').toString());
+
+const exchange = (subject_token, audience = CLIENT_ID) => request(BASE_URL)
+    .post('/oauth/token')
+    .auth(CLIENT_ID, CLIENT_SECRET)
+    .type('form')
+    .send({ grant_type: GRANT_TYPE, subject_token, subject_token_type: ACCESS_TOKEN_TYPE, audience });
+
+describe('Token exchange', () => {
+
+    let access_token = '';
+
+    beforeAll(async () => {
+        await request(BASE_URL)
+            .post('/auth/register')
+            .send({ username: USERNAME, password: PASSWORD })
+            .expect(201);
+
+        const response = await request(BASE_URL)
+            .post('/auth/token')
+            .send({ username: USERNAME, password: PASSWORD })
+            .expect(200);
+
+        access_token = response.body.access_token;
+    });
+
+    test('POST /oauth/token - should issue an audience-restricted token with act', async () => {
+        const response = await exchange(access_token).expect(200);
+
+        expect(response.body.issued_token_type).toBe(ACCESS_TOKEN_TYPE);
+        expect(response.body.refresh_token).toBeUndefined();
+
+        const subject = decodeClaims(access_token);
+        const claims = decodeClaims(response.body.access_token);
+
+        expect(claims.user_id).toBe(subject.user_id);
+        expect(claims.aud).toEqual([CLIENT_ID]);
+        expect(claims.act).toEqual({ sub: CLIENT_ID });
+        expect(claims.exp).toBeLessThanOrEqual(subject.exp);
+    });
+
+    test('POST /oauth/token - should nest act when an exchanged token is exchanged again', async () => {
+        const first = await exchange(access_token).expect(200);
+        const second = await exchange(first.body.access_token).expect(200);
+
+        expect(decodeClaims(second.body.access_token).act).toEqual({ sub: CLIENT_ID, act: { sub: CLIENT_ID } });
+    });
+
+    test('GET /auth/me - should reject a token issued for another audience', async () => {
+        const response = await exchange(access_token).expect(200);
+
+        await request(BASE_URL)
+            .get('/auth/me')
+            .set('Authorization', `Bearer ${response.body.access_token}`)
+            .expect(401);
+    });
+
+    test('POST /oauth/token - should reject an unknown audience', async () => {
+        const response = await exchange(access_token, 'unknown-service').expect(400);
+
+        expect(response.body.error).toBe('invalid_target');
+    });
+
+    test('POST /oauth/token - should reject an invalid subject token', async () => {
+        const response = await exchange('invalid.token.here').expect(400);
+
+        expect(response.body.error).toBe('invalid_request');
+    });
+
+    test('POST /oauth/introspect - should revoke the exchanged token with the session', async () => {
+        const session = await request(BASE_URL)
+            .post('/auth/token')
+            .send({ username: USERNAME, password: PASSWORD })
+            .expect(200);
+
+        const exchanged = await exchange(session.body.access_token).expect(200);
+
+        await request(BASE_URL)
+            .post('/auth/logout')
+            .set('Authorization', `Bearer ${session.body.access_token}`)
+            .expect(200);
+
+        const introspection = await request(BASE_URL)
+            .post('/oauth/introspect')
+            .auth(CLIENT_ID, CLIENT_SECRET)
+            .type('form')
+            .send({ token: exchanged.body.access_token })
+            .expect(200);
+
+        expect(introspection.body.active).toBe(false);
+    });
+
+    test('POST /oauth/revoke - should not revoke the session with an exchanged token', async () => {
+        const session = await request(BASE_URL)
+            .post('/auth/token')
+            .send({ username: USERNAME, password: PASSWORD })
+            .expect(200);
+
+        const exchanged = await exchange(session.body.access_token).expect(200);
+
+        await request(BASE_URL)
+            .post('/oauth/revoke')
+            .type('form')
+            .send({ token: exchanged.body.access_token })
+            .expect(200);
+
+        await request(BASE_URL)
+            .get('/auth/me')
+            .set('Authorization', `Bearer ${session.body.access_token}`)
+            .expect(200);
+    });
+});
@@ -0,0 +1,132 @@
+const request = require('supertest');
+
+const BASE_URL = 'http://localhost:8080';
+const CLIENT_ID = 'test-client';
+const CLIENT_SECRET = 'test-client-secret-for-jest-tests-only';
+const TEST_USER_ID = 'oauth-user-' + Math.random().toString(36).substring(7);
+
+describe('OAuth endpoints', () => {
+
+    let access_token = '';
+    let refresh_token = '';
+
+    beforeAll(async () => {
+        const response = await request(BASE_URL)
+            .post('/auth/token')
+            .auth(CLIENT_ID, CLIENT_SECRET)
+            .send({ user_id: TEST_USER_ID })
+            .expect(200);
+
+        access_token = response.body.access_token;
+        refresh_token = response.body.refresh_token;
+    });
+
+    test('POST /oauth/introspect - should describe active access token', async () => {
+        const response = await request(BASE_URL)
+            .post('/oauth/introspect')
+            .auth(CLIENT_ID, CLIENT_SECRET)
+            .type('form')
+            .send({ token: access_token })
+            .expect(200);
+
+        expect(response.body.active).toBe(true);
+        expect(response.body.token_type).toBe('access_token');
+        expect(response.body.sub).toBe(TEST_USER_ID);
+        expect(response.body.pair_id).toBeDefined();
+    });
+
+    test('POST /oauth/introspect - should describe active refresh token', async () => {
+        const response = await request(BASE_URL)
+            .post('/oauth/introspect')
+            .auth(CLIENT_ID, CLIENT_SECRET)
+            .type('form')
+            .send({ token: refresh_token, token_type_hint: 'refresh_token' })
+            .expect(200);
+
+        expect(response.body.active).toBe(true);
+        expect(response.body.token_type).toBe('refresh_token');
+        expect(response.body.sub).toBe(TEST_USER_ID);
+    });
+
+    test('POST /oauth/introspect - should report unknown token as inactive', async () => {
+        const response = await request(BASE_URL)
+            .post('/oauth/introspect')
+            .auth(CLIENT_ID, CLIENT_SECRET)
+            .type('form')
+            .send({ token: 'invalid-token' })
+            .expect(200);
+
+        expect(response.body).toEqual({ active: false });
+    });
+
+    test('POST /oauth/introspect - should require client authentication', async () => {
+        const response = await request(BASE_URL)
+            .post('/oauth/introspect')
+            .type('form')
+            .send({ token: access_token })
+            .expect(401);
+
+        expect(response.body.error).toBe('invalid_client');
+        expect(response.headers['www-authenticate']).toContain('Basic');
+    });
+
+    test('POST /oauth/introspect - should reject a wrong client secret', async () => {
+        const response = await request(BASE_URL)
+            .post('/oauth/introspect')
+            .auth(CLIENT_ID, 'wrong-secret')
+            .type('form')
+            .send({ token: access_token })
+            .expect(401);
+
+        expect(response.body.error).toBe('invalid_client');
+    });
+
+    test('POST /oauth/introspect - should reject request without token', async () => {
+        const response = await request(BASE_URL)
+            .post('/oauth/introspect')
+            .auth(CLIENT_ID, CLIENT_SECRET)
+            .type('form')
+            .send({})
+            .expect(400);
+
+        expect(response.body.error).toBe('invalid_request');
+    });
+
+    test('POST /oauth/revoke - should revoke refresh token without access token', async () => {
+        const response = await request(BASE_URL)
+            .post('/oauth/revoke')
+            .type('form')
+            .send({ token: refresh_token, token_type_hint: 'refresh_token' })
+            .expect(200);
+
+        expect(response.body.success).toBeDefined();
+    });
+
+    test('POST /oauth/introspect - should report revoked refresh token as inactive', async () => {
+        const response = await request(BASE_URL)
+            .post('/oauth/introspect')
+            .auth(CLIENT_ID, CLIENT_SECRET)
+            .type('form')
+            .send({ token: refresh_token, token_type_hint: 'refresh_token' })
+            .expect(200);
+
+        expect(response.body).toEqual({ active: false });
+    });
+
+    test('GET /auth/me - should reject access token of revoked refresh token', async () => {
+        const response = await request(BASE_URL)
+            .get('/auth/me')
+            .set('Authorization', `Bearer ${access_token}`)
+            .expect(401);
+
+        expect(response.body.error).toBe('Token revoked');
+    });
+
+    test('POST /oauth/revoke - should answer 200 for unknown token', async () => {
+        await request(BASE_URL)
+            .post('/oauth/revoke')
+            .type('form')
+            .send({ token: 'invalid-token' })
+            .expect(200);
+    });
+});
@@ -0,0 +1,44 @@
+const request = require('supertest');
+
+const BASE_URL = 'http://localhost:8080';
+const CLIENT_ID = 'test-client';
+const CLIENT_SECRET = 'test-client-secret-for-jest-tests-only';
+const TEST_USER_ID = 'race-user-' + Math.random().toString(36).substring(7);
+const PARALLEL_REQUESTS = 10;
+
+describe('Refresh rotation', () => {
+
+    test('POST /auth/refresh - parallel refreshes with the same token succeed only once', async () => {
+        const tokens = await request(BASE_URL)
+            .post('/auth/token')
+            .auth(CLIENT_ID, CLIENT_SECRET)
+            .send({ user_id: TEST_USER_ID })
+            .expect(200);
+
+        const responses = await Promise.all(
+            Array.from({ length: PARALLEL_REQUESTS }, () =>
+                request(BASE_URL)
+                    .post('/auth/refresh')
+                    .set('Authorization', `Bearer ${tokens.body.access_token}`)
+                    .send({ refresh_token: tokens.body.refresh_token })
+            )
+        );
+
+        const succeeded = responses.filter(response => response.status === 200);
+        const rejected = responses.filter(response => response.status === 401);
+
+        expect(succeeded.length).toBe(1);
+        expect(rejected.length).toBe(PARALLEL_REQUESTS - 1);
+
+        rejected.forEach(response => expect(response.body.error).toBe('Refresh token reuse detected'));
+
+        // проигравшие запросы предъявили уже обменянный токен, поэтому
+        // цепочка отозвана целиком, включая пару победителя
+        const me = await request(BASE_URL)
+            .get('/auth/me')
+            .set('Authorization', `Bearer ${succeeded[0].body.access_token}`)
+            .expect(401);
+
+        expect(me.body.error).toBe('Token revoked');
+    });
+});
@@ -0,0 +1,122 @@
+const request = require('supertest');
+
+const BASE_URL = 'http://localhost:8080';
+const CLIENT_ID = 'test-client';
+const CLIENT_SECRET = 'test-client-secret-for-jest-tests-only';
+const USERNAME = 'scope-user-' + Math.random().toString(36).substring(7);
+const PASSWORD = 'correct horse battery staple';
+
+const decodeClaims = (jwt) => JSON.parse(Buffer.from(jwt.split('.')[1], 'base64url').toString());
+
+const signIn = (scope) => request(BASE_URL)
+    .post('/auth/token')
+    .send({ username: USERNAME, password: PASSWORD, scope });
+
+describe('Scopes and audience', () => {
+
+    beforeAll(async () => {
+        await request(BASE_URL)
+            .post('/auth/register')
+            .send({ username: USERNAME, password: PASSWORD })
+            .expect(201);
+    });
+
+    test('POST /auth/token - should grant all user scopes by default', async () => {
+        const response = await signIn().expect(200);
+
+        expect(response.body.scope.split(' ')).toEqual(expect.arrayContaining(['profile', 'sessions:read', 'sessions:write']));
+
+        const claims = decodeClaims(response.body.access_token);
+        expect(claims.scope).toBe(response.body.scope);
+        expect(claims.aud).toBeDefined();
+    });
+
+    test('GET /auth/sessions - should reject a token without sessions:read', async () => {
+        const { body } = await signIn('profile').expect(200);
+
+        expect(body.scope).toBe('profile');
+
+        await request(BASE_URL)
+            .get('/auth/me')
+            .set('Authorization', `Bearer ${body.access_token}`)
+            .expect(200);
+
+        const response = await request(BASE_URL)
+            .get('/auth/sessions')
+            .set('Authorization', `Bearer ${body.access_token}`)
+            .expect(403);
+
+        expect(response.body.error).toBe('Insufficient scope');
+        expect(response.headers['www-authenticate']).toContain('insufficient_scope');
+    });
+
+    test('POST /auth/refresh - should keep the scope of the session', async () => {
+        const { body } = await signIn('profile').expect(200);
+
+        const response = await request(BASE_URL)
+            .post('/auth/refresh')
+            .set('Authorization', `Bearer ${body.access_token}`)
+            .send({ refresh_token: body.refresh_token })
+            .expect(200);
+
+        expect(decodeClaims(response.body.access_token).scope).toBe('profile');
+    });
+
+    test('POST /auth/token - should reject an unknown scope', async () => {
+        const response = await signIn('profile admin').expect(400);
+
+        expect(response.body.error).toBe('Invalid scope');
+    });
+
+    test('POST /oauth/token - should issue a machine token with the client scope', async () => {
+        const response = await request(BASE_URL)
+            .post('/oauth/token')
+            .auth(CLIENT_ID, CLIENT_SECRET)
+            .type('form')
+            .send({ grant_type: 'client_credentials', scope: 'orders:read' })
+            .expect(200);
+
+        expect(response.body.scope).toBe('orders:read');
+
+        const invalid = await request(BASE_URL)
+            .post('/oauth/token')
+            .auth(CLIENT_ID, CLIENT_SECRET)
+            .type('form')
+            .send({ grant_type: 'client_credentials', scope: 'orders:write' })
+            .expect(400);
+
+        expect(invalid.body.error).toBe('invalid_scope');
+    });
+
+    test('POST /oauth/token - token exchange should only narrow the scope', async () => {
+        const { body } = await signIn('profile sessions:read').expect(200);
+
+        const exchange = (scope) => request(BASE_URL)
+            .post('/oauth/token')
+            .auth(CLIENT_ID, CLIENT_SECRET)
+            .type('form')
+            .send({
+                grant_type: 'urn:ietf:params:oauth:grant-type:token-exchange',
+                subject_token: body.access_token,
+                subject_token_type: 'urn:ietf:params:oauth:token-type:access_token',
+                audience: CLIENT_ID,
+                scope,
+            });
+
+        const narrowed = await exchange('profile').expect(200);
+        expect(decodeClaims(narrowed.body.access_token).scope).toBe('profile');
+
+        const widened = await exchange('sessions:write').expect(400);
+        expect(widened.body.error).toBe('invalid_scope');
+    });
+
+    test('GET /.well-known/openid-configuration - should list supported scopes', async () => {
+        const response = await request(BASE_URL)
+            .get('/.well-known/openid-configuration')
+            .expect(200);
+
+        expect(response.body.scopes_supported).toEqual(expect.arrayContaining(['profile', 'sessions:read', 'sessions:write']));
+        expect(response.body.claims_supported).toEqual(expect.arrayContaining(['scope', 'roles', 'user_id']));
+        expect(response.body.id_token_signing_alg_values_supported).toBeUndefined();
+    });
+});
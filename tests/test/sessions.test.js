@@ -0,0 +1,199 @@
+const request = require('supertest');
+
+const BASE_URL = 'http://localhost:8080';
+const CLIENT_ID = 'test-client';
+const CLIENT_SECRET = 'test-client-secret-for-jest-tests-only';
+const TEST_USER_ID = 'sessions-user-' + Math.random().toString(36).substring(7);
+
+describe('Sessions API', () => {
+
+    let first = {};
+    let second = {};
+
+    beforeAll(async () => {
+        first = (await request(BASE_URL)
+            .post('/auth/token')
+            .auth(CLIENT_ID, CLIENT_SECRET)
+            .set('User-Agent', 'Device-One')
+            .send({ user_id: TEST_USER_ID })
+            .expect(200)).body;
+
+        second = (await request(BASE_URL)
+            .post('/auth/token')
+            .auth(CLIENT_ID, CLIENT_SECRET)
+            .set('User-Agent', 'Device-Two')
+            .send({ user_id: TEST_USER_ID })
+            .expect(200)).body;
+    });
+
+    test('GET /auth/sessions - should list active sessions of the user', async () => {
+        const response = await request(BASE_URL)
+            .get('/auth/sessions')
+            .set('Authorization', `Bearer ${first.access_token}`)
+            .expect(200);
+
+        expect(response.body.sessions.length).toBe(2);
+
+        const devices = response.body.sessions.map(session => session.device).sort();
+        expect(devices).toEqual(['Device-One', 'Device-Two']);
+
+        const current = response.body.sessions.filter(session => session.current);
+        expect(current.length).toBe(1);
+        expect(current[0].device).toBe('Device-One');
+    });
+
+    test('GET /auth/sessions - should reject without Authorization header', async () => {
+        const response = await request(BASE_URL)
+            .get('/auth/sessions')
+            .expect(401);
+
+        expect(response.body.error).toBe('Authorization required');
+    });
+
+    describe('Revoking sessions', () => {
+
+        const USER_ID = 'sessions-revoke-' + Math.random().toString(36).substring(7);
+
+        const issue = async (device) => (await request(BASE_URL)
+            .post('/auth/token')
+            .auth(CLIENT_ID, CLIENT_SECRET)
+            .set('User-Agent', device)
+            .send({ user_id: USER_ID })
+            .expect(200)).body;
+
+        const currentPairId = async (accessToken) => {
+            const response = await request(BASE_URL)
+                .get('/auth/sessions')
+                .set('Authorization', `Bearer ${accessToken}`)
+                .expect(200);
+
+            return response.body.sessions.find(session => session.current).pair_id;
+        };
+
+        test('DELETE /auth/sessions/{pair_id} - should sign out another device', async () => {
+            const laptop = await issue('Laptop');
+            const phone = await issue('Phone');
+
+            const phonePairId = await currentPairId(phone.access_token);
+
+            const response = await request(BASE_URL)
+                .delete(`/auth/sessions/${phonePairId}`)
+                .set('Authorization', `Bearer ${laptop.access_token}`)
+                .expect(200);
+
+            expect(response.body.success).toBe('Session revoked');
+
+            await request(BASE_URL)
+                .get('/auth/me')
+                .set('Authorization', `Bearer ${phone.access_token}`)
+                .expect(401);
+
+            await request(BASE_URL)
+                .post('/auth/refresh')
+                .set('Authorization', `Bearer ${phone.access_token}`)
+                .send({ refresh_token: phone.refresh_token })
+                .expect(401);
+
+            await request(BASE_URL)
+                .get('/auth/me')
+                .set('Authorization', `Bearer ${laptop.access_token}`)
+                .expect(200);
+        });
+
+        test('DELETE /auth/sessions/{pair_id} - should not revoke a session of another user', async () => {
+            const victim = await issue('Victim');
+            const victimPairId = await currentPairId(victim.access_token);
+
+            const attacker = (await request(BASE_URL)
+                .post('/auth/token')
+                .auth(CLIENT_ID, CLIENT_SECRET)
+                .send({ user_id: USER_ID + '-other' })
+                .expect(200)).body;
+
+            const response = await request(BASE_URL)
+                .delete(`/auth/sessions/${victimPairId}`)
+                .set('Authorization', `Bearer ${attacker.access_token}`)
+                .expect(404);
+
+            expect(response.body.error).toBe('Session not found');
+
+            await request(BASE_URL)
+                .get('/auth/me')
+                .set('Authorization', `Bearer ${victim.access_token}`)
+                .expect(200);
+        });
+
+        test('POST /auth/logout-all - should keep the current session when asked', async () => {
+            const current = await issue('Current');
+            const other = await issue('Other');
+
+            await request(BASE_URL)
+                .post('/auth/logout-all')
+                .set('Authorization', `Bearer ${current.access_token}`)
+                .send({ keep_current: true })
+                .expect(200);
+
+            await request(BASE_URL)
+                .get('/auth/me')
+                .set('Authorization', `Bearer ${other.access_token}`)
+                .expect(401);
+
+            await request(BASE_URL)
+                .get('/auth/me')
+                .set('Authorization', `Bearer ${current.access_token}`)
+                .expect(200);
+        });
+
+        test('POST /auth/logout-all - should invalidate tokens issued in earlier seconds', async () => {
+            const old = await issue('Old');
+
+            // iat хранится с точностью до секунды
+            await new Promise(resolve => setTimeout(resolve, 1100));
+
+            const current = await issue('Current');
+
+            await request(BASE_URL)
+                .post('/auth/logout-all')
+                .set('Authorization', `Bearer ${current.access_token}`)
+                .expect(200);
+
+            const introspection = await request(BASE_URL)
+                .post('/oauth/introspect')
+                .auth(CLIENT_ID, CLIENT_SECRET)
+                .type('form')
+                .send({ token: old.access_token })
+                .expect(200);
+
+            expect(introspection.body.active).toBe(false);
+
+            const relogin = await issue('Relogin');
+
+            await request(BASE_URL)
+                .get('/auth/me')
+                .set('Authorization', `Bearer ${relogin.access_token}`)
+                .expect(200);
+        });
+
+        test('POST /auth/logout-all - should sign out every session', async () => {
+            const current = await issue('Current');
+
+            const response = await request(BASE_URL)
+                .post('/auth/logout-all')
+                .set('Authorization', `Bearer ${current.access_token}`)
+                .expect(200);
+
+            expect(response.body.success).toBe('Successfully logged out from all sessions');
+
+            await request(BASE_URL)
+                .get('/auth/me')
+                .set('Authorization', `Bearer ${current.access_token}`)
+                .expect(401);
+
+            await request(BASE_URL)
+                .post('/auth/refresh')
+                .set('Authorization', `Bearer ${current.access_token}`)
+                .send({ refresh_token: current.refresh_token })
+                .expect(401);
+        });
+    });
+});
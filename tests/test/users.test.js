@@ -0,0 +1,77 @@
+const request = require('supertest');
+
+const BASE_URL = 'http://localhost:8080';
+const USERNAME = 'user-' + Math.random().toString(36).substring(7);
+const PASSWORD = 'correct horse battery staple';
+
+describe('Users API', () => {
+
+    let user_id = '';
+
+    test('POST /auth/register - should create a user', async () => {
+        const response = await request(BASE_URL)
+            .post('/auth/register')
+            .send({ username: USERNAME, password: PASSWORD })
+            .expect(201);
+
+        expect(response.body.user_id).toBeDefined();
+
+        user_id = response.body.user_id;
+    });
+
+    test('POST /auth/register - should reject a taken username', async () => {
+        const response = await request(BASE_URL)
+            .post('/auth/register')
+            .send({ username: USERNAME.toUpperCase(), password: PASSWORD })
+            .expect(409);
+
+        expect(response.body.error).toBe('Username already taken');
+    });
+
+    test('POST /auth/register - should reject a short password', async () => {
+        const response = await request(BASE_URL)
+            .post('/auth/register')
+            .send({ username: USERNAME + '-short', password: 'short' })
+            .expect(400);
+
+        expect(response.body.error).toBe('Password is too short');
+    });
+
+    test('POST /auth/token - should issue tokens for valid credentials', async () => {
+        const login = await request(BASE_URL)
+            .post('/auth/token')
+            .send({ username: USERNAME, password: PASSWORD })
+            .expect(200);
+
+        const me = await request(BASE_URL)
+            .get('/auth/me')
+            .set('Authorization', `Bearer ${login.body.access_token}`)
+            .expect(200);
+
+        expect(me.body.user_id).toBe(user_id);
+
+        await request(BASE_URL)
+            .post('/auth/refresh')
+            .set('Authorization', `Bearer ${login.body.access_token}`)
+            .send({ refresh_token: login.body.refresh_token })
+            .expect(200);
+    });
+
+    test('POST /auth/token - should reject a wrong password', async () => {
+        const response = await request(BASE_URL)
+            .post('/auth/token')
+            .send({ username: USERNAME, password: 'wrong password' })
+            .expect(401);
+
+        expect(response.body.error).toBe('Invalid username or password');
+    });
+
+    test('POST /auth/token - should not reveal unknown usernames', async () => {
+        const response = await request(BASE_URL)
+            .post('/auth/token')
+            .send({ username: USERNAME + '-missing', password: PASSWORD })
+            .expect(401);
+
+        expect(response.body.error).toBe('Invalid username or password');
+    });
+});